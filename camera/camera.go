@@ -0,0 +1,232 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/mqtt"
+)
+
+const (
+	defaultPort        = 6000
+	defaultUsername    = "bblp"
+	defaultDialTimeout = 10 * time.Second
+	headerSize         = 16
+	authPayloadSize    = 0x40
+	authType           = 0x3000
+	credentialSize     = 32
+	maxFrameSize       = 16 * 1024 * 1024
+	mjpegBoundary      = "bambulabframe"
+)
+
+var (
+	ErrNotLocal     = errors.New("camera requires a local client")
+	ErrInvalidFrame = errors.New("invalid camera frame")
+)
+
+var (
+	jpegStart = []byte{0xFF, 0xD8}
+	jpegEnd   = []byte{0xFF, 0xD9}
+)
+
+// Frame is a JPEG image from the camera.
+type Frame struct {
+	Time time.Time
+	Data []byte
+}
+
+// Client reads frames from the camera of A1 and P1 series printers.
+type Client struct {
+	Addr        string
+	Username    string
+	AccessCode  string
+	TLSConfig   *tls.Config
+	DialTimeout time.Duration
+}
+
+// New creates a client for the camera of the printer at ip.
+func New(ip, accessCode string) *Client {
+	c := &Client{
+		Addr:       net.JoinHostPort(ip, strconv.Itoa(defaultPort)),
+		Username:   defaultUsername,
+		AccessCode: accessCode,
+		// Printers present a self signed certificate
+		TLSConfig:   &tls.Config{InsecureSkipVerify: true},
+		DialTimeout: defaultDialTimeout,
+	}
+	return c
+}
+
+// NewFromClient creates a camera client sharing the address and access code
+// of an mqtt client connected over the local network.
+func NewFromClient(c *mqtt.Client) (*Client, error) {
+	if !c.Local() {
+		return nil, ErrNotLocal
+	}
+	return New(c.Host(), c.AccessCode()), nil
+}
+
+// Snapshot returns the next frame from the camera.
+func (c *Client) Snapshot(ctx context.Context) (Frame, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Frame{}, err
+	}
+	defer conn.Close()
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+
+	frame, err := readFrame(conn)
+	if err != nil && ctx.Err() != nil {
+		return Frame{}, ctx.Err()
+	}
+	return frame, err
+}
+
+// Stream sends frames from the camera to frames until ctx is done or the
+// connection fails. It returns nil once ctx is done.
+func (c *Client) Stream(ctx context.Context, frames chan<- Frame) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+
+	for {
+		frame, err := readFrame(conn)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case frames <- frame:
+		}
+	}
+}
+
+// Handler serves the camera as an MJPEG stream.
+// Each request opens its own connection to the camera.
+func (c *Client) Handler() http.Handler {
+	return http.HandlerFunc(c.serveMJPEG)
+}
+
+func (c *Client) serveMJPEG(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	conn, err := c.dial(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer conn.Close()
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+
+	// The camera closes the connection on a wrong access code without an
+	// answer, so only reply once the first frame has arrived
+	frame, err := readFrame(conn)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("read camera: %s", err), http.StatusBadGateway)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "multipart/x-mixed-replace; boundary="+mjpegBoundary)
+	header.Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for {
+		if err := writePart(w, frame); err != nil {
+			return
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		if frame, err = readFrame(conn); err != nil {
+			if ctx.Err() == nil {
+				fmt.Printf("camera stream ended, err=%s\n", err)
+			}
+			return
+		}
+	}
+}
+
+func writePart(w io.Writer, frame Frame) error {
+	_, err := fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n",
+		mjpegBoundary, len(frame.Data))
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(frame.Data); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\r\n")
+	return err
+}
+
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	timeout := c.DialTimeout
+	if timeout <= 0 {
+		timeout = defaultDialTimeout
+	}
+	d := &tls.Dialer{NetDialer: &net.Dialer{Timeout: timeout}, Config: c.TLSConfig}
+	conn, err := d.DialContext(ctx, "tcp", c.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial camera: %w", err)
+	}
+	if _, err := conn.Write(authPacket(c.Username, c.AccessCode)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("authenticate camera: %w", err)
+	}
+	return conn, nil
+}
+
+// authPacket is a frame header followed by null padded credentials.
+func authPacket(username, accessCode string) []byte {
+	b := make([]byte, headerSize+2*credentialSize)
+	binary.LittleEndian.PutUint32(b[0:], authPayloadSize)
+	binary.LittleEndian.PutUint32(b[4:], authType)
+	copy(b[headerSize:headerSize+credentialSize], username)
+	copy(b[headerSize+credentialSize:], accessCode)
+	return b
+}
+
+// readFrame reads a header giving the payload size followed by a JPEG payload.
+func readFrame(r io.Reader) (Frame, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Frame{}, err
+	}
+	size := binary.LittleEndian.Uint32(header[0:4])
+	if size < uint32(len(jpegStart)+len(jpegEnd)) || size > maxFrameSize {
+		return Frame{}, fmt.Errorf("%w: size %d", ErrInvalidFrame, size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return Frame{}, err
+	}
+	if !bytes.HasPrefix(data, jpegStart) || !bytes.HasSuffix(data, jpegEnd) {
+		return Frame{}, fmt.Errorf("%w: not a jpeg", ErrInvalidFrame)
+	}
+	return Frame{Time: time.Now(), Data: data}, nil
+}
+
+func closeOnDone(ctx context.Context, conn net.Conn) func() bool {
+	return context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+}
@@ -0,0 +1,205 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/mqtt"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAccessCode = "12345678"
+
+func jpeg(n byte) []byte {
+	return []byte{0xFF, 0xD8, n, n, n, 0xFF, 0xD9}
+}
+
+// fakeCamera accepts authenticated connections and sends frames every
+// interval until the connection closes.
+func fakeCamera(t *testing.T, frame []byte, interval time.Duration) *Client {
+	cfg := &tls.Config{Certificates: []tls.Certificate{selfSigned(t)}}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	assert.Nil(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveCamera(conn, frame, interval)
+		}
+	}()
+
+	host, _, _ := net.SplitHostPort(l.Addr().String())
+	c := New(host, testAccessCode)
+	c.Addr = l.Addr().String()
+	return c
+}
+
+func serveCamera(conn net.Conn, frame []byte, interval time.Duration) {
+	defer conn.Close()
+	auth := make([]byte, headerSize+2*credentialSize)
+	if _, err := io.ReadFull(conn, auth); err != nil {
+		return
+	}
+	if binary.LittleEndian.Uint32(auth[4:]) != authType {
+		return
+	}
+	user := string(bytes.TrimRight(auth[headerSize:headerSize+credentialSize], "\x00"))
+	code := string(bytes.TrimRight(auth[headerSize+credentialSize:], "\x00"))
+	if user != defaultUsername || code != testAccessCode {
+		return
+	}
+	header := make([]byte, headerSize)
+	binary.LittleEndian.PutUint32(header, uint32(len(frame)))
+	binary.LittleEndian.PutUint32(header[8:], 1)
+	for {
+		if _, err := conn.Write(append(header, frame...)); err != nil {
+			return
+		}
+		time.Sleep(interval)
+	}
+}
+
+func selfSigned(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "printer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.Nil(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestClient_Snapshot(t *testing.T) {
+	c := fakeCamera(t, jpeg(1), 10*time.Millisecond)
+	frame, err := c.Snapshot(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, jpeg(1), frame.Data)
+	assert.False(t, frame.Time.IsZero())
+}
+
+func TestClient_SnapshotWrongAccessCode(t *testing.T) {
+	c := fakeCamera(t, jpeg(1), 10*time.Millisecond)
+	c.AccessCode = "wrong"
+	_, err := c.Snapshot(context.Background())
+	assert.NotNil(t, err)
+}
+
+func TestClient_SnapshotInvalidFrame(t *testing.T) {
+	c := fakeCamera(t, []byte("not a jpeg"), 10*time.Millisecond)
+	_, err := c.Snapshot(context.Background())
+	assert.True(t, errors.Is(err, ErrInvalidFrame))
+}
+
+func TestClient_Stream(t *testing.T) {
+	c := fakeCamera(t, jpeg(2), time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	frames := make(chan Frame)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Stream(ctx, frames)
+	}()
+	for i := 0; i < 3; i++ {
+		frame := <-frames
+		assert.Equal(t, jpeg(2), frame.Data)
+	}
+	cancel()
+	assert.Nil(t, <-errc)
+}
+
+func TestClient_Handler(t *testing.T) {
+	c := fakeCamera(t, jpeg(3), time.Millisecond)
+	srv := httptest.NewServer(c.Handler())
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	assert.Nil(t, err)
+	assert.Equal(t, "multipart/x-mixed-replace", mediaType)
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	for i := 0; i < 2; i++ {
+		part, err := mr.NextPart()
+		assert.Nil(t, err)
+		assert.Equal(t, "image/jpeg", part.Header.Get("Content-Type"))
+		b, err := io.ReadAll(part)
+		assert.Nil(t, err)
+		assert.Equal(t, jpeg(3), b)
+	}
+}
+
+func TestClient_HandlerCameraError(t *testing.T) {
+	unreachable := New("127.0.0.1", testAccessCode)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	unreachable.Addr = l.Addr().String()
+	l.Close()
+	wrongCode := fakeCamera(t, jpeg(3), time.Millisecond)
+	wrongCode.AccessCode = "wrong"
+
+	tests := []struct {
+		name   string
+		client *Client
+		body   string
+	}{
+		{name: "unreachable", client: unreachable, body: "dial camera"},
+		{name: "wrong access code", client: wrongCode, body: "read camera"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.client.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+			assert.Equal(t, http.StatusBadGateway, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.body)
+			assert.NotContains(t, rec.Header().Get("Content-Type"), "multipart")
+		})
+	}
+}
+
+func TestAuthPacket(t *testing.T) {
+	b := authPacket("bblp", testAccessCode)
+	assert.Len(t, b, 80)
+	assert.Equal(t, uint32(0x40), binary.LittleEndian.Uint32(b[0:]))
+	assert.Equal(t, uint32(0x3000), binary.LittleEndian.Uint32(b[4:]))
+	assert.True(t, strings.HasPrefix(string(b[16:]), "bblp\x00"))
+	assert.True(t, strings.HasPrefix(string(b[48:]), testAccessCode+"\x00"))
+}
+
+func TestNewFromClient(t *testing.T) {
+	local, err := mqtt.NewLocalClient("192.168.1.50", "01S00A000000000", testAccessCode)
+	assert.Nil(t, err)
+	c, err := NewFromClient(local)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.168.1.50:6000", c.Addr)
+
+	cloud, err := mqtt.NewCloudClient("us.mqtt.bambulab.com", "01S00A000000000", "u_1", "token")
+	assert.Nil(t, err)
+	_, err = NewFromClient(cloud)
+	assert.True(t, errors.Is(err, ErrNotLocal))
+}
@@ -0,0 +1,176 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	loginPath      = "/v1/user-service/user/login"
+	sendCodePath   = "/v1/user-service/user/sendemail/code"
+	refreshPath    = "/v1/user-service/user/refreshtoken"
+	preferencePath = "/v1/design-user-service/my/preference"
+
+	loginTypeVerifyCode = "verifyCode"
+	loginTypeTfa        = "tfa"
+)
+
+var (
+	// ErrVerificationRequired is returned by Login when the account needs a
+	// code sent by email. Call LoginWithCode with the code to finish.
+	ErrVerificationRequired = errors.New("verification code sent by email")
+	ErrTfaRequired          = errors.New("two factor authentication is not supported")
+)
+
+type loginRequest struct {
+	Account  string `json:"account"`
+	Password string `json:"password,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+type sendCodeRequest struct {
+	Email string `json:"email"`
+	Type  string `json:"type"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"accessToken"`
+	RefreshToken     string `json:"refreshToken"`
+	ExpiresIn        int64  `json:"expiresIn"`
+	RefreshExpiresIn int64  `json:"refreshExpiresIn"`
+	LoginType        string `json:"loginType"`
+	TfaKey           string `json:"tfaKey"`
+}
+
+func (r tokenResponse) token(now time.Time) Token {
+	t := Token{
+		AccessToken:  r.AccessToken,
+		RefreshToken: r.RefreshToken,
+	}
+	if r.ExpiresIn > 0 {
+		t.ExpiresAt = now.Add(time.Duration(r.ExpiresIn) * time.Second)
+	}
+	if r.RefreshExpiresIn > 0 {
+		t.RefreshExpiresAt = now.Add(time.Duration(r.RefreshExpiresIn) * time.Second)
+	}
+	return t
+}
+
+type preferenceResponse struct {
+	Uid int64 `json:"uid"`
+}
+
+// Login authenticates with an email and password. Accounts without a
+// password login are sent a verification code and ErrVerificationRequired
+// is returned.
+func (c *Client) Login(ctx context.Context, email, password string) error {
+	resp := tokenResponse{}
+	req := loginRequest{Account: email, Password: password}
+	if err := c.do(ctx, http.MethodPost, loginPath, "", req, &resp); err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	switch {
+	case resp.LoginType == loginTypeTfa:
+		return ErrTfaRequired
+	case resp.LoginType == loginTypeVerifyCode || resp.AccessToken == "":
+		if err := c.RequestCode(ctx, email); err != nil {
+			return err
+		}
+		return ErrVerificationRequired
+	}
+	c.SetToken(resp.token(time.Now()))
+	fmt.Printf("cloud client logged in\n")
+	return nil
+}
+
+// RequestCode emails a verification code to log in with.
+func (c *Client) RequestCode(ctx context.Context, email string) error {
+	req := sendCodeRequest{Email: email, Type: "codeLogin"}
+	if err := c.do(ctx, http.MethodPost, sendCodePath, "", req, nil); err != nil {
+		return fmt.Errorf("request verification code: %w", err)
+	}
+	return nil
+}
+
+// LoginWithCode authenticates with a verification code sent by email.
+func (c *Client) LoginWithCode(ctx context.Context, email, code string) error {
+	resp := tokenResponse{}
+	req := loginRequest{Account: email, Code: code}
+	if err := c.do(ctx, http.MethodPost, loginPath, "", req, &resp); err != nil {
+		return fmt.Errorf("login with code: %w", err)
+	}
+	if resp.AccessToken == "" {
+		return fmt.Errorf("login with code: %w", ErrNotLoggedIn)
+	}
+	c.SetToken(resp.token(time.Now()))
+	fmt.Printf("cloud client logged in\n")
+	return nil
+}
+
+// Refresh exchanges the refresh token for a new access token.
+func (c *Client) Refresh(ctx context.Context) error {
+	t := c.Token()
+	if t.RefreshToken == "" {
+		return ErrNotLoggedIn
+	}
+	if !t.RefreshExpiresAt.IsZero() && time.Now().After(t.RefreshExpiresAt) {
+		return ErrTokenExpired
+	}
+	resp := tokenResponse{}
+	req := refreshRequest{RefreshToken: t.RefreshToken}
+	if err := c.do(ctx, http.MethodPost, refreshPath, "", req, &resp); err != nil {
+		return fmt.Errorf("refresh token: %w", err)
+	}
+	refreshed := resp.token(time.Now())
+	// Not every response rotates the refresh token
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = t.RefreshToken
+		refreshed.RefreshExpiresAt = t.RefreshExpiresAt
+	}
+	c.mu.Lock()
+	c.token = refreshed
+	c.mu.Unlock()
+	fmt.Printf("cloud client refreshed token\n")
+	return nil
+}
+
+// UserID returns the id of the logged in account.
+func (c *Client) UserID(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	uid := c.uid
+	c.mu.Unlock()
+	if uid != "" {
+		return uid, nil
+	}
+	resp := preferenceResponse{}
+	if err := c.get(ctx, preferencePath, &resp); err != nil {
+		return "", fmt.Errorf("get user id: %w", err)
+	}
+	uid = strconv.FormatInt(resp.Uid, 10)
+	c.mu.Lock()
+	c.uid = uid
+	c.mu.Unlock()
+	return uid, nil
+}
+
+// MQTTCredentials returns the username and password for the cloud broker,
+// suitable for mqtt.NewCloudClient.
+func (c *Client) MQTTCredentials(ctx context.Context) (username, password string, err error) {
+	uid, err := c.UserID(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return "u_" + uid, token, nil
+}
@@ -0,0 +1,216 @@
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	// Refresh tokens this long before they expire
+	refreshMargin = 5 * time.Minute
+)
+
+var (
+	ErrNotLoggedIn  = errors.New("not logged in")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// APIError is a non 2xx response from the cloud API.
+type APIError struct {
+	StatusCode int
+	Code       int    `json:"code"`
+	Message    string `json:"error"`
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("cloud api: status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("cloud api: status %d: %s", e.StatusCode, e.Message)
+}
+
+// Token authenticates requests to the cloud API and the cloud MQTT broker.
+type Token struct {
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// Expired reports whether the access token is expired or about to be.
+func (t Token) Expired() bool {
+	return !t.ExpiresAt.IsZero() && time.Now().Add(refreshMargin).After(t.ExpiresAt)
+}
+
+// Client talks to the Bambu Lab cloud HTTP API.
+type Client struct {
+	// Region the account is registered in.
+	Region Region
+	// BaseURL of the API, override to test against a local server.
+	BaseURL string
+	// MQTTEndpoint is the broker cloud mqtt clients connect to.
+	MQTTEndpoint string
+	HTTPClient   *http.Client
+
+	mu    sync.Mutex
+	token Token
+	uid   string
+}
+
+type Option func(*Client)
+
+// WithRegion selects the API and broker for the region of the account.
+// URLs set by other options take precedence.
+func WithRegion(r Region) Option {
+	return func(c *Client) {
+		c.Region = r
+	}
+}
+
+// WithBaseURL overrides the API base url of the region.
+func WithBaseURL(url string) Option {
+	return func(c *Client) {
+		c.BaseURL = url
+	}
+}
+
+// WithMQTTEndpoint overrides the broker of the region.
+func WithMQTTEndpoint(endpoint string) Option {
+	return func(c *Client) {
+		c.MQTTEndpoint = endpoint
+	}
+}
+
+// WithToken uses a token saved by a previous login.
+func WithToken(t Token) Option {
+	return func(c *Client) {
+		c.token = t
+	}
+}
+
+// WithHTTPClient sets the client used for API requests.
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) {
+		c.HTTPClient = h
+	}
+}
+
+// New creates a client for the cloud API, in the global region unless
+// another is given. Log in or set a token before use. Requests fail with
+// ErrUnknownRegion if the region is unknown and no URL overrides it.
+func New(opts ...Option) *Client {
+	c := &Client{
+		Region:     RegionGlobal,
+		HTTPClient: &http.Client{Timeout: defaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	endpoints, _ := c.Region.Endpoints()
+	if c.BaseURL == "" {
+		c.BaseURL = endpoints.API
+	}
+	if c.MQTTEndpoint == "" {
+		c.MQTTEndpoint = endpoints.MQTT
+	}
+	return c
+}
+
+// Token returns the current token so it can be saved for later.
+func (c *Client) Token() Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// SetToken replaces the current token.
+func (c *Client) SetToken(t Token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = t
+	c.uid = ""
+}
+
+// get sends an authenticated GET request, decoding the response into out.
+func (c *Client) get(ctx context.Context, path string, out any) error {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodGet, path, token, nil, out)
+}
+
+// accessToken returns a valid access token, refreshing it if expired.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	t := c.Token()
+	if t.AccessToken == "" {
+		return "", ErrNotLoggedIn
+	}
+	if t.Expired() {
+		if err := c.Refresh(ctx); err != nil {
+			return "", err
+		}
+		t = c.Token()
+	}
+	return t.AccessToken, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path, token string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	if c.BaseURL == "" {
+		return fmt.Errorf("%w %q", ErrUnknownRegion, c.Region)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		// Error bodies aren't always json, keep the status regardless
+		_ = json.Unmarshal(b, apiErr)
+		return apiErr
+	}
+	if out == nil || len(b) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("decode %s response: %w", path, err)
+	}
+	return nil
+}
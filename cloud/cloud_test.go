@@ -0,0 +1,171 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testEmail    = "maker@example.com"
+	testPassword = "hunter2"
+	testCode     = "123456"
+)
+
+// fakeCloud implements the parts of the cloud API used by the client.
+type fakeCloud struct {
+	mu        sync.Mutex
+	verify    bool
+	codeSent  bool
+	tokens    int
+	refreshes int
+	expiresIn int64
+	handlers  map[string]http.HandlerFunc
+	lastAuth  string
+}
+
+func newFakeCloud(t *testing.T) (*fakeCloud, *Client) {
+	f := &fakeCloud{expiresIn: 3600, handlers: map[string]http.HandlerFunc{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, New(WithBaseURL(srv.URL))
+}
+
+func (f *fakeCloud) issue(w http.ResponseWriter) {
+	f.tokens++
+	writeJSON(w, map[string]any{
+		"accessToken":      fmt.Sprintf("access-%d", f.tokens),
+		"refreshToken":     fmt.Sprintf("refresh-%d", f.tokens),
+		"expiresIn":        f.expiresIn,
+		"refreshExpiresIn": 7776000,
+	})
+}
+
+func (f *fakeCloud) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body := map[string]string{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	switch r.URL.Path {
+	case loginPath:
+		switch {
+		case body["account"] != testEmail:
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]any{"code": 1, "error": "Incorrect account or password"})
+		case body["code"] == testCode && f.codeSent:
+			f.issue(w)
+		case body["password"] == testPassword && f.verify:
+			writeJSON(w, map[string]any{"accessToken": "", "loginType": loginTypeVerifyCode})
+		case body["password"] == testPassword:
+			f.issue(w)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]any{"code": 1, "error": "Incorrect account or password"})
+		}
+	case sendCodePath:
+		f.codeSent = body["email"] == testEmail && body["type"] == "codeLogin"
+	case refreshPath:
+		f.refreshes++
+		f.issue(w)
+	default:
+		f.lastAuth = r.Header.Get("Authorization")
+		if f.lastAuth == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == preferencePath {
+			writeJSON(w, map[string]any{"uid": 1234567890})
+			return
+		}
+		if h, ok := f.handlers[r.URL.Path]; ok {
+			h(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestClient_Login(t *testing.T) {
+	_, c := newFakeCloud(t)
+	assert.Nil(t, c.Login(context.Background(), testEmail, testPassword))
+	token := c.Token()
+	assert.Equal(t, "access-1", token.AccessToken)
+	assert.Equal(t, "refresh-1", token.RefreshToken)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), token.ExpiresAt, time.Minute)
+	assert.False(t, token.Expired())
+}
+
+func TestClient_LoginWrongPassword(t *testing.T) {
+	_, c := newFakeCloud(t)
+	err := c.Login(context.Background(), testEmail, "wrong")
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, "Incorrect account or password", apiErr.Message)
+}
+
+func TestClient_LoginVerificationCode(t *testing.T) {
+	f, c := newFakeCloud(t)
+	f.verify = true
+	err := c.Login(context.Background(), testEmail, testPassword)
+	assert.True(t, errors.Is(err, ErrVerificationRequired))
+	assert.True(t, f.codeSent)
+	assert.Equal(t, "", c.Token().AccessToken)
+
+	assert.Nil(t, c.LoginWithCode(context.Background(), testEmail, testCode))
+	assert.Equal(t, "access-1", c.Token().AccessToken)
+}
+
+func TestClient_RefreshExpired(t *testing.T) {
+	f, c := newFakeCloud(t)
+	c.SetToken(Token{
+		AccessToken:  "stale",
+		RefreshToken: "refresh-0",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+	})
+	uid, err := c.UserID(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "1234567890", uid)
+	assert.Equal(t, 1, f.refreshes)
+	assert.Equal(t, "Bearer access-1", f.lastAuth)
+	// Refresh responses keep the refresh token if not rotated
+	assert.Equal(t, "refresh-1", c.Token().RefreshToken)
+}
+
+func TestClient_RefreshTokenExpired(t *testing.T) {
+	_, c := newFakeCloud(t)
+	c.SetToken(Token{
+		AccessToken:      "stale",
+		RefreshToken:     "refresh-0",
+		ExpiresAt:        time.Now().Add(-time.Hour),
+		RefreshExpiresAt: time.Now().Add(-time.Minute),
+	})
+	_, err := c.UserID(context.Background())
+	assert.True(t, errors.Is(err, ErrTokenExpired))
+}
+
+func TestClient_MQTTCredentials(t *testing.T) {
+	_, c := newFakeCloud(t)
+	_, _, err := c.MQTTCredentials(context.Background())
+	assert.True(t, errors.Is(err, ErrNotLoggedIn))
+
+	assert.Nil(t, c.Login(context.Background(), testEmail, testPassword))
+	username, password, err := c.MQTTCredentials(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "u_1234567890", username)
+	assert.Equal(t, "access-1", password)
+}
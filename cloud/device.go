@@ -0,0 +1,75 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/evanofslack/bambulab-client/mqtt"
+)
+
+const bindPath = "/v1/iot-service/api/user/bind"
+
+// Device is a printer bound to the cloud account.
+type Device struct {
+	Serial         string  `json:"dev_id"`
+	Name           string  `json:"name"`
+	Online         bool    `json:"online"`
+	PrintStatus    string  `json:"print_status"`
+	Model          string  `json:"dev_model_name"`
+	ProductName    string  `json:"dev_product_name"`
+	AccessCode     string  `json:"dev_access_code"`
+	NozzleDiameter float64 `json:"nozzle_diameter"`
+	Structure      string  `json:"dev_structure"`
+}
+
+type bindResponse struct {
+	Message string   `json:"message"`
+	Devices []Device `json:"devices"`
+}
+
+// Devices returns the printers bound to the account, sorted by serial.
+func (c *Client) Devices(ctx context.Context) ([]Device, error) {
+	resp := bindResponse{}
+	if err := c.get(ctx, bindPath, &resp); err != nil {
+		return nil, fmt.Errorf("list devices: %w", err)
+	}
+	devices := resp.Devices
+	if devices == nil {
+		devices = []Device{}
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Serial < devices[j].Serial
+	})
+	return devices, nil
+}
+
+// MQTTClient creates a cloud mqtt client for the device using the current
+// token. The client must be recreated once the token is refreshed.
+func (c *Client) MQTTClient(ctx context.Context, d Device) (*mqtt.Client, error) {
+	if c.MQTTEndpoint == "" {
+		return nil, fmt.Errorf("%w %q", ErrUnknownRegion, c.Region)
+	}
+	username, password, err := c.MQTTCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return mqtt.NewCloudClient(c.MQTTEndpoint, d.Serial, username, password)
+}
+
+// MQTTClients creates a cloud mqtt client for every bound device, keyed by serial.
+func (c *Client) MQTTClients(ctx context.Context) (map[string]*mqtt.Client, error) {
+	devices, err := c.Devices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	clients := make(map[string]*mqtt.Client, len(devices))
+	for _, d := range devices {
+		client, err := c.MQTTClient(ctx, d)
+		if err != nil {
+			return nil, fmt.Errorf("create client for %s: %w", d.Serial, err)
+		}
+		clients[d.Serial] = client
+	}
+	return clients, nil
+}
@@ -0,0 +1,84 @@
+package cloud
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/evanofslack/bambulab-client/mqtt"
+	"github.com/stretchr/testify/assert"
+)
+
+const bindResponseBody = `{
+	"message": "success",
+	"code": null,
+	"error": null,
+	"devices": [
+		{
+			"dev_id": "01S00A000000002",
+			"name": "Office P1S",
+			"online": false,
+			"print_status": "IDLE",
+			"dev_model_name": "C12",
+			"dev_product_name": "P1S",
+			"dev_access_code": "87654321",
+			"nozzle_diameter": 0.4,
+			"dev_structure": "CoreXY"
+		},
+		{
+			"dev_id": "00M00A000000001",
+			"name": "Garage X1C",
+			"online": true,
+			"print_status": "ACTIVE",
+			"dev_model_name": "BL-P001",
+			"dev_product_name": "X1 Carbon",
+			"dev_access_code": "12345678",
+			"nozzle_diameter": 0.4,
+			"dev_structure": "CoreXY"
+		}
+	]
+}`
+
+func newDeviceHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(bindResponseBody))
+	}
+}
+
+func newDeviceCloud(t *testing.T) *Client {
+	f, c := newFakeCloud(t)
+	f.handlers[bindPath] = newDeviceHandler()
+	assert.Nil(t, c.Login(context.Background(), testEmail, testPassword))
+	return c
+}
+
+func TestClient_Devices(t *testing.T) {
+	c := newDeviceCloud(t)
+	devices, err := c.Devices(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, devices, 2)
+	assert.Equal(t, Device{
+		Serial:         "00M00A000000001",
+		Name:           "Garage X1C",
+		Online:         true,
+		PrintStatus:    "ACTIVE",
+		Model:          "BL-P001",
+		ProductName:    "X1 Carbon",
+		AccessCode:     "12345678",
+		NozzleDiameter: 0.4,
+		Structure:      "CoreXY",
+	}, devices[0])
+	assert.Equal(t, "01S00A000000002", devices[1].Serial)
+	assert.False(t, devices[1].Online)
+}
+
+func TestClient_MQTTClients(t *testing.T) {
+	c := newDeviceCloud(t)
+	clients, err := c.MQTTClients(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, clients, 2)
+	client := clients["01S00A000000002"]
+	assert.False(t, client.Local())
+	assert.Equal(t, mqtt.GlobalEndpoint, client.Host())
+	assert.Equal(t, "01S00A000000002", client.DeviceID())
+}
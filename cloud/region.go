@@ -0,0 +1,52 @@
+package cloud
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/evanofslack/bambulab-client/mqtt"
+)
+
+// Region is where a cloud account is registered. Accounts only exist in
+// one region, so the API and broker must both belong to it.
+type Region string
+
+const (
+	RegionGlobal Region = "global"
+	RegionChina  Region = "china"
+)
+
+// Endpoints are the API and broker of a region.
+type Endpoints struct {
+	API  string
+	MQTT string
+}
+
+var regions = map[Region]Endpoints{
+	RegionGlobal: {API: "https://api.bambulab.com", MQTT: mqtt.GlobalEndpoint},
+	RegionChina:  {API: "https://api.bambulab.cn", MQTT: mqtt.ChinaEndpoint},
+}
+
+// ErrUnknownRegion is returned by requests of a client in a region without
+// known endpoints, unless they were all set by options.
+var ErrUnknownRegion = errors.New("unknown region")
+
+// Endpoints returns the endpoints of the region, false if it is unknown.
+func (r Region) Endpoints() (Endpoints, bool) {
+	e, ok := regions[r]
+	return e, ok
+}
+
+// ParseRegion parses a region name, accepting the country codes used by
+// the broker hostnames as well.
+func ParseRegion(s string) (Region, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "global", "us":
+		return RegionGlobal, nil
+	case "china", "cn":
+		return RegionChina, nil
+	default:
+		return "", fmt.Errorf("unknown region %q", s)
+	}
+}
@@ -0,0 +1,74 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRegion(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected Region
+		err      bool
+	}{
+		{in: "", expected: RegionGlobal},
+		{in: "global", expected: RegionGlobal},
+		{in: "US", expected: RegionGlobal},
+		{in: "china", expected: RegionChina},
+		{in: "cn", expected: RegionChina},
+		{in: "eu", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			r, err := ParseRegion(tt.in)
+			assert.Equal(t, tt.err, err != nil)
+			assert.Equal(t, tt.expected, r)
+		})
+	}
+}
+
+func TestNew_Region(t *testing.T) {
+	c := New()
+	assert.Equal(t, RegionGlobal, c.Region)
+	assert.Equal(t, "https://api.bambulab.com", c.BaseURL)
+	assert.Equal(t, "us.mqtt.bambulab.com", c.MQTTEndpoint)
+
+	c = New(WithRegion(RegionChina))
+	assert.Equal(t, "https://api.bambulab.cn", c.BaseURL)
+	assert.Equal(t, "cn.mqtt.bambulab.com", c.MQTTEndpoint)
+
+	c = New(WithRegion(RegionChina), WithBaseURL("http://127.0.0.1:8080"))
+	assert.Equal(t, "http://127.0.0.1:8080", c.BaseURL)
+	assert.Equal(t, "cn.mqtt.bambulab.com", c.MQTTEndpoint)
+}
+
+func TestRegion_Endpoints(t *testing.T) {
+	e, ok := RegionChina.Endpoints()
+	assert.True(t, ok)
+	assert.Equal(t, "https://api.bambulab.cn", e.API)
+	_, ok = Region("chnia").Endpoints()
+	assert.False(t, ok)
+}
+
+func TestNew_UnknownRegion(t *testing.T) {
+	c := New(WithRegion("chnia"))
+	err := c.Login(context.Background(), testEmail, testPassword)
+	assert.True(t, errors.Is(err, ErrUnknownRegion))
+	_, err = c.MQTTClient(context.Background(), Device{Serial: "A"})
+	assert.True(t, errors.Is(err, ErrUnknownRegion))
+}
+
+func TestClient_MQTTClientRegion(t *testing.T) {
+	f, c := newFakeCloud(t)
+	c = New(WithRegion(RegionChina), WithBaseURL(c.BaseURL))
+	f.handlers[bindPath] = newDeviceHandler()
+	assert.Nil(t, c.Login(context.Background(), testEmail, testPassword))
+	clients, err := c.MQTTClients(context.Background())
+	assert.Nil(t, err)
+	for _, client := range clients {
+		assert.Equal(t, "cn.mqtt.bambulab.com", client.Host())
+	}
+}
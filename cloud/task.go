@@ -0,0 +1,240 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/store"
+)
+
+const (
+	tasksPath        = "/v1/user-service/my/tasks"
+	defaultTaskLimit = 20
+	// Bound paging so a misbehaving api can't loop forever
+	maxTaskPages = 100
+)
+
+var (
+	ErrTaskNotFound = errors.New("task not found")
+	ErrTooManyPages = errors.New("too many task pages")
+)
+
+// TaskStatus is the outcome of a task reported by the cloud.
+type TaskStatus int
+
+const (
+	TaskStatusRunning  TaskStatus = 1
+	TaskStatusFinished TaskStatus = 2
+	TaskStatusFailed   TaskStatus = 3
+)
+
+func (s TaskStatus) String() string {
+	switch s {
+	case TaskStatusRunning:
+		return "running"
+	case TaskStatusFinished:
+		return "finished"
+	case TaskStatusFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// AmsMapping is the filament used from an AMS slot during a task.
+type AmsMapping struct {
+	Ams                int    `json:"ams"`
+	SourceColor        string `json:"sourceColor"`
+	TargetColor        string `json:"targetColor"`
+	FilamentID         string `json:"filamentId"`
+	FilamentType       string `json:"filamentType"`
+	TargetFilamentType string `json:"targetFilamentType"`
+	// Weight in grams
+	Weight float64 `json:"weight"`
+}
+
+// Task is a print recorded in the cloud history.
+type Task struct {
+	ID          int64      `json:"id"`
+	DesignID    int64      `json:"designId"`
+	DesignTitle string     `json:"designTitle"`
+	Title       string     `json:"title"`
+	Cover       string     `json:"cover"`
+	Status      TaskStatus `json:"status"`
+	StartTime   time.Time  `json:"startTime"`
+	EndTime     time.Time  `json:"endTime"`
+	// Weight of filament used in grams
+	Weight float64 `json:"weight"`
+	// Length of filament used in millimeters
+	Length int `json:"length"`
+	// CostTime is the print duration in seconds
+	CostTime    int          `json:"costTime"`
+	PlateIndex  int          `json:"plateIndex"`
+	DeviceID    string       `json:"deviceId"`
+	DeviceName  string       `json:"deviceName"`
+	DeviceModel string       `json:"deviceModel"`
+	AmsMapping  []AmsMapping `json:"amsDetailMapping"`
+}
+
+// TaskID is the id the printer reports as task_id over mqtt.
+func (t Task) TaskID() string {
+	return strconv.FormatInt(t.ID, 10)
+}
+
+// Matches reports whether the task is the print with the task and subtask
+// ids reported over mqtt. Local prints report an id of 0 and never match.
+func (t Task) Matches(taskID, subtaskID string) bool {
+	id := t.TaskID()
+	if taskID != "" && taskID != "0" {
+		return taskID == id
+	}
+	return subtaskID != "" && subtaskID != "0" && subtaskID == id
+}
+
+// TaskQuery filters the task history. Zero values match everything.
+type TaskQuery struct {
+	Serial string
+	// From and To filter on the start time of the task
+	From time.Time
+	To   time.Time
+	// Offset and Limit select a page of the history, newest first
+	Offset int
+	Limit  int
+}
+
+func (q TaskQuery) match(t Task) bool {
+	if q.Serial != "" && t.DeviceID != q.Serial {
+		return false
+	}
+	if !q.From.IsZero() && t.StartTime.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !t.StartTime.Before(q.To) {
+		return false
+	}
+	return true
+}
+
+// TaskPage is one page of the task history.
+type TaskPage struct {
+	// Total is the number of tasks in the history, ignoring date filters
+	Total int
+	Tasks []Task
+	// NextOffset is the offset of the next page, valid if More is set
+	NextOffset int
+	More       bool
+	// oldest is the start time of the oldest task on the page before filtering
+	oldest time.Time
+}
+
+type tasksResponse struct {
+	Total int    `json:"total"`
+	Hits  []Task `json:"hits"`
+}
+
+// Tasks returns a page of the task history.
+func (c *Client) Tasks(ctx context.Context, q TaskQuery) (TaskPage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultTaskLimit
+	}
+	params := url.Values{}
+	params.Set("limit", strconv.Itoa(limit))
+	params.Set("offset", strconv.Itoa(q.Offset))
+	if q.Serial != "" {
+		params.Set("deviceId", q.Serial)
+	}
+	resp := tasksResponse{}
+	if err := c.get(ctx, tasksPath+"?"+params.Encode(), &resp); err != nil {
+		return TaskPage{}, fmt.Errorf("list tasks: %w", err)
+	}
+	page := TaskPage{
+		Total:      resp.Total,
+		Tasks:      []Task{},
+		NextOffset: q.Offset + len(resp.Hits),
+	}
+	page.More = len(resp.Hits) > 0 && page.NextOffset < resp.Total
+	for _, t := range resp.Hits {
+		if q.match(t) {
+			page.Tasks = append(page.Tasks, t)
+		}
+	}
+	if len(resp.Hits) > 0 {
+		page.oldest = resp.Hits[len(resp.Hits)-1].StartTime
+	}
+	return page, nil
+}
+
+// AllTasks pages through the task history returning every matching task,
+// newest first. Paging stops once tasks start before q.From. After 100
+// pages the tasks read so far are returned with ErrTooManyPages.
+func (c *Client) AllTasks(ctx context.Context, q TaskQuery) ([]Task, error) {
+	tasks := []Task{}
+	err := c.eachPage(ctx, q, func(page TaskPage) bool {
+		tasks = append(tasks, page.Tasks...)
+		return q.From.IsZero() || !page.oldest.Before(q.From)
+	})
+	if errors.Is(err, ErrTooManyPages) {
+		return tasks, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// Task finds the task reported by a printer over mqtt.
+func (c *Client) Task(ctx context.Context, serial, taskID, subtaskID string) (Task, error) {
+	var task Task
+	found := false
+	err := c.eachPage(ctx, TaskQuery{Serial: serial}, func(page TaskPage) bool {
+		for _, t := range page.Tasks {
+			if t.Matches(taskID, subtaskID) {
+				task, found = t, true
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return Task{}, err
+	}
+	if !found {
+		return Task{}, fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+	}
+	return task, nil
+}
+
+// eachPage calls fn with pages of the history until fn returns false or
+// there are no more pages. It fails with ErrTooManyPages if there are still
+// more after maxTaskPages.
+func (c *Client) eachPage(ctx context.Context, q TaskQuery, fn func(TaskPage) bool) error {
+	for i := 0; i < maxTaskPages; i++ {
+		page, err := c.Tasks(ctx, q)
+		if err != nil {
+			return err
+		}
+		if !fn(page) || !page.More {
+			return nil
+		}
+		q.Offset = page.NextOffset
+	}
+	return fmt.Errorf("%w: stopped after %d pages", ErrTooManyPages, maxTaskPages)
+}
+
+// MatchJob returns the task recorded for a job from the store.
+func MatchJob(tasks []Task, job store.Job) (Task, bool) {
+	for _, t := range tasks {
+		if job.Serial != "" && t.DeviceID != "" && t.DeviceID != job.Serial {
+			continue
+		}
+		if t.Matches(job.TaskID, job.SubtaskID) {
+			return t, true
+		}
+	}
+	return Task{}, false
+}
@@ -0,0 +1,178 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/store"
+	"github.com/stretchr/testify/assert"
+)
+
+var taskBase = time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+
+// newTaskCloud serves n tasks, newest first, one hour apart.
+func newTaskCloud(t *testing.T, n int) (*Client, *[]string) {
+	f, c := newFakeCloud(t)
+	tasks := []Task{}
+	for i := 0; i < n; i++ {
+		serial := "A"
+		if i%2 == 1 {
+			serial = "B"
+		}
+		start := taskBase.Add(-time.Duration(i) * time.Hour)
+		tasks = append(tasks, Task{
+			ID:          int64(1000 - i),
+			DesignTitle: "design " + strconv.Itoa(i),
+			Status:      TaskStatusFinished,
+			StartTime:   start,
+			EndTime:     start.Add(30 * time.Minute),
+			Weight:      12.5,
+			Length:      4200,
+			DeviceID:    serial,
+			AmsMapping:  []AmsMapping{{Ams: 0, FilamentType: "PLA", Weight: 12.5}},
+		})
+	}
+	queries := []string{}
+	f.handlers[tasksPath] = func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		q := r.URL.Query()
+		offset, _ := strconv.Atoi(q.Get("offset"))
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		matching := []Task{}
+		for _, t := range tasks {
+			if serial := q.Get("deviceId"); serial == "" || serial == t.DeviceID {
+				matching = append(matching, t)
+			}
+		}
+		hits := []Task{}
+		for i := offset; i < len(matching) && i < offset+limit; i++ {
+			hits = append(hits, matching[i])
+		}
+		writeJSON(w, map[string]any{"total": len(matching), "hits": hits})
+	}
+	assert.Nil(t, c.Login(context.Background(), testEmail, testPassword))
+	return c, &queries
+}
+
+func TestTask_Unmarshal(t *testing.T) {
+	body := `{
+		"id": 123456789,
+		"designId": 0,
+		"designTitle": "Benchy",
+		"title": "benchy.3mf",
+		"cover": "https://public-cdn.bblmw.com/cover.png",
+		"status": 2,
+		"startTime": "2024-08-01T10:00:00Z",
+		"endTime": "2024-08-01T10:45:00Z",
+		"weight": 11.82,
+		"length": 3960,
+		"costTime": 2700,
+		"plateIndex": 1,
+		"deviceId": "01S00A000000001",
+		"deviceName": "P1S",
+		"deviceModel": "P1S",
+		"amsDetailMapping": [{"ams": 2, "sourceColor": "FF0000FF", "targetColor": "FF0000FF", "filamentId": "GFA00", "filamentType": "PLA", "targetFilamentType": "", "weight": 11.82}]
+	}`
+	task := Task{}
+	assert.Nil(t, json.Unmarshal([]byte(body), &task))
+	assert.Equal(t, "123456789", task.TaskID())
+	assert.Equal(t, "Benchy", task.DesignTitle)
+	assert.Equal(t, "finished", task.Status.String())
+	assert.Equal(t, 45*time.Minute, task.EndTime.Sub(task.StartTime))
+	assert.Equal(t, 3960, task.Length)
+	assert.Equal(t, "GFA00", task.AmsMapping[0].FilamentID)
+}
+
+func TestTask_Matches(t *testing.T) {
+	task := Task{ID: 42}
+	tests := []struct {
+		name      string
+		taskID    string
+		subtaskID string
+		expected  bool
+	}{
+		{name: "task id", taskID: "42", subtaskID: "7", expected: true},
+		{name: "other task", taskID: "43", subtaskID: "42", expected: false},
+		{name: "subtask id", taskID: "0", subtaskID: "42", expected: true},
+		{name: "local print", taskID: "0", subtaskID: "0", expected: false},
+		{name: "empty", expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, task.Matches(tt.taskID, tt.subtaskID))
+		})
+	}
+}
+
+func TestClient_Tasks(t *testing.T) {
+	c, queries := newTaskCloud(t, 5)
+	page, err := c.Tasks(context.Background(), TaskQuery{Serial: "A", Limit: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, page.Total)
+	assert.Len(t, page.Tasks, 2)
+	assert.True(t, page.More)
+	assert.Equal(t, 2, page.NextOffset)
+	assert.Equal(t, "deviceId=A&limit=2&offset=0", (*queries)[0])
+
+	page, err = c.Tasks(context.Background(), TaskQuery{Serial: "A", Limit: 2, Offset: page.NextOffset})
+	assert.Nil(t, err)
+	assert.Len(t, page.Tasks, 1)
+	assert.False(t, page.More)
+}
+
+func TestClient_AllTasks(t *testing.T) {
+	c, queries := newTaskCloud(t, 50)
+	tasks, err := c.AllTasks(context.Background(), TaskQuery{})
+	assert.Nil(t, err)
+	assert.Len(t, tasks, 50)
+	assert.Len(t, *queries, 3)
+
+	// Date filters stop paging once tasks are too old
+	*queries = nil
+	tasks, err = c.AllTasks(context.Background(), TaskQuery{
+		From: taskBase.Add(-25 * time.Hour),
+		To:   taskBase.Add(-5 * time.Hour),
+	})
+	assert.Nil(t, err)
+	assert.Len(t, tasks, 20)
+	assert.Equal(t, taskBase.Add(-6*time.Hour), tasks[0].StartTime)
+	assert.Len(t, *queries, 2)
+}
+
+func TestClient_AllTasksTooManyPages(t *testing.T) {
+	c, queries := newTaskCloud(t, maxTaskPages+1)
+	tasks, err := c.AllTasks(context.Background(), TaskQuery{Limit: 1})
+	assert.True(t, errors.Is(err, ErrTooManyPages))
+	assert.Len(t, tasks, maxTaskPages)
+	assert.Len(t, *queries, maxTaskPages)
+}
+
+func TestClient_Task(t *testing.T) {
+	c, _ := newTaskCloud(t, 50)
+	task, err := c.Task(context.Background(), "B", "965", "0")
+	assert.Nil(t, err)
+	assert.Equal(t, "design 35", task.DesignTitle)
+
+	_, err = c.Task(context.Background(), "B", "1", "0")
+	assert.True(t, errors.Is(err, ErrTaskNotFound))
+}
+
+func TestMatchJob(t *testing.T) {
+	tasks := []Task{
+		{ID: 1, DeviceID: "A", Weight: 10},
+		{ID: 2, DeviceID: "B", Weight: 20},
+	}
+	task, ok := MatchJob(tasks, store.Job{Serial: "B", TaskID: "2"})
+	assert.True(t, ok)
+	assert.Equal(t, 20.0, task.Weight)
+
+	_, ok = MatchJob(tasks, store.Job{Serial: "A", TaskID: "2"})
+	assert.False(t, ok)
+	_, ok = MatchJob(tasks, store.Job{Serial: "A", TaskID: "0", SubtaskID: "0"})
+	assert.False(t, ok)
+}
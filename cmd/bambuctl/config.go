@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/evanofslack/bambulab-client/fleet"
+	"github.com/evanofslack/bambulab-client/mqtt"
+)
+
+const (
+	envConfig     = "BAMBU_CONFIG"
+	envPrinter    = "BAMBU_PRINTER"
+	envHost       = "BAMBU_HOST"
+	envSerial     = "BAMBU_SERIAL"
+	envAccessCode = "BAMBU_ACCESS_CODE"
+	envEndpoint   = "BAMBU_ENDPOINT"
+	envUsername   = "BAMBU_USERNAME"
+	envPassword   = "BAMBU_PASSWORD"
+)
+
+// File is the config file of named printers, e.g.
+//
+//	{
+//	  "default": "garage",
+//	  "printers": [
+//	    {"name": "garage", "serial": "01S00A000000000", "host": "192.168.1.50", "access_code": "12345678"}
+//	  ]
+//	}
+type File struct {
+	Default  string         `json:"default,omitempty"`
+	Printers []fleet.Config `json:"printers"`
+}
+
+// Printer returns the printer with the name or serial, or the default
+// printer if name is empty.
+func (f File) Printer(name string) (fleet.Config, bool) {
+	if name == "" {
+		name = f.Default
+	}
+	if name == "" && len(f.Printers) == 1 {
+		return f.Printers[0], true
+	}
+	for _, p := range f.Printers {
+		if p.Name == name || p.Serial == name {
+			return p, true
+		}
+	}
+	return fleet.Config{}, false
+}
+
+// defaultConfigPath is bambuctl/config.json in the user config directory.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "bambuctl", "config.json")
+}
+
+// loadFile reads the config file, a missing default config is not an error.
+func loadFile(path string) (File, error) {
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath()
+	}
+	f := File{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !explicit {
+			return f, nil
+		}
+		return f, err
+	}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return f, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// options are the connection flags shared by every command.
+type options struct {
+	config     string
+	printer    string
+	host       string
+	serial     string
+	accessCode string
+	endpoint   string
+	username   string
+	password   string
+}
+
+// register adds the connection flags to fs, defaulting to the environment.
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.config, "config", os.Getenv(envConfig), "config file of named printers")
+	fs.StringVar(&o.printer, "printer", os.Getenv(envPrinter), "name or serial of a printer in the config file")
+	fs.StringVar(&o.host, "host", os.Getenv(envHost), "printer ip for a local connection")
+	fs.StringVar(&o.serial, "serial", os.Getenv(envSerial), "printer serial")
+	fs.StringVar(&o.accessCode, "access-code", os.Getenv(envAccessCode), "printer access code for a local connection")
+	fs.StringVar(&o.endpoint, "endpoint", os.Getenv(envEndpoint), "cloud broker for a cloud connection")
+	fs.StringVar(&o.username, "username", os.Getenv(envUsername), "cloud broker username, u_<uid>")
+	fs.StringVar(&o.password, "password", os.Getenv(envPassword), "cloud broker password, the access token")
+}
+
+// resolve picks the printer from the config file and overrides it with any
+// flags or environment variables given.
+func (o *options) resolve() (fleet.Config, error) {
+	f, err := loadFile(o.config)
+	if err != nil {
+		return fleet.Config{}, err
+	}
+	cfg, ok := f.Printer(o.printer)
+	if !ok && o.printer != "" {
+		return cfg, fmt.Errorf("printer %q not in config", o.printer)
+	}
+	overrides := []struct {
+		dst *string
+		src string
+	}{
+		{&cfg.Host, o.host},
+		{&cfg.Serial, o.serial},
+		{&cfg.AccessCode, o.accessCode},
+		{&cfg.Endpoint, o.endpoint},
+		{&cfg.Username, o.username},
+		{&cfg.Password, o.password},
+	}
+	for _, ov := range overrides {
+		if ov.src != "" {
+			*ov.dst = ov.src
+		}
+	}
+	if cfg.Host == "" && cfg.Endpoint == "" && cfg.Username != "" {
+		cfg.Endpoint = mqtt.GlobalEndpoint
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// resolveAll returns every printer in the config file, or the printer
+// given by flags if the config file has none.
+func (o *options) resolveAll() ([]fleet.Config, error) {
+	f, err := loadFile(o.config)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Printers) == 0 || o.printer != "" || o.serial != "" {
+		cfg, err := o.resolve()
+		if err != nil {
+			return nil, err
+		}
+		return []fleet.Config{cfg}, nil
+	}
+	return f.Printers, nil
+}
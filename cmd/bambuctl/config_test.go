@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `{
+	"default": "garage",
+	"printers": [
+		{"name": "garage", "serial": "01S00A000000001", "host": "192.168.1.50", "access_code": "11111111"},
+		{"name": "office", "serial": "01S00A000000002", "username": "u_1", "password": "token"}
+	]
+}`
+
+func writeConfig(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	assert.Nil(t, os.WriteFile(path, []byte(testConfig), 0o600))
+	return path
+}
+
+func parseOptions(t *testing.T, args ...string) *options {
+	o := &options{}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	o.register(fs)
+	assert.Nil(t, fs.Parse(args))
+	return o
+}
+
+func TestOptions_Resolve(t *testing.T) {
+	path := writeConfig(t)
+	tests := []struct {
+		name     string
+		env      map[string]string
+		args     []string
+		serial   string
+		host     string
+		endpoint string
+		err      bool
+	}{
+		{
+			name:   "default printer",
+			args:   []string{"-config", path},
+			serial: "01S00A000000001",
+			host:   "192.168.1.50",
+		},
+		{
+			name:     "named cloud printer",
+			args:     []string{"-config", path, "-printer", "office"},
+			serial:   "01S00A000000002",
+			endpoint: "us.mqtt.bambulab.com",
+		},
+		{
+			name:   "flag overrides config",
+			args:   []string{"-config", path, "-host", "10.0.0.2"},
+			serial: "01S00A000000001",
+			host:   "10.0.0.2",
+		},
+		{
+			name:   "environment",
+			env:    map[string]string{envConfig: path, envPrinter: "01S00A000000002", envHost: "10.0.0.3"},
+			serial: "01S00A000000002",
+			host:   "10.0.0.3",
+		},
+		{
+			name: "unknown printer",
+			args: []string{"-config", path, "-printer", "basement"},
+			err:  true,
+		},
+		{
+			name: "flags only",
+			args: []string{"-config", filepath.Join(t.TempDir(), "none.json"), "-serial", "A", "-host", "10.0.0.4"},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := parseOptions(t, tt.args...).resolve()
+			if tt.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.serial, cfg.Serial)
+			assert.Equal(t, tt.host, cfg.Host)
+			assert.Equal(t, tt.endpoint, cfg.Endpoint)
+		})
+	}
+}
+
+func TestLoadFile_MissingDefault(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	cfg, err := parseOptions(t, "-serial", "A", "-host", "10.0.0.4").resolve()
+	assert.Nil(t, err)
+	assert.Equal(t, "A", cfg.Serial)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+	opt "github.com/moznion/go-optional"
+)
+
+const none = "-"
+
+// show formats a value, or a dash if it hasn't been reported.
+func show[T any](o opt.Option[T], format string) string {
+	if o.IsNone() {
+		return none
+	}
+	return fmt.Sprintf(format, o.Unwrap())
+}
+
+func onOff(o opt.Option[bool]) string {
+	if o.IsNone() {
+		return none
+	}
+	if o.Unwrap() {
+		return "on"
+	}
+	return "off"
+}
+
+// remaining formats minutes remaining like 1h05m.
+func remaining(o opt.Option[int]) string {
+	if o.IsNone() {
+		return none
+	}
+	d := time.Duration(o.Unwrap()) * time.Minute
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+func temperature(current opt.Option[float64], target opt.Option[int]) string {
+	s := show(current, "%.1f°C")
+	if target.IsSome() && target.Unwrap() > 0 {
+		s += fmt.Sprintf(" / %d°C", target.Unwrap())
+	}
+	return s
+}
+
+// printState writes a human readable summary of the state.
+func printState(w io.Writer, serial string, s monitor.State) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	row := func(name, format string, args ...any) {
+		fmt.Fprintf(tw, "%s\t%s\n", name, fmt.Sprintf(format, args...))
+	}
+	p := s.CurrentPrint
+
+	row("Printer", "%s", serial)
+	row("State", "%s", show(s.Gcode.State, "%s"))
+	row("Job", "%s (%s)", show(p.Subtask, "%s"), show(s.Gcode.File, "%s"))
+	row("Progress", "%s  layer %s/%s  remaining %s",
+		show(p.Percent, "%d%%"), show(p.LayerNumber, "%d"), show(p.LayerNumberTarget, "%d"), remaining(p.TimeRemaining))
+	row("Nozzle", "%s  (%s %s)",
+		temperature(s.Nozzle.Temperature, s.Nozzle.TemperatureTarget), show(s.Nozzle.Diameter, "%.1fmm"), show(s.Nozzle.Type, "%s"))
+	row("Bed", "%s", temperature(s.Bed.Temperature, s.Bed.TemperatureTarget))
+	row("Chamber", "%s", show(s.Chamber.Temperature, "%d°C"))
+	row("Fans", "part %s  aux %s  chamber %s  hotend %s",
+		show(s.Fans.Part, "%.0f%%"), show(s.Fans.Auxilliary, "%.0f%%"), show(s.Fans.Chamber, "%.0f%%"), show(s.Fans.Hotend, "%.0f%%"))
+	row("Speed", "%s", show(s.Speed.LevelName, "%s"))
+	row("Light", "%s", onOff(s.Lights.Chamber))
+	row("Camera", "recording %s  timelapse %s  %s",
+		onOff(s.Camera.Recording), onOff(s.Camera.Timelapse), show(s.Camera.Resolution, "%s"))
+	row("Wifi", "%s", show(s.Wifi, "%.0f dBm"))
+	for _, unit := range s.Ams.Units {
+		trays := []string{}
+		for _, tray := range unit.Trays {
+			trays = append(trays, fmt.Sprintf("%s %s #%s %s",
+				show(tray.ID, "%s"), show(tray.Name, "%s"), show(tray.Color, "%s"), show(tray.Remaining, "%d%%")))
+		}
+		row("AMS "+show(unit.ID, "%s"), "%s  humidity %s", strings.Join(trays, ", "), show(unit.Humidity, "%.0f"))
+	}
+	if len(s.Hms) > 0 {
+		codes := make([]string, 0, len(s.Hms))
+		for _, h := range s.Hms {
+			codes = append(codes, h.ErrorCode())
+		}
+		row("HMS", "%s", strings.Join(codes, " "))
+	}
+	return tw.Flush()
+}
+
+// printEvent writes a line describing a lifecycle event.
+func printEvent(w io.Writer, serial string, e monitor.Event) {
+	fmt.Fprintf(w, "%s %s %s %s\n", e.Time.Format(time.TimeOnly), serial, e.Type, show(e.State.CurrentPrint.Subtask, "%s"))
+}
@@ -0,0 +1,356 @@
+// Command bambuctl monitors and controls Bambu Lab printers.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/mqtt"
+	"github.com/evanofslack/bambulab-client/printer"
+	"github.com/evanofslack/bambulab-client/record"
+)
+
+const (
+	defaultTimeout = 15 * time.Second
+	watchEvents    = 10
+	clearScreen    = "\033[H\033[2J"
+)
+
+var errUsage = errors.New("usage")
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, c *cli, args []string) error
+}
+
+var commands = map[string]command{
+	"status":  {"print the state of the printer", runStatus},
+	"watch":   {"show the state of the printer as it changes", runWatch},
+	"pause":   {"pause the current print", publishCommand((*printer.Printer).Pause)},
+	"resume":  {"resume the paused print", publishCommand((*printer.Printer).Resume)},
+	"stop":    {"cancel the current print", publishCommand((*printer.Printer).Stop)},
+	"pushall": {"request a full report from the printer", publishCommand((*printer.Printer).PushAll)},
+	"light":   {"switch a light: light [-node chamber_light] on|off", runLight},
+	"speed":   {"set the print speed: speed silent|standard|sport|ludicrous", runSpeed},
+	"raw":     {"dump every report as json", runRaw},
+	"record":  {"record reports to a file: record -o reports.jsonl", runRecord},
+	"top":     {"dashboard of every printer in the config file", runTop},
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	cancel()
+	os.Exit(code)
+}
+
+// run runs the command in args, connecting clients with opts. Client logs
+// go to stderr to keep stdout clear for command output.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer, opts ...mqtt.ClientOption) int {
+	opts = append([]mqtt.ClientOption{mqtt.WithLogOutput(stderr)}, opts...)
+	c := &cli{stdout: stdout, stderr: stderr, clientOptions: opts}
+	if len(args) == 0 {
+		c.usage()
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+		c.usage()
+		return 2
+	}
+	c.name = args[0]
+	if err := cmd.run(ctx, c, args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) || errors.Is(err, errUsage) {
+			return 2
+		}
+		fmt.Fprintf(stderr, "bambuctl %s: %s\n", c.name, err)
+		return 1
+	}
+	return 0
+}
+
+type cli struct {
+	name          string
+	stdout        io.Writer
+	stderr        io.Writer
+	options       options
+	clientOptions []mqtt.ClientOption
+	timeout       time.Duration
+}
+
+func (c *cli) usage() {
+	fmt.Fprintln(c.stderr, "usage: bambuctl <command> [flags]")
+	fmt.Fprintln(c.stderr, "\ncommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(c.stderr, "  %-8s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintln(c.stderr, "\nrun bambuctl <command> -h for flags")
+}
+
+// flagSet creates the flags of a command, including the connection flags.
+func (c *cli) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("bambuctl "+c.name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	c.options.register(fs)
+	fs.DurationVar(&c.timeout, "timeout", defaultTimeout, "how long to wait for the printer")
+	return fs
+}
+
+// connect runs a printer in the background until the returned stop func is
+// called, returning once its first report has been received.
+func (c *cli) connect(ctx context.Context, hook func(*mqtt.Client)) (*printer.Printer, func(), error) {
+	cfg, err := c.options.resolve()
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := cfg.NewClient(c.clientOptions...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if hook != nil {
+		hook(client)
+	}
+	p := printer.New(client)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Run(runCtx)
+	}()
+	waitCtx, waitCancel := context.WithTimeout(ctx, c.timeout)
+	defer waitCancel()
+	select {
+	case err := <-done:
+		cancel()
+		if err == nil {
+			err = ctx.Err()
+		}
+		return nil, nil, err
+	case <-waitCtx.Done():
+		cancel()
+		<-done
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return nil, nil, fmt.Errorf("no report from %s within %s", cfg.Serial, c.timeout)
+	case <-p.Ready():
+	}
+	stop := func() {
+		cancel()
+		<-done
+	}
+	return p, stop, nil
+}
+
+func runStatus(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet()
+	asJSON := fs.Bool("json", false, "print the state as json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p, stop, err := c.connect(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	if *asJSON {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p.State())
+	}
+	return printState(c.stdout, p.Serial(), p.State())
+}
+
+func runWatch(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p, stop, err := c.connect(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	events := p.Subscribe(64)
+
+	history := []monitor.Event{}
+	draw := func(s monitor.State) {
+		fmt.Fprint(c.stdout, clearScreen)
+		printState(c.stdout, p.Serial(), s)
+		if len(history) > 0 {
+			fmt.Fprintln(c.stdout, "\nEvents")
+			for _, e := range history {
+				printEvent(c.stdout, p.Serial(), e)
+			}
+		}
+	}
+	draw(p.State())
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if e.Type != monitor.EventUpdate {
+				history = append(history, e)
+				if len(history) > watchEvents {
+					history = history[1:]
+				}
+			}
+			draw(e.State)
+		}
+	}
+}
+
+// publishCommand runs a command taking no arguments.
+func publishCommand(publish func(*printer.Printer, context.Context) error) func(context.Context, *cli, []string) error {
+	return func(ctx context.Context, c *cli, args []string) error {
+		fs := c.flagSet()
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		return c.publish(ctx, func(ctx context.Context, p *printer.Printer) error {
+			return publish(p, ctx)
+		})
+	}
+}
+
+// publish connects to the printer and sends a command.
+func (c *cli) publish(ctx context.Context, send func(context.Context, *printer.Printer) error) error {
+	p, stop, err := c.connect(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	if err := send(ctx, p); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "sent %s to %s\n", c.name, p.Serial())
+	return nil
+}
+
+func runLight(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet()
+	node := fs.String("node", mqtt.LightChamber, "light to switch")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	on, err := parseOnOff(fs.Arg(0))
+	if err != nil || fs.NArg() != 1 {
+		fmt.Fprintln(c.stderr, "usage: bambuctl light [-node chamber_light] on|off")
+		return errUsage
+	}
+	return c.publish(ctx, func(ctx context.Context, p *printer.Printer) error {
+		return p.SetLight(ctx, *node, on)
+	})
+}
+
+func runSpeed(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	level, err := parseSpeed(fs.Arg(0))
+	if err != nil || fs.NArg() != 1 {
+		fmt.Fprintln(c.stderr, "usage: bambuctl speed silent|standard|sport|ludicrous")
+		return errUsage
+	}
+	return c.publish(ctx, func(ctx context.Context, p *printer.Printer) error {
+		return p.SetSpeed(ctx, level)
+	})
+}
+
+func runRaw(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var mu sync.Mutex
+	_, stop, err := c.connect(ctx, func(client *mqtt.Client) {
+		client.OnReport(func(_ string, payload []byte) {
+			mu.Lock()
+			defer mu.Unlock()
+			c.stdout.Write(append(payload, '\n'))
+		})
+	})
+	if err != nil {
+		return err
+	}
+	defer stop()
+	<-ctx.Done()
+	return nil
+}
+
+func runRecord(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet()
+	out := fs.String("o", "", "file to append reports to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		fmt.Fprintln(c.stderr, "usage: bambuctl record -o reports.jsonl")
+		return errUsage
+	}
+	r, err := record.Create(*out)
+	if err != nil {
+		return err
+	}
+	_, stop, err := c.connect(ctx, r.Attach)
+	if err != nil {
+		r.Close()
+		return err
+	}
+	fmt.Fprintf(c.stderr, "recording to %s, interrupt to stop\n", *out)
+	<-ctx.Done()
+	stop()
+	return r.Close()
+}
+
+func parseOnOff(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "on", "true", "1":
+		return true, nil
+	case "off", "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected on or off, got %q", s)
+}
+
+func parseSpeed(s string) (mqtt.SpeedLevel, error) {
+	levels := map[string]mqtt.SpeedLevel{
+		"silent":    mqtt.SpeedSilent,
+		"standard":  mqtt.SpeedStandard,
+		"sport":     mqtt.SpeedSport,
+		"ludicrous": mqtt.SpeedLudicrous,
+	}
+	if level, ok := levels[strings.ToLower(s)]; ok {
+		return level, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < int(mqtt.SpeedSilent) || n > int(mqtt.SpeedLudicrous) {
+		return 0, fmt.Errorf("unknown speed %q", s)
+	}
+	return mqtt.SpeedLevel(n), nil
+}
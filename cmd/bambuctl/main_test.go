@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/mqtt"
+	"github.com/evanofslack/bambulab-client/printertest"
+	"github.com/evanofslack/bambulab-client/record"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer starts a fake printer, returning the flags to connect to it.
+// Commands must be run with runTestServer to connect to it.
+func newTestServer(t *testing.T) (*printertest.Server, []string) {
+	s, err := printertest.NewServer()
+	assert.Nil(t, err)
+	t.Cleanup(s.Close)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	flags := []string{"-host", "127.0.0.1", "-serial", s.Serial, "-access-code", s.AccessCode, "-timeout", "5s"}
+	return s, flags
+}
+
+func runTest(ctx context.Context, args ...string) (int, string, string) {
+	return runTestServer(ctx, nil, args...)
+}
+
+// runTestServer runs a command connecting to the fake printer s.
+func runTestServer(ctx context.Context, s *printertest.Server, args ...string) (int, string, string) {
+	var opts []mqtt.ClientOption
+	if s != nil {
+		opts = s.ClientOptions()
+	}
+	stdout, stderr := &bytes.Buffer{}, &syncBuffer{}
+	code := run(ctx, args, stdout, stderr, opts...)
+	return code, stdout.String(), stderr.String()
+}
+
+// syncBuffer is written by client callbacks while the command runs.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRun_Status(t *testing.T) {
+	s, flags := newTestServer(t)
+	report := printertest.DefaultReport()
+	report["gcode_state"] = "RUNNING"
+	report["subtask_name"] = "cube"
+	report["mc_remaining_time"] = 65
+	s.SetReport(report)
+
+	code, out, stderr := runTestServer(context.Background(), s, append([]string{"status"}, flags...)...)
+	assert.Equal(t, 0, code)
+	// Client logs go to stderr
+	assert.Contains(t, stderr, "mqtt client connected")
+	assert.NotContains(t, out, "mqtt client")
+	assert.Contains(t, out, "RUNNING")
+	assert.Contains(t, out, "cube")
+	assert.Contains(t, out, "1h05m")
+
+	code, out, _ = runTestServer(context.Background(), s, append([]string{"status", "-json"}, flags...)...)
+	assert.Equal(t, 0, code)
+	var state map[string]any
+	assert.Nil(t, json.Unmarshal([]byte(out), &state))
+	assert.Equal(t, "RUNNING", state["Gcode"].(map[string]any)["State"])
+}
+
+func TestRun_Commands(t *testing.T) {
+	s, flags := newTestServer(t)
+	tests := []struct {
+		args    []string
+		command string
+		field   string
+		value   any
+	}{
+		{args: []string{"pause"}, command: "pause"},
+		{args: []string{"light", "on"}, command: "ledctrl", field: "led_mode", value: "on"},
+		{args: []string{"speed", "sport"}, command: "print_speed", field: "param", value: "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			args := append([]string{tt.args[0]}, flags...)
+			args = append(args, tt.args[1:]...)
+			code, _, stderr := runTestServer(context.Background(), s, args...)
+			assert.Equal(t, 0, code, stderr)
+			cmd, err := s.WaitCommand(context.Background(), tt.command)
+			assert.Nil(t, err)
+			if tt.field != "" {
+				assert.Equal(t, tt.value, cmd.Fields[tt.field])
+			}
+		})
+	}
+}
+
+func TestRun_Record(t *testing.T) {
+	s, flags := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "reports.jsonl")
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	code, _, stderr := runTestServer(ctx, s, append([]string{"record", "-o", path}, flags...)...)
+	assert.Equal(t, 0, code, stderr)
+
+	entries, err := record.ReadFile(path)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, entries)
+}
+
+func TestRun_Usage(t *testing.T) {
+	code, _, stderr := runTest(context.Background())
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "commands:")
+
+	code, _, _ = runTest(context.Background(), "explode")
+	assert.Equal(t, 2, code)
+
+	s, flags := newTestServer(t)
+	code, _, _ = runTestServer(context.Background(), s, append([]string{"speed"}, append(flags, "warp")...)...)
+	assert.Equal(t, 2, code)
+}
+
+func TestParseSpeed(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected mqtt.SpeedLevel
+		err      bool
+	}{
+		{in: "silent", expected: mqtt.SpeedSilent},
+		{in: "Ludicrous", expected: mqtt.SpeedLudicrous},
+		{in: "2", expected: mqtt.SpeedStandard},
+		{in: "5", err: true},
+		{in: "fast", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			level, err := parseSpeed(tt.in)
+			assert.Equal(t, tt.err, err != nil)
+			assert.Equal(t, tt.expected, level)
+		})
+	}
+}
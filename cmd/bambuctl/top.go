@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/fleet"
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/mqtt"
+	"golang.org/x/term"
+)
+
+const (
+	topRefresh   = time.Second
+	progressBar  = 20
+	altScreen    = "\033[?1049h\033[?25l"
+	normalScreen = "\033[?25h\033[?1049l"
+	moveHome     = "\033[H\033[2J"
+	inverse      = "\033[7m"
+	reset        = "\033[0m"
+	topHelp      = "j/k select  p pause  r resume  q quit"
+	topEvents    = 16
+)
+
+type key int
+
+const (
+	keyNone key = iota
+	keyUp
+	keyDown
+	keyPause
+	keyResume
+	keyQuit
+)
+
+// topRow is one printer in the dashboard.
+type topRow struct {
+	name  string
+	state monitor.State
+}
+
+func runTop(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	configs, err := c.options.resolveAll()
+	if err != nil {
+		return err
+	}
+	clientOptions := c.clientOptions
+	keys := make(chan key, 8)
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		old, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, old)
+		// Client logs would scroll the screen
+		clientOptions = append(clientOptions, mqtt.WithLogOutput(io.Discard))
+		go readKeys(os.Stdin, keys)
+	}
+
+	f := fleet.New()
+	defer f.Close()
+	events := f.Subscribe(topEvents)
+	for _, cfg := range configs {
+		if err := f.Add(cfg, fleet.WithClientOptions(clientOptions...)); err != nil {
+			return err
+		}
+	}
+	fmt.Fprint(c.stdout, altScreen)
+	defer fmt.Fprint(c.stdout, normalScreen)
+
+	ticker := time.NewTicker(topRefresh)
+	defer ticker.Stop()
+	selected, status := 0, ""
+	for {
+		rows := topRows(f)
+		if selected >= len(rows) {
+			selected = len(rows) - 1
+		}
+		fmt.Fprint(c.stdout, moveHome)
+		renderTop(c.stdout, rows, selected, status)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-events:
+		case k := <-keys:
+			switch k {
+			case keyQuit:
+				return nil
+			case keyUp:
+				if selected > 0 {
+					selected--
+				}
+			case keyDown:
+				if selected < len(rows)-1 {
+					selected++
+				}
+			case keyPause, keyResume:
+				status = sendTopCommand(ctx, f, selected, k)
+			}
+		}
+	}
+}
+
+func topRows(f *fleet.Fleet) []topRow {
+	states := f.States()
+	rows := []topRow{}
+	for _, cfg := range f.Printers() {
+		name := cfg.Name
+		if name == "" {
+			name = cfg.Serial
+		}
+		rows = append(rows, topRow{name: name, state: states[cfg.Serial]})
+	}
+	return rows
+}
+
+// sendTopCommand pauses or resumes the selected printer, returning a
+// status line to show.
+func sendTopCommand(ctx context.Context, f *fleet.Fleet, selected int, k key) string {
+	printers := f.Printers()
+	if selected < 0 || selected >= len(printers) {
+		return ""
+	}
+	serial := printers[selected].Serial
+	client, ok := f.Client(serial)
+	if !ok {
+		return fmt.Sprintf("%s not in fleet", serial)
+	}
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+	name, publish := "pause", client.PublishPause
+	if k == keyResume {
+		name, publish = "resume", client.PublishResume
+	}
+	if err := publish(ctx); err != nil {
+		return fmt.Sprintf("%s %s failed: %s", name, serial, err)
+	}
+	return fmt.Sprintf("sent %s to %s", name, serial)
+}
+
+// readKeys sends key presses read from r until it fails.
+func readKeys(r io.Reader, keys chan<- key) {
+	buf := make([]byte, 16)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, k := range parseKeys(buf[:n]) {
+			keys <- k
+		}
+	}
+}
+
+// parseKeys decodes key presses, including arrow key escape sequences.
+func parseKeys(b []byte) []key {
+	keys := []key{}
+	for i := 0; i < len(b); i++ {
+		k := keyNone
+		switch b[i] {
+		case 'q', 'Q', 3: // ctrl-c
+			k = keyQuit
+		case 'k', 'K':
+			k = keyUp
+		case 'j', 'J':
+			k = keyDown
+		case 'p', 'P':
+			k = keyPause
+		case 'r', 'R':
+			k = keyResume
+		case 0x1b:
+			if i+2 < len(b) && b[i+1] == '[' {
+				switch b[i+2] {
+				case 'A':
+					k = keyUp
+				case 'B':
+					k = keyDown
+				}
+				i += 2
+			}
+		}
+		if k != keyNone {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// renderTop draws the dashboard. Lines end in \r\n as the terminal is raw.
+func renderTop(w io.Writer, rows []topRow, selected int, status string) {
+	fmt.Fprintf(w, "bambuctl top  %d printers  %s\r\n\r\n", len(rows), time.Now().Format(time.TimeOnly))
+	fmt.Fprintf(w, "%-16s %-8s %-20s %-27s %-7s %-16s %-8s %s\r\n",
+		"PRINTER", "STATE", "JOB", "PROGRESS", "LEFT", "NOZZLE", "BED", "AMS")
+	for i, r := range rows {
+		s := r.state
+		line := fmt.Sprintf("%-16s %-8s %-20s %-27s %-7s %-16s %-8s ",
+			truncate(r.name, 16),
+			truncate(show(s.Gcode.State, "%s"), 8),
+			truncate(show(s.CurrentPrint.Subtask, "%s"), 20),
+			progress(s.CurrentPrint.Percent.TakeOr(0), s.CurrentPrint.Percent.IsSome()),
+			remaining(s.CurrentPrint.TimeRemaining),
+			truncate(temperature(s.Nozzle.Temperature, s.Nozzle.TemperatureTarget), 16),
+			truncate(show(s.Bed.Temperature, "%.0f°C"), 8))
+		if i == selected {
+			line = inverse + line + reset
+		}
+		fmt.Fprintf(w, "%s%s\r\n", line, trays(s.Ams))
+		for _, h := range s.Hms {
+			fmt.Fprintf(w, "  HMS %s\r\n", h.ErrorCode())
+		}
+	}
+	fmt.Fprintf(w, "\r\n%s\r\n", topHelp)
+	if status != "" {
+		fmt.Fprintf(w, "%s\r\n", status)
+	}
+}
+
+// progress draws a bar like [#####.....] 50%
+func progress(percent int, known bool) string {
+	if !known {
+		return none
+	}
+	percent = max(0, min(100, percent))
+	filled := percent * progressBar / 100
+	return fmt.Sprintf("[%s%s] %3d%%",
+		strings.Repeat("#", filled), strings.Repeat(".", progressBar-filled), percent)
+}
+
+// trays draws a colored block for every loaded AMS tray.
+func trays(ams monitor.Ams) string {
+	var b strings.Builder
+	for _, unit := range ams.Units {
+		for _, tray := range unit.Trays {
+			r, g, bl, ok := trayColor(tray.Color.TakeOr(""))
+			if !ok {
+				b.WriteString("· ")
+				continue
+			}
+			fmt.Fprintf(&b, "\033[38;2;%d;%d;%dm■%s ", r, g, bl, reset)
+		}
+	}
+	return b.String()
+}
+
+// trayColor parses colors reported as RRGGBBAA hex.
+func trayColor(s string) (r, g, b uint8, ok bool) {
+	if len(s) < 6 {
+		return 0, 0, 0, false
+	}
+	v, err := strconv.ParseUint(s[:6], 16, 32)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	return uint8(v >> 16), uint8(v >> 8), uint8(v), true
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+	opt "github.com/moznion/go-optional"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		expected []key
+	}{
+		{name: "letters", in: "jkpr", expected: []key{keyDown, keyUp, keyPause, keyResume}},
+		{name: "arrows", in: "\x1b[A\x1b[B", expected: []key{keyUp, keyDown}},
+		{name: "ctrl-c", in: "\x03", expected: []key{keyQuit}},
+		{name: "ignored", in: "x\x1b[C", expected: []key{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, parseKeys([]byte(tt.in)))
+		})
+	}
+}
+
+func TestProgress(t *testing.T) {
+	assert.Equal(t, "[##########..........]  50%", progress(50, true))
+	assert.Equal(t, "[####################] 100%", progress(120, true))
+	assert.Equal(t, none, progress(0, false))
+}
+
+func TestTrayColor(t *testing.T) {
+	r, g, b, ok := trayColor("FF8000FF")
+	assert.True(t, ok)
+	assert.Equal(t, []uint8{255, 128, 0}, []uint8{r, g, b})
+	_, _, _, ok = trayColor("")
+	assert.False(t, ok)
+}
+
+func TestRenderTop(t *testing.T) {
+	rows := []topRow{
+		{
+			name: "garage",
+			state: monitor.State{
+				Gcode: monitor.Gcode{State: opt.Some("RUNNING")},
+				CurrentPrint: monitor.CurrentPrint{
+					Subtask:       opt.Some("benchy"),
+					Percent:       opt.Some(25),
+					TimeRemaining: opt.Some(90),
+				},
+				Nozzle: monitor.Nozzle{Temperature: opt.Some(219.6), TemperatureTarget: opt.Some(220)},
+				Ams: monitor.Ams{Units: []monitor.AmsUnit{{
+					Trays: []monitor.AmsTray{{Color: opt.Some("FF0000FF")}, {}},
+				}}},
+				Hms: []monitor.Hms{{Attr: 50331904, Code: 65543}},
+			},
+		},
+		{name: "office"},
+	}
+	buf := &bytes.Buffer{}
+	renderTop(buf, rows, 1, "sent pause to office")
+	out := buf.String()
+	lines := strings.Split(out, "\r\n")
+
+	garage := lines[3]
+	assert.Contains(t, garage, "RUNNING")
+	assert.Contains(t, garage, "benchy")
+	assert.Contains(t, garage, "[#####...............]  25%")
+	assert.Contains(t, garage, "1h30m")
+	assert.Contains(t, garage, "219.6°C / 220°C")
+	assert.Contains(t, garage, "\033[38;2;255;0;0m■")
+	assert.Contains(t, lines[4], "HMS 0300_0100_0001_0007")
+	// The selected printer is highlighted
+	assert.True(t, strings.HasPrefix(lines[5], inverse+"office"))
+	assert.Contains(t, out, "sent pause to office")
+}
+
+func TestRun_Top(t *testing.T) {
+	s, flags := newTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	code, out, stderr := runTestServer(ctx, s, append([]string{"top"}, flags...)...)
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, out, altScreen)
+	assert.Contains(t, out, s.Serial)
+	assert.Contains(t, out, "IDLE")
+	assert.True(t, strings.HasSuffix(out, normalScreen))
+}
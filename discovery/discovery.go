@@ -0,0 +1,220 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/mqtt"
+	opt "github.com/moznion/go-optional"
+)
+
+const (
+	// DefaultPort is the port printers announce themselves on
+	DefaultPort           = 2021
+	defaultListenAddr     = ":2021"
+	defaultSearchAddr     = "255.255.255.255:2021"
+	defaultSearchInterval = 5 * time.Second
+	searchTarget          = "urn:bambulab-com:device:3dprinter:1"
+	maxPacketSize         = 4096
+)
+
+var ErrNotPrinter = errors.New("not a bambulab printer announcement")
+
+// DiscoveredPrinter is a printer found on the local network.
+type DiscoveredPrinter struct {
+	IP         string
+	Serial     string
+	Name       string
+	Model      string
+	Signal     opt.Option[int]
+	Connect    string
+	Bind       string
+	SecureLink string
+	Version    string
+	LastSeen   time.Time
+}
+
+// Client creates a client connecting to the printer over the local network.
+func (p DiscoveredPrinter) Client(accessCode string) (*mqtt.Client, error) {
+	return mqtt.NewLocalClient(p.IP, p.Serial, accessCode)
+}
+
+// Parse decodes an SSDP announcement sent by a printer. The address the
+// packet came from is used as the printer IP when it doesn't include one.
+func Parse(data []byte, from net.Addr) (DiscoveredPrinter, error) {
+	p := DiscoveredPrinter{}
+	r := bufio.NewReader(bytes.NewReader(data))
+	line, err := r.ReadString('\n')
+	if err != nil && line == "" {
+		return p, ErrNotPrinter
+	}
+	start := strings.ToUpper(strings.TrimSpace(line))
+	if !strings.HasPrefix(start, "NOTIFY") && !strings.HasPrefix(start, "HTTP/1.1 200") {
+		return p, ErrNotPrinter
+	}
+
+	headers := http.Header{}
+	for {
+		line, err := r.ReadString('\n')
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	nt := headers.Get("NT")
+	if nt == "" {
+		nt = headers.Get("ST")
+	}
+	if nt != searchTarget {
+		return p, ErrNotPrinter
+	}
+	p.Serial = headers.Get("USN")
+	if p.Serial == "" {
+		return p, fmt.Errorf("%w: missing USN", ErrNotPrinter)
+	}
+	p.IP = headers.Get("Location")
+	if p.IP == "" {
+		if udp, ok := from.(*net.UDPAddr); ok {
+			p.IP = udp.IP.String()
+		}
+	}
+	p.Name = headers.Get("DevName.bambu.com")
+	p.Model = headers.Get("DevModel.bambu.com")
+	p.Connect = headers.Get("DevConnect.bambu.com")
+	p.Bind = headers.Get("DevBind.bambu.com")
+	p.SecureLink = headers.Get("Devseclink.bambu.com")
+	p.Version = headers.Get("DevVersion.bambu.com")
+	if signal, err := strconv.Atoi(headers.Get("DevSignal.bambu.com")); err == nil {
+		p.Signal = opt.Some(signal)
+	}
+	p.LastSeen = time.Now()
+	return p, nil
+}
+
+// Discoverer listens for printer announcements and periodically searches
+// for printers by broadcasting to SearchAddr.
+type Discoverer struct {
+	ListenAddr     string
+	SearchAddr     string
+	SearchInterval time.Duration
+}
+
+// New creates a discoverer using the default port and broadcast address
+func New() *Discoverer {
+	d := &Discoverer{
+		ListenAddr:     defaultListenAddr,
+		SearchAddr:     defaultSearchAddr,
+		SearchInterval: defaultSearchInterval,
+	}
+	return d
+}
+
+// Listen sends every printer announcement received to found until ctx is done.
+// Searches are sent every SearchInterval, an empty SearchAddr only listens.
+func (d *Discoverer) Listen(ctx context.Context, found chan<- DiscoveredPrinter) error {
+	conn, err := net.ListenPacket("udp4", d.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("listen for printers: %w", err)
+	}
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	if d.SearchAddr != "" {
+		go d.search(ctx, conn)
+	}
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		p, err := Parse(buf[:n], from)
+		if err != nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case found <- p:
+		}
+	}
+}
+
+// Discover collects printers until ctx is done and returns them ordered by
+// serial, with the latest announcement from each printer.
+func (d *Discoverer) Discover(ctx context.Context) ([]DiscoveredPrinter, error) {
+	found := make(chan DiscoveredPrinter)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- d.Listen(ctx, found)
+	}()
+
+	bySerial := map[string]DiscoveredPrinter{}
+	for {
+		select {
+		case p := <-found:
+			bySerial[p.Serial] = p
+		case err := <-errc:
+			printers := make([]DiscoveredPrinter, 0, len(bySerial))
+			for _, p := range bySerial {
+				printers = append(printers, p)
+			}
+			sort.Slice(printers, func(i, j int) bool {
+				return printers[i].Serial < printers[j].Serial
+			})
+			return printers, err
+		}
+	}
+}
+
+func (d *Discoverer) search(ctx context.Context, conn net.PacketConn) {
+	addr, err := net.ResolveUDPAddr("udp4", d.SearchAddr)
+	if err != nil {
+		fmt.Printf("fail resolve search addr, err=%s\n", err)
+		return
+	}
+	interval := d.SearchInterval
+	if interval <= 0 {
+		interval = defaultSearchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := conn.WriteTo(searchRequest(d.SearchAddr), addr); err != nil && ctx.Err() == nil {
+			fmt.Printf("fail send search, err=%s\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func searchRequest(host string) []byte {
+	return []byte("M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + host + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 1\r\n" +
+		"ST: " + searchTarget + "\r\n" +
+		"\r\n")
+}
@@ -0,0 +1,105 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const notify = "NOTIFY * HTTP/1.1\r\n" +
+	"HOST: 239.255.255.250:1990\r\n" +
+	"Server: UPnP/1.0\r\n" +
+	"Location: 192.168.1.50\r\n" +
+	"NT: urn:bambulab-com:device:3dprinter:1\r\n" +
+	"USN: 01S00A000000000\r\n" +
+	"Cache-Control: max-age=1800\r\n" +
+	"DevModel.bambu.com: C11\r\n" +
+	"DevName.bambu.com: Workshop P1P\r\n" +
+	"DevSignal.bambu.com: -44\r\n" +
+	"DevConnect.bambu.com: lan\r\n" +
+	"DevBind.bambu.com: free\r\n" +
+	"Devseclink.bambu.com: secure\r\n" +
+	"\r\n"
+
+func TestParse(t *testing.T) {
+	from := &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: DefaultPort}
+	p, err := Parse([]byte(notify), from)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.168.1.50", p.IP)
+	assert.Equal(t, "01S00A000000000", p.Serial)
+	assert.Equal(t, "Workshop P1P", p.Name)
+	assert.Equal(t, "C11", p.Model)
+	assert.Equal(t, -44, p.Signal.Unwrap())
+	assert.Equal(t, "lan", p.Connect)
+	assert.Equal(t, "free", p.Bind)
+	assert.Equal(t, "secure", p.SecureLink)
+
+	// Falls back to the sender address
+	noLocation := strings.Replace(notify, "Location: 192.168.1.50\r\n", "", 1)
+	p, err = Parse([]byte(noLocation), from)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.2", p.IP)
+}
+
+func TestParse_NotPrinter(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "empty", data: ""},
+		{name: "search request", data: string(searchRequest("255.255.255.255:2021"))},
+		{name: "other device", data: strings.Replace(notify, "bambulab-com:device:3dprinter", "other:device:tv", 1)},
+		{name: "missing serial", data: strings.Replace(notify, "USN: 01S00A000000000\r\n", "", 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data), nil)
+			assert.True(t, errors.Is(err, ErrNotPrinter))
+		})
+	}
+}
+
+// fakePrinter answers searches with an announcement, like a printer does.
+func fakePrinter(ctx context.Context, t *testing.T, announcement string) string {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		buf := make([]byte, maxPacketSize)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(string(buf[:n]), "M-SEARCH") {
+				conn.WriteTo([]byte(announcement), from)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestDiscoverer_Discover(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	second := strings.Replace(notify, "01S00A000000000", "01P00A000000000", 1)
+	d := &Discoverer{
+		ListenAddr:     "127.0.0.1:0",
+		SearchAddr:     fakePrinter(ctx, t, second),
+		SearchInterval: 50 * time.Millisecond,
+	}
+	printers, err := d.Discover(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, printers, 1)
+	assert.Equal(t, "01P00A000000000", printers[0].Serial)
+	assert.Equal(t, "192.168.1.50", printers[0].IP)
+}
@@ -0,0 +1,236 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+	opt "github.com/moznion/go-optional"
+)
+
+const (
+	namespace   = "bambulab"
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// GcodeStates are the gcode states exposed by the gcode state enum gauge.
+var GcodeStates = []string{
+	"IDLE",
+	"INIT",
+	"OFFLINE",
+	"PREPARE",
+	"SLICING",
+	"RUNNING",
+	"PAUSE",
+	"FINISH",
+	"FAILED",
+	"UNKNOWN",
+}
+
+// Exporter is an http.Handler serving the state of printers as
+// prometheus metrics in the text exposition format.
+type Exporter struct {
+	mu       sync.RWMutex
+	monitors map[string]*monitor.Monitor
+}
+
+// New creates a new exporter with no printers.
+func New() *Exporter {
+	e := &Exporter{
+		monitors: make(map[string]*monitor.Monitor),
+	}
+	return e
+}
+
+// Add exports the state of the monitor labelled with the printer serial.
+// Adding a serial that already exists replaces its monitor.
+func (e *Exporter) Add(serial string, m *monitor.Monitor) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.monitors[serial] = m
+}
+
+// Remove stops exporting the printer with the given serial.
+func (e *Exporter) Remove(serial string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.monitors, serial)
+}
+
+// ServeHTTP writes metrics for all printers.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	if err := e.Write(w); err != nil {
+		fmt.Printf("fail write metrics, err=%s\n", err)
+	}
+}
+
+// Write writes metrics for all printers to w.
+func (e *Exporter) Write(w io.Writer) error {
+	e.mu.RLock()
+	serials := make([]string, 0, len(e.monitors))
+	for serial := range e.monitors {
+		serials = append(serials, serial)
+	}
+	sort.Strings(serials)
+	monitors := make([]*monitor.Monitor, len(serials))
+	for i, serial := range serials {
+		monitors[i] = e.monitors[serial]
+	}
+	e.mu.RUnlock()
+
+	fams := newFamilies()
+	for i, serial := range serials {
+		collect(fams, serial, monitors[i].CurrentState(), monitors[i].Counters())
+	}
+	return fams.write(w)
+}
+
+func collect(f *families, serial string, s monitor.State, c monitor.Counters) {
+	l := labels{"serial", serial}
+
+	gaugeOpt(f, "nozzle_temperature_celsius", "Current nozzle temperature.", l, s.Nozzle.Temperature)
+	gaugeOpt(f, "nozzle_target_temperature_celsius", "Target nozzle temperature.", l, intToFloat(s.Nozzle.TemperatureTarget))
+	gaugeOpt(f, "bed_temperature_celsius", "Current bed temperature.", l, s.Bed.Temperature)
+	gaugeOpt(f, "bed_target_temperature_celsius", "Target bed temperature.", l, intToFloat(s.Bed.TemperatureTarget))
+	gaugeOpt(f, "chamber_temperature_celsius", "Current chamber temperature.", l, intToFloat(s.Chamber.Temperature))
+
+	gaugeOpt(f, "fan_speed_percent", "Fan speed as a percent of maximum.", l.with("fan", "auxilliary"), s.Fans.Auxilliary)
+	gaugeOpt(f, "fan_speed_percent", "Fan speed as a percent of maximum.", l.with("fan", "chamber"), s.Fans.Chamber)
+	gaugeOpt(f, "fan_speed_percent", "Fan speed as a percent of maximum.", l.with("fan", "part"), s.Fans.Part)
+	gaugeOpt(f, "fan_speed_percent", "Fan speed as a percent of maximum.", l.with("fan", "hotend"), s.Fans.Hotend)
+
+	gaugeOpt(f, "print_percent", "Progress of the current print.", l, intToFloat(s.CurrentPrint.Percent))
+	gaugeOpt(f, "print_remaining_seconds", "Estimated time remaining for the current print.",
+		l, opt.Map(s.CurrentPrint.TimeRemaining, func(v int) float64 { return float64(v * 60) }))
+	gaugeOpt(f, "print_layer", "Current layer of the current print.", l, intToFloat(s.CurrentPrint.LayerNumber))
+	gaugeOpt(f, "print_layers_total", "Total layers of the current print.", l, intToFloat(s.CurrentPrint.LayerNumberTarget))
+	gaugeOpt(f, "wifi_signal_dbm", "Wifi signal strength.", l, s.Wifi)
+
+	if s.Gcode.State.IsSome() {
+		current := s.Gcode.State.Unwrap()
+		for _, state := range GcodeStates {
+			v := 0.0
+			if state == current {
+				v = 1
+			}
+			f.add("gcode_state", "Gcode state of the printer, 1 for the current state.", gauge, l.with("state", state), v)
+		}
+	}
+
+	for _, unit := range s.Ams.Units {
+		ul := l.with("ams", unit.ID.TakeOr(""))
+		gaugeOpt(f, "ams_humidity", "Humidity level reported by the AMS.", ul, unit.Humidity)
+		gaugeOpt(f, "ams_temperature_celsius", "Temperature reported by the AMS.", ul, unit.Temperature)
+		for _, tray := range unit.Trays {
+			tl := ul.with("tray", tray.ID.TakeOr(""))
+			gaugeOpt(f, "ams_tray_remaining_percent", "Filament remaining in the AMS tray.", tl, intToFloat(tray.Remaining))
+		}
+	}
+
+	f.add("prints_started_total", "Prints started since the monitor was created.", counter, l, float64(c.PrintsStarted))
+	f.add("prints_finished_total", "Prints finished since the monitor was created.", counter, l, float64(c.PrintsFinished))
+	f.add("prints_failed_total", "Prints failed since the monitor was created.", counter, l, float64(c.PrintsFailed))
+	f.add("prints_cancelled_total", "Prints cancelled since the monitor was created.", counter, l, float64(c.PrintsCancelled))
+	f.add("hms_errors_total", "HMS errors reported since the monitor was created.", counter, l, float64(c.HmsErrors))
+	f.add("hms_errors_active", "HMS errors currently reported by the printer.", gauge, l, float64(len(s.Hms)))
+}
+
+func gaugeOpt(f *families, name, help string, l labels, v opt.Option[float64]) {
+	if v.IsNone() {
+		return
+	}
+	f.add(name, help, gauge, l, v.Unwrap())
+}
+
+func intToFloat(v opt.Option[int]) opt.Option[float64] {
+	return opt.Map(v, func(i int) float64 { return float64(i) })
+}
+
+const (
+	gauge   = "gauge"
+	counter = "counter"
+)
+
+// labels are alternating label names and values
+type labels []string
+
+func (l labels) with(name, value string) labels {
+	out := make(labels, 0, len(l)+2)
+	out = append(out, l...)
+	return append(out, name, value)
+}
+
+func (l labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(l); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", l[i], escapeLabel(l[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+type sample struct {
+	labels labels
+	value  float64
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     string
+	samples []sample
+}
+
+// families groups samples by metric name, keeping first seen order
+type families struct {
+	order  []string
+	byName map[string]*family
+}
+
+func newFamilies() *families {
+	return &families{byName: make(map[string]*family)}
+}
+
+func (f *families) add(name, help, typ string, l labels, v float64) {
+	name = namespace + "_" + name
+	fam, ok := f.byName[name]
+	if !ok {
+		fam = &family{name: name, help: help, typ: typ}
+		f.byName[name] = fam
+		f.order = append(f.order, name)
+	}
+	fam.samples = append(fam.samples, sample{labels: l, value: v})
+}
+
+func (f *families) write(w io.Writer) error {
+	for _, name := range f.order {
+		fam := f.byName[name]
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", fam.name, fam.help, fam.name, fam.typ); err != nil {
+			return err
+		}
+		for _, s := range fam.samples {
+			if _, err := fmt.Fprintf(w, "%s%s %g\n", fam.name, s.labels, s.value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
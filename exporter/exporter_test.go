@@ -0,0 +1,113 @@
+package exporter
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/mqtt"
+	"github.com/stretchr/testify/assert"
+)
+
+const report = `
+{
+	"print": {
+		"nozzle_temper": 219.5,
+		"nozzle_target_temper": 220,
+		"bed_temper": 54.875,
+		"bed_target_temper": 55,
+		"cooling_fan_speed": "15",
+		"mc_percent": 42,
+		"mc_remaining_time": 10,
+		"layer_num": 7,
+		"wifi_signal": "-62dBm",
+		"gcode_state": "RUNNING",
+		"hms": [{"attr": 50331904, "code": 65543}],
+		"ams": {
+			"ams": [
+				{
+					"id": "0",
+					"humidity": "4",
+					"temp": "24.5",
+					"tray": [{"id": "0", "remain": 80}]
+				}
+			]
+		}
+	}
+}`
+
+func newMonitor(t *testing.T, raw string) *monitor.Monitor {
+	var msg mqtt.Message
+	assert.Nil(t, json.Unmarshal([]byte(raw), &msg))
+
+	m := monitor.New()
+	t.Cleanup(m.Stop)
+	msgs := make(chan mqtt.Message, 1)
+	go m.Start(msgs)
+	msgs <- msg
+	assert.Eventually(t, func() bool {
+		return m.CurrentState().Gcode.State.IsSome()
+	}, time.Second, 10*time.Millisecond)
+	return m
+}
+
+func TestExporter_ServeHTTP(t *testing.T) {
+	e := New()
+	e.Add("01S00A000000000", newMonitor(t, report))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, contentType, rec.Header().Get("Content-Type"))
+	body, err := io.ReadAll(rec.Body)
+	assert.Nil(t, err)
+	out := string(body)
+
+	expected := []string{
+		"# TYPE bambulab_nozzle_temperature_celsius gauge",
+		`bambulab_nozzle_temperature_celsius{serial="01S00A000000000"} 219.5`,
+		`bambulab_nozzle_target_temperature_celsius{serial="01S00A000000000"} 220`,
+		`bambulab_bed_temperature_celsius{serial="01S00A000000000"} 54.875`,
+		`bambulab_fan_speed_percent{serial="01S00A000000000",fan="part"} 100`,
+		`bambulab_print_percent{serial="01S00A000000000"} 42`,
+		`bambulab_print_remaining_seconds{serial="01S00A000000000"} 600`,
+		`bambulab_print_layer{serial="01S00A000000000"} 7`,
+		`bambulab_wifi_signal_dbm{serial="01S00A000000000"} -62`,
+		`bambulab_gcode_state{serial="01S00A000000000",state="RUNNING"} 1`,
+		`bambulab_gcode_state{serial="01S00A000000000",state="IDLE"} 0`,
+		`bambulab_ams_humidity{serial="01S00A000000000",ams="0"} 4`,
+		`bambulab_ams_temperature_celsius{serial="01S00A000000000",ams="0"} 24.5`,
+		`bambulab_ams_tray_remaining_percent{serial="01S00A000000000",ams="0",tray="0"} 80`,
+		"# TYPE bambulab_hms_errors_total counter",
+		`bambulab_hms_errors_total{serial="01S00A000000000"} 1`,
+		`bambulab_hms_errors_active{serial="01S00A000000000"} 1`,
+		`bambulab_prints_finished_total{serial="01S00A000000000"} 0`,
+	}
+	for _, line := range expected {
+		assert.Contains(t, out, line+"\n")
+	}
+	// Unknown values are omitted rather than reported as zero
+	assert.NotContains(t, out, "bambulab_chamber_temperature_celsius")
+	// Each family has a single header even when it has many samples
+	assert.Equal(t, 1, strings.Count(out, "# TYPE bambulab_fan_speed_percent"))
+}
+
+func TestExporter_Remove(t *testing.T) {
+	e := New()
+	e.Add("a", newMonitor(t, report))
+	e.Add("b", newMonitor(t, report))
+	e.Remove("a")
+
+	var b strings.Builder
+	assert.Nil(t, e.Write(&b))
+	assert.NotContains(t, b.String(), `serial="a"`)
+	assert.Contains(t, b.String(), `serial="b"`)
+}
+
+func TestLabels_Escape(t *testing.T) {
+	l := labels{"name", "a \"b\"\\c\n"}
+	assert.Equal(t, `{name="a \"b\"\\c\n"}`, l.String())
+}
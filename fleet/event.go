@@ -0,0 +1,74 @@
+package fleet
+
+import (
+	"sync"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+)
+
+// Event is a monitor event tagged with the printer it came from.
+type Event struct {
+	monitor.Event
+	Printer Config
+}
+
+// subscribers fans events out to any number of buffered channels.
+type subscribers struct {
+	mu     sync.RWMutex
+	chans  map[<-chan Event]chan Event
+	closed bool
+}
+
+func newSubscribers() *subscribers {
+	s := &subscribers{
+		chans: make(map[<-chan Event]chan Event),
+	}
+	return s
+}
+
+func (s *subscribers) add(size int) <-chan Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch := make(chan Event, size)
+	if s.closed {
+		close(ch)
+		return ch
+	}
+	s.chans[ch] = ch
+	return ch
+}
+
+func (s *subscribers) remove(ch <-chan Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.chans[ch]; ok {
+		delete(s.chans, ch)
+		close(c)
+	}
+}
+
+// emit delivers the event to every subscriber with room in its buffer,
+// returning the number of subscribers it was dropped for.
+func (s *subscribers) emit(e Event) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	dropped := 0
+	for _, c := range s.chans {
+		select {
+		case c <- e:
+		default:
+			dropped++
+		}
+	}
+	return dropped
+}
+
+func (s *subscribers) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch, c := range s.chans {
+		delete(s.chans, ch)
+		close(c)
+	}
+	s.closed = true
+}
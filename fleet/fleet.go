@@ -0,0 +1,280 @@
+package fleet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/mqtt"
+	"github.com/evanofslack/bambulab-client/printer"
+)
+
+const defaultEventBuffer = 256
+
+var (
+	ErrExists   = errors.New("printer already in fleet")
+	ErrNotFound = errors.New("printer not in fleet")
+)
+
+// Config describes how to connect to a printer.
+// Printers with a Host connect over the local network,
+// otherwise they connect through the cloud Endpoint.
+type Config struct {
+	Serial     string   `json:"serial"`
+	Name       string   `json:"name,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Host       string   `json:"host,omitempty"`
+	AccessCode string   `json:"access_code,omitempty"`
+	Endpoint   string   `json:"endpoint,omitempty"`
+	Username   string   `json:"username,omitempty"`
+	Password   string   `json:"password,omitempty"`
+}
+
+// HasTag reports whether the printer is tagged with tag.
+func (c Config) HasTag(tag string) bool {
+	for _, t := range c.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate reports whether the config has enough to connect to the printer.
+func (c Config) Validate() error {
+	if c.Serial == "" {
+		return errors.New("serial required")
+	}
+	if c.Host == "" && c.Endpoint == "" {
+		return errors.New("host or endpoint required")
+	}
+	return nil
+}
+
+// NewClient creates a local client if the config has a host,
+// otherwise a cloud client.
+func (c Config) NewClient(opts ...mqtt.ClientOption) (*mqtt.Client, error) {
+	if c.Host != "" {
+		return mqtt.NewLocalClient(c.Host, c.Serial, c.AccessCode, opts...)
+	}
+	return mqtt.NewCloudClient(c.Endpoint, c.Serial, c.Username, c.Password, opts...)
+}
+
+// Option configures a printer added to the fleet.
+type Option func(*options)
+
+type options struct {
+	client  []mqtt.ClientOption
+	monitor []monitor.Option
+}
+
+// WithClientOptions configures the mqtt client of the printer.
+func WithClientOptions(opts ...mqtt.ClientOption) Option {
+	return func(o *options) {
+		o.client = append(o.client, opts...)
+	}
+}
+
+// WithMonitorOptions configures the monitor of the printer, e.g.
+// monitor.WithStaleTimeout(0) disables the stale watchdog.
+func WithMonitorOptions(opts ...monitor.Option) Option {
+	return func(o *options) {
+		o.monitor = append(o.monitor, opts...)
+	}
+}
+
+type member struct {
+	config  Config
+	printer *printer.Printer
+	events  <-chan monitor.Event
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// Fleet manages many printers, running each in the background.
+type Fleet struct {
+	mu       sync.RWMutex
+	printers map[string]*member
+	events   *subscribers
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// New creates an empty fleet.
+func New() *Fleet {
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &Fleet{
+		printers: make(map[string]*member),
+		events:   newSubscribers(),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	return f
+}
+
+// Add creates a printer for the config and starts running it in the
+// background, see printer.Printer.Run.
+func (f *Fleet) Add(cfg Config, opts ...Option) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config for %q: %w", cfg.Serial, err)
+	}
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	client, err := cfg.NewClient(o.client...)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.ctx.Err() != nil {
+		return f.ctx.Err()
+	}
+	if _, ok := f.printers[cfg.Serial]; ok {
+		return fmt.Errorf("%w: %s", ErrExists, cfg.Serial)
+	}
+
+	p := printer.New(client, o.monitor...)
+	ctx, cancel := context.WithCancel(f.ctx)
+	m := &member{
+		config:  cfg,
+		printer: p,
+		events:  p.Subscribe(defaultEventBuffer),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	f.printers[cfg.Serial] = m
+	go f.run(ctx, m)
+	return nil
+}
+
+// Remove disconnects the printer and removes it from the fleet.
+func (f *Fleet) Remove(serial string) error {
+	f.mu.Lock()
+	m, ok := f.printers[serial]
+	if ok {
+		delete(f.printers, serial)
+	}
+	f.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, serial)
+	}
+	m.stop()
+	return nil
+}
+
+// Close disconnects every printer and closes the subscribed channels. The
+// fleet can not be used afterwards.
+func (f *Fleet) Close() {
+	f.mu.Lock()
+	f.cancel()
+	printers := f.printers
+	f.printers = make(map[string]*member)
+	f.mu.Unlock()
+	for _, m := range printers {
+		m.stop()
+	}
+	f.events.close()
+}
+
+// Subscribe returns a channel receiving the events of every printer. The
+// channel holds up to size events, further events are dropped until the
+// subscriber catches up. The channel is closed on Unsubscribe or Close.
+func (f *Fleet) Subscribe(size int) <-chan Event {
+	return f.events.add(size)
+}
+
+// Unsubscribe stops delivery of events to the channel and closes it.
+func (f *Fleet) Unsubscribe(ch <-chan Event) {
+	f.events.remove(ch)
+}
+
+// Printers lists the config of every printer, ordered by serial.
+func (f *Fleet) Printers() []Config {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	configs := make([]Config, 0, len(f.printers))
+	for _, m := range f.printers {
+		configs = append(configs, m.config)
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].Serial < configs[j].Serial
+	})
+	return configs
+}
+
+// States is the current state of every printer keyed by serial.
+func (f *Fleet) States() map[string]monitor.State {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	states := make(map[string]monitor.State, len(f.printers))
+	for serial, m := range f.printers {
+		states[serial] = m.printer.State()
+	}
+	return states
+}
+
+// State is the current state of one printer.
+func (f *Fleet) State(serial string) (monitor.State, bool) {
+	m, ok := f.Monitor(serial)
+	if !ok {
+		return monitor.State{}, false
+	}
+	return m.CurrentState(), true
+}
+
+// Printer is one printer of the fleet.
+func (f *Fleet) Printer(serial string) (*printer.Printer, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	m, ok := f.printers[serial]
+	if !ok {
+		return nil, false
+	}
+	return m.printer, true
+}
+
+// Client is the mqtt client of one printer, used to send commands.
+func (f *Fleet) Client(serial string) (*mqtt.Client, bool) {
+	p, ok := f.Printer(serial)
+	if !ok {
+		return nil, false
+	}
+	return p.Client(), true
+}
+
+// Monitor is the monitor of one printer.
+func (f *Fleet) Monitor(serial string) (*monitor.Monitor, bool) {
+	p, ok := f.Printer(serial)
+	if !ok {
+		return nil, false
+	}
+	return p.Monitor(), true
+}
+
+// run runs the printer and forwards its events until it stops.
+func (f *Fleet) run(ctx context.Context, m *member) {
+	defer close(m.done)
+	go func() {
+		if err := m.printer.Run(ctx); err != nil {
+			fmt.Fprintf(m.printer.Client().LogOutput(), "fail run printer, serial=%s, err=%s\n", m.config.Serial, err)
+		}
+	}()
+
+	// The monitor closes the channel once the printer stops running
+	for e := range m.events {
+		if dropped := f.events.emit(Event{Event: e, Printer: m.config}); dropped > 0 {
+			fmt.Fprintf(m.printer.Client().LogOutput(), "fleet event dropped, serial=%s, event=%s, subscribers=%d\n", m.config.Serial, e.Type, dropped)
+		}
+	}
+}
+
+func (m *member) stop() {
+	m.cancel()
+	<-m.done
+}
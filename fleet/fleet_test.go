@@ -0,0 +1,157 @@
+package fleet
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/printertest"
+	"github.com/stretchr/testify/assert"
+)
+
+// Printers on a closed local port never connect.
+func newConfig(serial string, tags ...string) Config {
+	return Config{
+		Serial:     serial,
+		Name:       "printer " + serial,
+		Tags:       tags,
+		Host:       "127.0.0.1",
+		AccessCode: "12345678",
+	}
+}
+
+// newServer starts a fake printer, returning the config and option to
+// connect to it.
+func newServer(t *testing.T, serial, gcodeState string, tags ...string) (*printertest.Server, Config, Option) {
+	s, err := printertest.NewServerFor(serial, printertest.DefaultAccessCode)
+	assert.Nil(t, err)
+	t.Cleanup(s.Close)
+	report := printertest.DefaultReport()
+	report["gcode_state"] = gcodeState
+	s.SetReport(report)
+	cfg := newConfig(serial, tags...)
+	cfg.AccessCode = s.AccessCode
+	return s, cfg, WithClientOptions(s.ClientOptions()...)
+}
+
+func TestFleet_AddRemove(t *testing.T) {
+	f := New()
+	defer f.Close()
+
+	assert.Nil(t, f.Add(newConfig("B")))
+	assert.Nil(t, f.Add(newConfig("A")))
+	assert.True(t, errors.Is(f.Add(newConfig("A")), ErrExists))
+	assert.NotNil(t, f.Add(Config{Serial: "C"}))
+
+	configs := f.Printers()
+	assert.Len(t, configs, 2)
+	assert.Equal(t, "A", configs[0].Serial)
+	assert.Equal(t, "B", configs[1].Serial)
+
+	_, ok := f.Client("A")
+	assert.True(t, ok)
+
+	assert.Nil(t, f.Remove("A"))
+	assert.True(t, errors.Is(f.Remove("A"), ErrNotFound))
+	_, ok = f.Monitor("A")
+	assert.False(t, ok)
+	assert.Len(t, f.Printers(), 1)
+}
+
+func TestFleet_States(t *testing.T) {
+	f := New()
+	defer f.Close()
+	_, a, aOpt := newServer(t, "A", "RUNNING")
+	_, b, bOpt := newServer(t, "B", "IDLE")
+	assert.Nil(t, f.Add(a, aOpt))
+	assert.Nil(t, f.Add(b, bOpt))
+
+	assert.Eventually(t, func() bool {
+		states := f.States()
+		return states["A"].Gcode.State.TakeOr("") == "RUNNING" &&
+			states["B"].Gcode.State.TakeOr("") == "IDLE"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	state, ok := f.State("A")
+	assert.True(t, ok)
+	assert.Equal(t, "RUNNING", state.Gcode.State.Unwrap())
+	_, ok = f.State("missing")
+	assert.False(t, ok)
+	p, ok := f.Printer("A")
+	assert.True(t, ok)
+	assert.Equal(t, "A", p.Serial())
+}
+
+func TestFleet_Subscribe(t *testing.T) {
+	f := New()
+	defer f.Close()
+	events := f.Subscribe(10)
+	other := f.Subscribe(10)
+	s, cfg, opt := newServer(t, "A", "IDLE", "farm")
+	assert.Nil(t, f.Add(cfg, opt))
+
+	seen := []monitor.EventType{}
+	timeout := time.After(5 * time.Second)
+	for len(seen) < 3 {
+		select {
+		case e := <-events:
+			assert.Equal(t, "A", e.Printer.Serial)
+			assert.True(t, e.Printer.HasTag("farm"))
+			seen = append(seen, e.Type)
+			if len(seen) == 1 {
+				// The full report has arrived, start printing
+				assert.Nil(t, s.Publish(map[string]any{"gcode_state": "RUNNING"}))
+			}
+		case <-timeout:
+			t.Fatalf("expected 3 events, got %v", seen)
+		}
+	}
+	expected := []monitor.EventType{monitor.EventUpdate, monitor.EventUpdate, monitor.EventPrintStarted}
+	assert.Equal(t, expected, seen)
+
+	// Every subscriber receives every event
+	for _, typ := range expected {
+		assert.Equal(t, typ, (<-other).Type)
+	}
+	f.Unsubscribe(other)
+	_, ok := <-other
+	assert.False(t, ok)
+
+	f.Close()
+	_, ok = <-events
+	assert.False(t, ok)
+	_, ok = <-f.Subscribe(1)
+	assert.False(t, ok, "closed after Close")
+}
+
+func TestFleet_RemoveStopsPrinter(t *testing.T) {
+	f := New()
+	defer f.Close()
+	_, cfg, opt := newServer(t, "A", "IDLE")
+	assert.Nil(t, f.Add(cfg, opt))
+	p, _ := f.Printer("A")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, p.WaitReady(ctx))
+
+	events := p.Subscribe(1)
+	assert.Nil(t, f.Remove("A"))
+	_, ok := <-events
+	assert.False(t, ok, "monitor stopped")
+}
+
+func TestFleet_MonitorOptions(t *testing.T) {
+	f := New()
+	defer f.Close()
+	_, cfg, opt := newServer(t, "A", "IDLE")
+	// Without a pushall handler the fake printer never reports again
+	stale := WithMonitorOptions(monitor.WithStaleTimeout(50*time.Millisecond), monitor.WithStaleHandler(func() {}))
+	assert.Nil(t, f.Add(cfg, opt, stale))
+	p, _ := f.Printer("A")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, p.WaitReady(ctx))
+	assert.Eventually(t, p.Monitor().Stale, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,212 @@
+package ftps
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// conn is an authenticated control connection
+type conn struct {
+	ctx       context.Context
+	ctrl      net.Conn
+	tp        *textproto.Conn
+	host      string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+	stop      func() bool
+
+	mu   sync.Mutex
+	data net.Conn
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	host, _, err := net.SplitHostPort(c.Addr)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{}
+	if c.TLSConfig != nil {
+		cfg = c.TLSConfig.Clone()
+	}
+	// Data connections resume the control session, which is keyed by server name
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	timeout := c.DialTimeout
+	if timeout <= 0 {
+		timeout = defaultDialTimeout
+	}
+
+	d := &tls.Dialer{NetDialer: &net.Dialer{Timeout: timeout}, Config: cfg}
+	ctrl, err := d.DialContext(ctx, "tcp", c.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial ftps: %w", err)
+	}
+	cn := &conn{
+		ctx:       ctx,
+		ctrl:      ctrl,
+		tp:        textproto.NewConn(ctrl),
+		host:      host,
+		tlsConfig: cfg,
+		timeout:   timeout,
+	}
+	// Unblock any pending reads and writes once the context is done
+	cn.stop = context.AfterFunc(ctx, func() {
+		cn.mu.Lock()
+		defer cn.mu.Unlock()
+		past := time.Unix(1, 0)
+		cn.ctrl.SetDeadline(past)
+		if cn.data != nil {
+			cn.data.SetDeadline(past)
+		}
+	})
+
+	if err := cn.login(c.Username, c.Password); err != nil {
+		cn.close()
+		return nil, err
+	}
+	return cn, nil
+}
+
+func (cn *conn) login(username, password string) error {
+	if _, _, err := cn.tp.ReadResponse(220); err != nil {
+		return cn.wrap(err)
+	}
+	code, err := cn.cmd(0, "USER %s", username)
+	if err != nil {
+		return err
+	}
+	if code == 331 {
+		if _, err := cn.cmd(230, "PASS %s", password); err != nil {
+			return err
+		}
+	} else if code != 230 {
+		return fmt.Errorf("login: unexpected response %d", code)
+	}
+	if _, err := cn.cmd(200, "TYPE I"); err != nil {
+		return err
+	}
+	if _, err := cn.cmd(200, "PBSZ 0"); err != nil {
+		return err
+	}
+	if _, err := cn.cmd(200, "PROT P"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// cmd sends a command and reads the response, failing unless the response
+// code is expect. An expect of 0 accepts any code.
+func (cn *conn) cmd(expect int, format string, args ...any) (int, error) {
+	code, _, err := cn.cmdMessage(expect, format, args...)
+	return code, err
+}
+
+func (cn *conn) cmdMessage(expect int, format string, args ...any) (int, string, error) {
+	if err := cn.tp.PrintfLine(format, args...); err != nil {
+		return 0, "", cn.wrap(err)
+	}
+	code, msg, err := cn.tp.ReadResponse(expect)
+	if err != nil {
+		return code, msg, cn.wrap(err)
+	}
+	return code, msg, nil
+}
+
+func (cn *conn) size(remotePath string) (int64, error) {
+	_, msg, err := cn.cmdMessage(213, "SIZE %s", remotePath)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+}
+
+// transfer opens a passive data connection and issues the command using it.
+// Callers must close the returned connection then call finish.
+func (cn *conn) transfer(command string) (net.Conn, error) {
+	_, msg, err := cn.cmdMessage(227, "PASV")
+	if err != nil {
+		return nil, err
+	}
+	port, err := parsePasv(msg)
+	if err != nil {
+		return nil, err
+	}
+	// Use the control host rather than the advertised one, which may be unroutable
+	d := &net.Dialer{Timeout: cn.timeout}
+	raw, err := d.DialContext(cn.ctx, "tcp", net.JoinHostPort(cn.host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("dial ftps data: %w", err)
+	}
+	data := tls.Client(raw, cn.tlsConfig)
+	cn.mu.Lock()
+	cn.data = data
+	cn.mu.Unlock()
+
+	if err := cn.tp.PrintfLine("%s", command); err != nil {
+		data.Close()
+		return nil, cn.wrap(err)
+	}
+	if _, _, err := cn.tp.ReadResponse(1); err != nil {
+		data.Close()
+		return nil, cn.wrap(err)
+	}
+	return data, nil
+}
+
+// finish reads the response sent once a transfer completes.
+func (cn *conn) finish() error {
+	cn.mu.Lock()
+	cn.data = nil
+	cn.mu.Unlock()
+	if _, _, err := cn.tp.ReadResponse(2); err != nil {
+		return cn.wrap(err)
+	}
+	return nil
+}
+
+// wrap reports context cancellation in place of the resulting network error.
+func (cn *conn) wrap(err error) error {
+	if ctxErr := cn.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+func (cn *conn) close() error {
+	cn.stop()
+	if cn.ctx.Err() == nil {
+		cn.ctrl.SetDeadline(time.Now().Add(time.Second))
+		cn.tp.PrintfLine("QUIT")
+	}
+	return cn.tp.Close()
+}
+
+// parsePasv returns the port from a response like
+// Entering Passive Mode (192,168,1,50,195,80).
+func parsePasv(msg string) (int, error) {
+	start, end := strings.IndexByte(msg, '('), strings.IndexByte(msg, ')')
+	if start < 0 || end < start {
+		return 0, fmt.Errorf("invalid pasv response: %s", msg)
+	}
+	parts := strings.Split(msg[start+1:end], ",")
+	if len(parts) != 6 {
+		return 0, fmt.Errorf("invalid pasv response: %s", msg)
+	}
+	hi, err := strconv.Atoi(strings.TrimSpace(parts[4]))
+	if err != nil {
+		return 0, fmt.Errorf("invalid pasv response: %s", msg)
+	}
+	lo, err := strconv.Atoi(strings.TrimSpace(parts[5]))
+	if err != nil {
+		return 0, fmt.Errorf("invalid pasv response: %s", msg)
+	}
+	return hi<<8 | lo, nil
+}
@@ -0,0 +1,314 @@
+package ftps
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/mqtt"
+)
+
+const (
+	defaultPort        = 990
+	defaultUsername    = "bblp"
+	defaultDialTimeout = 10 * time.Second
+)
+
+var ErrNotLocal = errors.New("file transfer requires a local client")
+
+// ProgressFunc is called as a transfer progresses with the bytes transferred
+// so far and the total size, or -1 if the total is unknown.
+type ProgressFunc func(done, total int64)
+
+// Client transfers files to and from the printer storage over implicit FTPS.
+// Each operation uses its own connection so a client is safe for concurrent use.
+type Client struct {
+	Addr        string
+	Username    string
+	Password    string
+	TLSConfig   *tls.Config
+	DialTimeout time.Duration
+}
+
+// New creates a client for the printer at ip authenticating with the access code.
+func New(ip, accessCode string) *Client {
+	c := &Client{
+		Addr:     net.JoinHostPort(ip, strconv.Itoa(defaultPort)),
+		Username: defaultUsername,
+		Password: accessCode,
+		// Printers present a self signed certificate
+		TLSConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			ClientSessionCache: tls.NewLRUClientSessionCache(0),
+		},
+		DialTimeout: defaultDialTimeout,
+	}
+	return c
+}
+
+// NewFromClient creates a client sharing the address and access code of an
+// mqtt client connected over the local network.
+func NewFromClient(c *mqtt.Client) (*Client, error) {
+	if !c.Local() {
+		return nil, ErrNotLocal
+	}
+	return New(c.Host(), c.AccessCode()), nil
+}
+
+// List returns the entries in dir.
+func (c *Client) List(ctx context.Context, dir string) ([]Entry, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+
+	data, err := conn.transfer("LIST " + dir)
+	if err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(data)
+	data.Close()
+	if err != nil {
+		return nil, conn.wrap(err)
+	}
+	if err := conn.finish(); err != nil {
+		return nil, err
+	}
+	return parseList(string(b)), nil
+}
+
+// Size returns the size of the remote file in bytes.
+func (c *Client) Size(ctx context.Context, remotePath string) (int64, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.close()
+	return conn.size(remotePath)
+}
+
+// Upload copies a local file to remotePath.
+func (c *Client) Upload(ctx context.Context, localPath, remotePath string, progress ProgressFunc) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return c.Store(ctx, f, info.Size(), remotePath, progress)
+}
+
+// Store copies size bytes from r to remotePath. A size of -1 means unknown.
+func (c *Client) Store(ctx context.Context, r io.Reader, size int64, remotePath string, progress ProgressFunc) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+
+	data, err := conn.transfer("STOR " + remotePath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(data, &progressReader{r: r, total: size, progress: progress})
+	if cerr := data.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return conn.wrap(err)
+	}
+	return conn.finish()
+}
+
+// Download copies remotePath to a local file, replacing it if it exists.
+func (c *Client) Download(ctx context.Context, remotePath, localPath string, progress ProgressFunc) error {
+	f, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	if err := c.Retrieve(ctx, remotePath, f, 0, progress); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Retrieve copies remotePath to w starting at offset bytes into the file.
+func (c *Client) Retrieve(ctx context.Context, remotePath string, w io.Writer, offset int64, progress ProgressFunc) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+
+	total := int64(-1)
+	if size, err := conn.size(remotePath); err == nil {
+		total = size
+	}
+	if offset > 0 {
+		if _, err := conn.cmd(350, "REST %d", offset); err != nil {
+			return err
+		}
+	}
+	data, err := conn.transfer("RETR " + remotePath)
+	if err != nil {
+		return err
+	}
+	pw := &progressWriter{w: w, done: offset, total: total, progress: progress}
+	_, err = io.Copy(pw, data)
+	data.Close()
+	if err != nil {
+		return conn.wrap(err)
+	}
+	return conn.finish()
+}
+
+// Rename moves the remote file from to the path to.
+func (c *Client) Rename(ctx context.Context, from, to string) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+	if _, err := conn.cmd(350, "RNFR %s", from); err != nil {
+		return err
+	}
+	_, err = conn.cmd(250, "RNTO %s", to)
+	return err
+}
+
+// Delete removes the remote file.
+func (c *Client) Delete(ctx context.Context, remotePath string) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+	_, err = conn.cmd(250, "DELE %s", remotePath)
+	return err
+}
+
+// MakeDir creates a remote directory.
+func (c *Client) MakeDir(ctx context.Context, dir string) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+	_, err = conn.cmd(257, "MKD %s", dir)
+	return err
+}
+
+// Entry is a file or directory in the printer storage.
+type Entry struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+}
+
+// parseList parses unix style LIST output, skipping lines it doesn't understand.
+func parseList(out string) []Entry {
+	entries := []Entry{}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if e, ok := parseListLine(line); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// parseListLine parses a line like
+// -rw-rw-rw- 1 root root 1234 Aug 01 12:00 name with spaces.3mf
+func parseListLine(line string) (Entry, bool) {
+	e := Entry{}
+	fields := strings.Fields(line)
+	if len(fields) < 9 {
+		return e, false
+	}
+	size, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return e, false
+	}
+	// Name is everything after the eighth field, spaces included
+	rest := line
+	for i := 0; i < 8; i++ {
+		rest = strings.TrimLeft(rest, " ")
+		rest = rest[strings.IndexByte(rest, ' ')+1:]
+	}
+	e.Name = path.Base(strings.TrimLeft(rest, " "))
+	if e.Name == "." || e.Name == ".." {
+		return e, false
+	}
+	e.Size = size
+	e.IsDir = strings.HasPrefix(fields[0], "d")
+	e.ModTime = parseListTime(fields[5], fields[6], fields[7])
+	return e, true
+}
+
+// parseListTime parses the time columns of LIST output, which show either the
+// time of day for recent files or the year for older ones.
+func parseListTime(month, day, timeOrYear string) time.Time {
+	if strings.Contains(timeOrYear, ":") {
+		now := time.Now()
+		t, err := time.Parse("Jan 2 15:04 2006", fmt.Sprintf("%s %s %s %d", month, day, timeOrYear, now.Year()))
+		if err != nil {
+			return time.Time{}
+		}
+		// Dates in the future belong to last year
+		if t.After(now.Add(24 * time.Hour)) {
+			t = t.AddDate(-1, 0, 0)
+		}
+		return t
+	}
+	t, err := time.Parse("Jan 2 2006", fmt.Sprintf("%s %s %s", month, day, timeOrYear))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+type progressReader struct {
+	r        io.Reader
+	done     int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	if p.progress != nil && n > 0 {
+		p.progress(p.done, p.total)
+	}
+	return n, err
+}
+
+type progressWriter struct {
+	w        io.Writer
+	done     int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.done += int64(n)
+	if p.progress != nil && n > 0 {
+		p.progress(p.done, p.total)
+	}
+	return n, err
+}
@@ -0,0 +1,315 @@
+package ftps
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/mqtt"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAccessCode = "12345678"
+
+// fakeServer is a minimal implicit FTPS server backed by a map of files.
+type fakeServer struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	tls      *tls.Config
+	listener net.Listener
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	s := &fakeServer{
+		files: map[string][]byte{},
+		tls:   &tls.Config{Certificates: []tls.Certificate{selfSigned(t)}},
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", s.tls)
+	assert.Nil(t, err)
+	s.listener = l
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) client() *Client {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	c := New(host, testAccessCode)
+	c.Addr = net.JoinHostPort(host, port)
+	return c
+}
+
+func (s *fakeServer) file(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.files[name]
+	return b, ok
+}
+
+func (s *fakeServer) serve(c net.Conn) {
+	defer c.Close()
+	tp := textproto.NewConn(c)
+	tp.PrintfLine("220 ready")
+	var (
+		pasv   net.Listener
+		rest   int64
+		rename string
+	)
+	accept := func() net.Conn {
+		defer pasv.Close()
+		dc, err := pasv.Accept()
+		if err != nil {
+			return nil
+		}
+		return dc
+	}
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch cmd {
+		case "USER":
+			tp.PrintfLine("331 password required")
+		case "PASS":
+			if arg != testAccessCode {
+				tp.PrintfLine("530 login incorrect")
+				continue
+			}
+			tp.PrintfLine("230 logged in")
+		case "TYPE", "PBSZ", "PROT":
+			tp.PrintfLine("200 ok")
+		case "PASV":
+			pasv, _ = tls.Listen("tcp", "127.0.0.1:0", s.tls)
+			port := pasv.Addr().(*net.TCPAddr).Port
+			tp.PrintfLine("227 Entering Passive Mode (10,0,0,1,%d,%d)", port>>8, port&0xFF)
+		case "LIST":
+			tp.PrintfLine("150 listing")
+			dc := accept()
+			s.mu.Lock()
+			names := []string{}
+			for name := range s.files {
+				if path.Dir(name) == path.Clean(arg) {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(dc, "-rw-rw-rw- 1 root root %d Jan 02 2024 %s\r\n", len(s.files[name]), path.Base(name))
+			}
+			s.mu.Unlock()
+			dc.Close()
+			tp.PrintfLine("226 done")
+		case "STOR":
+			tp.PrintfLine("150 storing")
+			dc := accept()
+			b, _ := io.ReadAll(dc)
+			dc.Close()
+			s.mu.Lock()
+			s.files[arg] = b
+			s.mu.Unlock()
+			tp.PrintfLine("226 done")
+		case "REST":
+			rest, _ = strconv.ParseInt(arg, 10, 64)
+			tp.PrintfLine("350 restarting")
+		case "RETR":
+			b, ok := s.file(arg)
+			if !ok {
+				tp.PrintfLine("550 not found")
+				continue
+			}
+			tp.PrintfLine("150 sending")
+			dc := accept()
+			dc.Write(b[rest:])
+			dc.Close()
+			rest = 0
+			tp.PrintfLine("226 done")
+		case "SIZE":
+			b, ok := s.file(arg)
+			if !ok {
+				tp.PrintfLine("550 not found")
+				continue
+			}
+			tp.PrintfLine("213 %d", len(b))
+		case "RNFR":
+			rename = arg
+			tp.PrintfLine("350 ready")
+		case "RNTO":
+			s.mu.Lock()
+			s.files[arg] = s.files[rename]
+			delete(s.files, rename)
+			s.mu.Unlock()
+			tp.PrintfLine("250 renamed")
+		case "DELE":
+			s.mu.Lock()
+			_, ok := s.files[arg]
+			delete(s.files, arg)
+			s.mu.Unlock()
+			if !ok {
+				tp.PrintfLine("550 not found")
+				continue
+			}
+			tp.PrintfLine("250 deleted")
+		case "MKD":
+			tp.PrintfLine("257 created")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func selfSigned(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "printer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.Nil(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestClient_UploadDownload(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeServer(t)
+	c := s.client()
+
+	dir := t.TempDir()
+	local := filepath.Join(dir, "cube.3mf")
+	content := bytes.Repeat([]byte("cube"), 10000)
+	assert.Nil(t, os.WriteFile(local, content, 0o644))
+
+	var uploaded int64
+	err := c.Upload(ctx, local, "/cube.3mf", func(done, total int64) {
+		assert.Equal(t, int64(len(content)), total)
+		uploaded = done
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), uploaded)
+	stored, ok := s.file("/cube.3mf")
+	assert.True(t, ok)
+	assert.Equal(t, content, stored)
+
+	size, err := c.Size(ctx, "/cube.3mf")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), size)
+
+	downloaded := filepath.Join(dir, "downloaded.3mf")
+	var total int64
+	assert.Nil(t, c.Download(ctx, "/cube.3mf", downloaded, func(_, t int64) { total = t }))
+	got, err := os.ReadFile(downloaded)
+	assert.Nil(t, err)
+	assert.Equal(t, content, got)
+	assert.Equal(t, int64(len(content)), total)
+
+	var partial bytes.Buffer
+	assert.Nil(t, c.Retrieve(ctx, "/cube.3mf", &partial, 4, nil))
+	assert.Equal(t, content[4:], partial.Bytes())
+}
+
+func TestClient_ListRenameDelete(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeServer(t)
+	c := s.client()
+	s.files["/timelapse/video_1.mp4"] = []byte("1234")
+	s.files["/timelapse/video 2.mp4"] = []byte("12")
+	s.files["/other.3mf"] = []byte("1")
+
+	entries, err := c.List(ctx, "/timelapse")
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "video 2.mp4", entries[0].Name)
+	assert.Equal(t, int64(2), entries[0].Size)
+	assert.Equal(t, "video_1.mp4", entries[1].Name)
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), entries[1].ModTime)
+
+	assert.Nil(t, c.Rename(ctx, "/other.3mf", "/renamed.3mf"))
+	_, ok := s.file("/renamed.3mf")
+	assert.True(t, ok)
+
+	assert.Nil(t, c.Delete(ctx, "/renamed.3mf"))
+	_, ok = s.file("/renamed.3mf")
+	assert.False(t, ok)
+
+	var tpErr *textproto.Error
+	err = c.Delete(ctx, "/missing.3mf")
+	assert.True(t, errors.As(err, &tpErr))
+	assert.Equal(t, 550, tpErr.Code)
+}
+
+func TestClient_BadAccessCode(t *testing.T) {
+	s := newFakeServer(t)
+	c := s.client()
+	c.Password = "wrong"
+	_, err := c.List(context.Background(), "/")
+	assert.NotNil(t, err)
+}
+
+func TestClient_Cancel(t *testing.T) {
+	s := newFakeServer(t)
+	c := s.client()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.List(ctx, "/")
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestNewFromClient(t *testing.T) {
+	local, err := mqtt.NewLocalClient("192.168.1.50", "01S00A000000000", testAccessCode)
+	assert.Nil(t, err)
+	c, err := NewFromClient(local)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.168.1.50:990", c.Addr)
+	assert.Equal(t, "bblp", c.Username)
+	assert.Equal(t, testAccessCode, c.Password)
+
+	cloud, err := mqtt.NewCloudClient("us.mqtt.bambulab.com", "01S00A000000000", "u_1", "token")
+	assert.Nil(t, err)
+	_, err = NewFromClient(cloud)
+	assert.True(t, errors.Is(err, ErrNotLocal))
+}
+
+func TestParseListLine(t *testing.T) {
+	e, ok := parseListLine("drwxrwxrwx 1 root root 0 Aug 01 2023 timelapse")
+	assert.True(t, ok)
+	assert.True(t, e.IsDir)
+	assert.Equal(t, "timelapse", e.Name)
+
+	_, ok = parseListLine("total 3")
+	assert.False(t, ok)
+}
@@ -0,0 +1,378 @@
+package hass
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/fleet"
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/mqtt"
+)
+
+const (
+	DefaultDiscoveryPrefix = "homeassistant"
+	DefaultBaseTopic       = "bambulab"
+
+	defaultSyncInterval   = 30 * time.Second
+	defaultPublishTimeout = 10 * time.Second
+	defaultEventBuffer    = 16
+
+	availabilityOnline  = "online"
+	availabilityOffline = "offline"
+)
+
+var ErrUnknownCommand = errors.New("unknown command")
+
+// Broker is the mqtt broker Home Assistant is connected to.
+type Broker interface {
+	Publish(ctx context.Context, topic string, payload []byte, retain bool) error
+	Subscribe(topic string, fn func(topic string, payload []byte)) error
+}
+
+// Option configures a Bridge.
+type Option func(*Bridge)
+
+// WithDiscoveryPrefix sets the discovery prefix configured in Home
+// Assistant, homeassistant by default.
+func WithDiscoveryPrefix(prefix string) Option {
+	return func(b *Bridge) {
+		b.discoveryPrefix = prefix
+	}
+}
+
+// WithBaseTopic sets the topic the state and commands of printers are
+// published under, bambulab by default.
+func WithBaseTopic(topic string) Option {
+	return func(b *Bridge) {
+		b.baseTopic = topic
+	}
+}
+
+// WithSyncInterval sets how often printers added to or removed from the
+// fleet are announced to Home Assistant.
+func WithSyncInterval(d time.Duration) Option {
+	return func(b *Bridge) {
+		b.syncInterval = d
+	}
+}
+
+type printer struct {
+	config   fleet.Config
+	monitor  *monitor.Monitor
+	events   <-chan monitor.Event
+	entities map[string]entity
+	state    []byte
+	done     chan struct{}
+}
+
+// Bridge exposes the printers of a fleet to Home Assistant through MQTT
+// discovery, publishing their state and turning Home Assistant commands
+// into printer commands.
+//
+// Each printer publishes its state to <base>/<serial>/state and its
+// availability to <base>/<serial>/availability. Commands are received on
+// <base>/<serial>/<object>/set.
+type Bridge struct {
+	fleet           *fleet.Fleet
+	broker          Broker
+	discoveryPrefix string
+	baseTopic       string
+	syncInterval    time.Duration
+	mu              sync.Mutex
+	printers        map[string]*printer
+	wg              sync.WaitGroup
+}
+
+// New creates a bridge publishing the printers of the fleet to the broker.
+func New(f *fleet.Fleet, broker Broker, opts ...Option) *Bridge {
+	b := &Bridge{
+		fleet:           f,
+		broker:          broker,
+		discoveryPrefix: DefaultDiscoveryPrefix,
+		baseTopic:       DefaultBaseTopic,
+		syncInterval:    defaultSyncInterval,
+		printers:        make(map[string]*printer),
+	}
+	for _, o := range opts {
+		o(b)
+	}
+	return b
+}
+
+// Run announces the printers of the fleet and keeps their state up to
+// date until the context is done, when they are marked offline.
+func (b *Bridge) Run(ctx context.Context) error {
+	if err := b.broker.Subscribe(b.commandTopic("+", "+"), b.handleCommand); err != nil {
+		return fmt.Errorf("fail subscribe commands: %w", err)
+	}
+	if err := b.publish(ctx, b.bridgeAvailabilityTopic(), []byte(availabilityOnline)); err != nil {
+		return err
+	}
+	b.sync(ctx)
+
+	ticker := time.NewTicker(b.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			b.shutdown()
+			return nil
+		case <-ticker.C:
+			b.sync(ctx)
+		}
+	}
+}
+
+// sync announces printers added to the fleet and removes the entities of
+// printers no longer in it.
+func (b *Bridge) sync(ctx context.Context) {
+	configs := b.fleet.Printers()
+	current := make(map[string]bool, len(configs))
+	for _, cfg := range configs {
+		current[cfg.Serial] = true
+		m, ok := b.fleet.Monitor(cfg.Serial)
+		if !ok {
+			continue
+		}
+		b.mu.Lock()
+		p, ok := b.printers[cfg.Serial]
+		if ok && p.monitor == m {
+			b.mu.Unlock()
+			continue
+		}
+		old := p
+		p = &printer{
+			config:   cfg,
+			monitor:  m,
+			events:   m.Subscribe(defaultEventBuffer),
+			entities: make(map[string]entity),
+			done:     make(chan struct{}),
+		}
+		b.printers[cfg.Serial] = p
+		b.mu.Unlock()
+		if old != nil {
+			// Added again since the last sync, with a new monitor
+			old.monitor.Unsubscribe(old.events)
+			<-old.done
+			p.entities = old.entities
+		}
+
+		fmt.Printf("hass printer announced, serial=%s\n", cfg.Serial)
+		b.update(ctx, p, m.CurrentState())
+		availability := availabilityOnline
+		if m.Stale() {
+			availability = availabilityOffline
+		}
+		b.availability(ctx, cfg.Serial, availability)
+		b.wg.Add(1)
+		go b.follow(ctx, p)
+	}
+
+	b.mu.Lock()
+	var removed []*printer
+	for serial, p := range b.printers {
+		if !current[serial] {
+			delete(b.printers, serial)
+			removed = append(removed, p)
+		}
+	}
+	b.mu.Unlock()
+	for _, p := range removed {
+		b.remove(ctx, p)
+	}
+}
+
+// follow publishes the state of the printer on every update.
+func (b *Bridge) follow(ctx context.Context, p *printer) {
+	defer b.wg.Done()
+	defer close(p.done)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-p.events:
+			if !ok {
+				return
+			}
+			switch e.Type {
+			case monitor.EventUpdate:
+				b.update(ctx, p, e.State)
+			case monitor.EventStateStale:
+				b.availability(ctx, p.config.Serial, availabilityOffline)
+			case monitor.EventStateFresh:
+				b.availability(ctx, p.config.Serial, availabilityOnline)
+			}
+		}
+	}
+}
+
+// update announces entities not yet known to Home Assistant, e.g. a newly
+// reported AMS, then publishes the state if it changed.
+func (b *Bridge) update(ctx context.Context, p *printer, s monitor.State) {
+	for _, e := range entities(s) {
+		topic := b.discoveryTopic(p.config.Serial, e)
+		if _, ok := p.entities[topic]; ok {
+			continue
+		}
+		payload, err := json.Marshal(b.discovery(p.config, e))
+		if err != nil {
+			fmt.Printf("fail marshal discovery, object=%s, err=%s\n", e.object, err)
+			continue
+		}
+		if err := b.publish(ctx, topic, payload); err != nil {
+			fmt.Printf("fail publish discovery, object=%s, err=%s\n", e.object, err)
+			continue
+		}
+		p.entities[topic] = e
+	}
+
+	payload, err := json.Marshal(statePayload(s))
+	if err != nil {
+		fmt.Printf("fail marshal state, serial=%s, err=%s\n", p.config.Serial, err)
+		return
+	}
+	if bytes.Equal(payload, p.state) {
+		return
+	}
+	if err := b.publish(ctx, b.stateTopic(p.config.Serial), payload); err != nil {
+		fmt.Printf("fail publish state, serial=%s, err=%s\n", p.config.Serial, err)
+		return
+	}
+	p.state = payload
+}
+
+// availability marks the printer online or offline, stale printers being
+// offline.
+func (b *Bridge) availability(ctx context.Context, serial, availability string) {
+	if err := b.publish(ctx, b.availabilityTopic(serial), []byte(availability)); err != nil {
+		fmt.Printf("fail publish availability, serial=%s, err=%s\n", serial, err)
+	}
+}
+
+// remove deletes the entities of a printer from Home Assistant.
+func (b *Bridge) remove(ctx context.Context, p *printer) {
+	p.monitor.Unsubscribe(p.events)
+	<-p.done
+	fmt.Printf("hass printer removed, serial=%s\n", p.config.Serial)
+	b.availability(ctx, p.config.Serial, availabilityOffline)
+	for topic := range p.entities {
+		// An empty config removes the entity
+		if err := b.publish(ctx, topic, []byte{}); err != nil {
+			fmt.Printf("fail remove entity, topic=%s, err=%s\n", topic, err)
+		}
+	}
+}
+
+// shutdown marks every printer and the bridge offline.
+func (b *Bridge) shutdown() {
+	b.wg.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPublishTimeout)
+	defer cancel()
+	b.mu.Lock()
+	printers := b.printers
+	b.printers = make(map[string]*printer)
+	b.mu.Unlock()
+	for serial, p := range printers {
+		p.monitor.Unsubscribe(p.events)
+		b.availability(ctx, serial, availabilityOffline)
+	}
+	if err := b.publish(ctx, b.bridgeAvailabilityTopic(), []byte(availabilityOffline)); err != nil {
+		fmt.Printf("fail publish bridge availability, err=%s\n", err)
+	}
+}
+
+// handleCommand turns a Home Assistant command into a printer command.
+func (b *Bridge) handleCommand(topic string, payload []byte) {
+	serial, object, ok := b.parseCommandTopic(topic)
+	if !ok {
+		fmt.Printf("fail parse command topic, topic=%s\n", topic)
+		return
+	}
+	c, ok := b.fleet.Client(serial)
+	if !ok {
+		fmt.Printf("fail command, printer not in fleet, serial=%s\n", serial)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPublishTimeout)
+	defer cancel()
+	if err := command(ctx, c, object, string(payload)); err != nil {
+		fmt.Printf("fail command, serial=%s, object=%s, err=%s\n", serial, object, err)
+	}
+}
+
+func command(ctx context.Context, c *mqtt.Client, object, payload string) error {
+	switch object {
+	case objectChamberLight:
+		switch payload {
+		case payloadOn:
+			return c.PublishLight(ctx, mqtt.LightChamber, true)
+		case payloadOff:
+			return c.PublishLight(ctx, mqtt.LightChamber, false)
+		}
+		return fmt.Errorf("invalid light payload %q", payload)
+	case objectPause:
+		return c.PublishPause(ctx)
+	case objectResume:
+		return c.PublishResume(ctx)
+	case objectStop:
+		return c.PublishStop(ctx)
+	case objectSpeed:
+		for _, l := range speedLevels {
+			if l.name == payload {
+				return c.PublishSpeed(ctx, l.level)
+			}
+		}
+		return fmt.Errorf("invalid speed %q", payload)
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownCommand, object)
+}
+
+func (b *Bridge) publish(ctx context.Context, topic string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultPublishTimeout)
+	defer cancel()
+	return b.broker.Publish(ctx, topic, payload, true)
+}
+
+func (b *Bridge) discoveryTopic(serial string, e entity) string {
+	return fmt.Sprintf("%s/%s/%s/%s/config", b.discoveryPrefix, e.component, strings.ToLower(serial), e.object)
+}
+
+func (b *Bridge) stateTopic(serial string) string {
+	return fmt.Sprintf("%s/%s/state", b.baseTopic, serial)
+}
+
+func (b *Bridge) availabilityTopic(serial string) string {
+	return fmt.Sprintf("%s/%s/availability", b.baseTopic, serial)
+}
+
+func (b *Bridge) bridgeAvailabilityTopic() string {
+	return BridgeAvailabilityTopic(b.baseTopic)
+}
+
+// BridgeAvailabilityTopic is where the bridge publishes whether it is
+// online, e.g. to set as the will of the broker connection.
+func BridgeAvailabilityTopic(baseTopic string) string {
+	return baseTopic + "/bridge/availability"
+}
+
+func (b *Bridge) commandTopic(serial, object string) string {
+	return fmt.Sprintf("%s/%s/%s/set", b.baseTopic, serial, object)
+}
+
+func (b *Bridge) parseCommandTopic(topic string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(topic, b.baseTopic+"/")
+	if !ok {
+		return "", "", false
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) != 3 || parts[2] != "set" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
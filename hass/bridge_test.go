@@ -0,0 +1,245 @@
+package hass
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/fleet"
+	"github.com/evanofslack/bambulab-client/printertest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBroker keeps the last payload retained on each topic.
+type fakeBroker struct {
+	mu       sync.Mutex
+	retained map[string][]byte
+	handlers map[string]func(topic string, payload []byte)
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{
+		retained: make(map[string][]byte),
+		handlers: make(map[string]func(topic string, payload []byte)),
+	}
+}
+
+func (b *fakeBroker) Publish(ctx context.Context, topic string, payload []byte, retain bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if retain {
+		b.retained[topic] = payload
+	}
+	return nil
+}
+
+func (b *fakeBroker) Subscribe(topic string, fn func(topic string, payload []byte)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[topic] = fn
+	return nil
+}
+
+func (b *fakeBroker) get(topic string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	payload, ok := b.retained[topic]
+	return payload, ok
+}
+
+func (b *fakeBroker) getJSON(t *testing.T, topic string) map[string]any {
+	payload, ok := b.get(topic)
+	assert.True(t, ok, topic)
+	v := map[string]any{}
+	assert.Nil(t, json.Unmarshal(payload, &v))
+	return v
+}
+
+// send delivers a message to the handler subscribed to the wildcard topic.
+func (b *fakeBroker) send(topic string, payload string) {
+	b.mu.Lock()
+	fn := b.handlers["bambulab/+/+/set"]
+	b.mu.Unlock()
+	fn(topic, []byte(payload))
+}
+
+func newTestBridge(t *testing.T) (*fakeBroker, *fleet.Fleet, *printertest.Server, context.CancelFunc, chan error) {
+	p, err := printertest.NewServer()
+	assert.Nil(t, err)
+	t.Cleanup(p.Close)
+	report := printertest.DefaultReport()
+	report["gcode_state"] = "RUNNING"
+	report["mc_percent"] = 42
+	report["ams"] = map[string]any{
+		"ams": []any{map[string]any{
+			"id":       "0",
+			"humidity": "4",
+			"temp":     "24.5",
+			"tray": []any{
+				map[string]any{"id": "0", "tray_type": "PLA", "tray_color": "FF0000FF", "remain": 80},
+				map[string]any{"id": "1", "tray_type": "PETG", "tray_color": "00FF00FF", "remain": 15},
+			},
+		}},
+	}
+	p.SetReport(report)
+
+	f := fleet.New()
+	t.Cleanup(f.Close)
+	cfg := fleet.Config{Serial: p.Serial, Name: "garage", Host: "127.0.0.1", AccessCode: p.AccessCode}
+	assert.Nil(t, f.Add(cfg, fleet.WithClientOptions(p.ClientOptions()...)))
+	assert.Eventually(t, func() bool {
+		s, _ := f.State(p.Serial)
+		return len(s.Ams.Units) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	broker := newFakeBroker()
+	b := New(f, broker, WithSyncInterval(10*time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	t.Cleanup(cancel)
+	return broker, f, p, cancel, done
+}
+
+func TestBridge_Announce(t *testing.T) {
+	broker, _, p, cancel, done := newTestBridge(t)
+	serial := strings.ToLower(p.Serial)
+	stateTopic := "bambulab/" + p.Serial + "/state"
+
+	assert.Eventually(t, func() bool {
+		_, ok := broker.get(stateTopic)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	state := broker.getJSON(t, stateTopic)
+	assert.Equal(t, "running", state["print_state"])
+	assert.Equal(t, float64(42), state["progress"])
+	assert.Equal(t, "standard", state["speed"])
+	assert.Equal(t, "OFF", state["chamber_light"])
+	ams := state["ams"].([]any)[0].(map[string]any)
+	assert.Equal(t, float64(4), ams["humidity"])
+	tray := ams["trays"].([]any)[1].(map[string]any)
+	assert.Equal(t, "PETG", tray["type"])
+	assert.Equal(t, "#00FF00", tray["color"])
+
+	temp := broker.getJSON(t, "homeassistant/sensor/"+serial+"/nozzle_temperature/config")
+	assert.Equal(t, "Nozzle temperature", temp["name"])
+	assert.Equal(t, serial+"_nozzle_temperature", temp["unique_id"])
+	assert.Equal(t, stateTopic, temp["state_topic"])
+	assert.Equal(t, "{{ value_json.nozzle_temperature }}", temp["value_template"])
+	assert.Equal(t, "garage", temp["device"].(map[string]any)["name"])
+	assert.Nil(t, temp["command_topic"])
+
+	light := broker.getJSON(t, "homeassistant/switch/"+serial+"/chamber_light/config")
+	assert.Equal(t, "bambulab/"+p.Serial+"/chamber_light/set", light["command_topic"])
+	pause := broker.getJSON(t, "homeassistant/button/"+serial+"/pause/config")
+	assert.Nil(t, pause["state_topic"])
+	speed := broker.getJSON(t, "homeassistant/select/"+serial+"/speed/config")
+	assert.Equal(t, []any{"silent", "standard", "sport", "ludicrous"}, speed["options"])
+	broker.getJSON(t, "homeassistant/sensor/"+serial+"/ams_0_humidity/config")
+	broker.getJSON(t, "homeassistant/sensor/"+serial+"/ams_0_tray_1/config")
+
+	availability, _ := broker.get("bambulab/" + p.Serial + "/availability")
+	assert.Equal(t, "online", string(availability))
+	availability, _ = broker.get("bambulab/bridge/availability")
+	assert.Equal(t, "online", string(availability))
+
+	// State changes are published
+	assert.Nil(t, p.Publish(map[string]any{"mc_percent": 50}))
+	assert.Eventually(t, func() bool {
+		payload, _ := broker.get(stateTopic)
+		return strings.Contains(string(payload), `"progress":50`)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.Nil(t, <-done)
+	availability, _ = broker.get("bambulab/" + p.Serial + "/availability")
+	assert.Equal(t, "offline", string(availability))
+	availability, _ = broker.get("bambulab/bridge/availability")
+	assert.Equal(t, "offline", string(availability))
+}
+
+func TestBridge_Commands(t *testing.T) {
+	tests := []struct {
+		object  string
+		payload string
+		command string
+		fields  map[string]any
+	}{
+		{object: "pause", payload: "PRESS", command: "pause"},
+		{object: "resume", payload: "PRESS", command: "resume"},
+		{object: "stop", payload: "PRESS", command: "stop"},
+		{object: "chamber_light", payload: "ON", command: "ledctrl",
+			fields: map[string]any{"led_node": "chamber_light", "led_mode": "on"}},
+		{object: "speed", payload: "sport", command: "print_speed",
+			fields: map[string]any{"param": "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.object, func(t *testing.T) {
+			broker, _, p, _, _ := newTestBridge(t)
+			assert.Eventually(t, func() bool {
+				_, ok := broker.get("bambulab/" + p.Serial + "/state")
+				return ok
+			}, 5*time.Second, 10*time.Millisecond)
+
+			broker.send("bambulab/"+p.Serial+"/"+tt.object+"/set", tt.payload)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			cmd, err := p.WaitCommand(ctx, tt.command)
+			assert.Nil(t, err)
+			for k, v := range tt.fields {
+				assert.Equal(t, v, cmd.Fields[k], k)
+			}
+		})
+	}
+}
+
+func TestBridge_Remove(t *testing.T) {
+	broker, f, p, _, _ := newTestBridge(t)
+	configTopic := "homeassistant/sensor/" + strings.ToLower(p.Serial) + "/progress/config"
+	assert.Eventually(t, func() bool {
+		payload, _ := broker.get(configTopic)
+		return len(payload) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, f.Remove(p.Serial))
+	assert.Eventually(t, func() bool {
+		payload, _ := broker.get(configTopic)
+		return len(payload) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	availability, _ := broker.get("bambulab/" + p.Serial + "/availability")
+	assert.Equal(t, "offline", string(availability))
+}
+
+func TestCommand_Invalid(t *testing.T) {
+	ctx := context.Background()
+	assert.ErrorIs(t, command(ctx, nil, "explode", "PRESS"), ErrUnknownCommand)
+	assert.ErrorContains(t, command(ctx, nil, "speed", "warp"), "invalid speed")
+	assert.ErrorContains(t, command(ctx, nil, "chamber_light", "BRIGHT"), "invalid light")
+}
+
+func TestBridge_ParseCommandTopic(t *testing.T) {
+	b := New(nil, nil, WithBaseTopic("printers/bambu"))
+	tests := []struct {
+		topic  string
+		serial string
+		object string
+		ok     bool
+	}{
+		{topic: "printers/bambu/ABC/pause/set", serial: "ABC", object: "pause", ok: true},
+		{topic: "printers/bambu/ABC/pause", ok: false},
+		{topic: "printers/bambu/ABC/pause/get", ok: false},
+		{topic: "bambulab/ABC/pause/set", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.topic, func(t *testing.T) {
+			serial, object, ok := b.parseCommandTopic(tt.topic)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.serial, serial)
+			assert.Equal(t, tt.object, object)
+		})
+	}
+}
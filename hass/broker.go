@@ -0,0 +1,122 @@
+package hass
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	defaultClientID = "go-bambulab-hass"
+	defaultQos      = 1
+)
+
+// BrokerConfig connects to the mqtt broker used by Home Assistant.
+type BrokerConfig struct {
+	// URL of the broker, e.g. tcp://homeassistant.local:1883
+	URL      string
+	Username string
+	Password string
+	ClientID string
+	// BaseTopic must match the bridge, the broker marks the bridge
+	// offline under it if the connection is lost
+	BaseTopic string
+}
+
+type subscription struct {
+	topic string
+	fn    func(topic string, payload []byte)
+}
+
+// PahoBroker is a Broker connected with the paho mqtt client. Its
+// subscriptions are renewed when it reconnects.
+type PahoBroker struct {
+	client paho.Client
+	mu     sync.Mutex
+	subs   []subscription
+}
+
+// Dial connects to the broker.
+func Dial(cfg BrokerConfig) (*PahoBroker, error) {
+	if cfg.ClientID == "" {
+		cfg.ClientID = defaultClientID
+	}
+	if cfg.BaseTopic == "" {
+		cfg.BaseTopic = DefaultBaseTopic
+	}
+	b := &PahoBroker{}
+	opts := paho.NewClientOptions()
+	opts.AddBroker(cfg.URL)
+	opts.SetClientID(cfg.ClientID)
+	opts.SetUsername(cfg.Username)
+	opts.SetPassword(cfg.Password)
+	opts.SetWill(BridgeAvailabilityTopic(cfg.BaseTopic), availabilityOffline, defaultQos, true)
+	opts.ConnectRetry = true
+	opts.AutoReconnect = true
+	opts.OnConnect = func(paho.Client) {
+		fmt.Println("hass broker connected")
+		b.resubscribe()
+	}
+	opts.OnConnectionLost = func(_ paho.Client, err error) {
+		fmt.Printf("hass broker connection lost, err=%s\n", err)
+	}
+	b.client = paho.NewClient(opts)
+	t := b.client.Connect()
+	if !t.WaitTimeout(defaultPublishTimeout) {
+		b.client.Disconnect(0)
+		return nil, fmt.Errorf("timeout connecting to %s", cfg.URL)
+	}
+	if err := t.Error(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Publish sends the payload to the topic.
+func (b *PahoBroker) Publish(ctx context.Context, topic string, payload []byte, retain bool) error {
+	t := b.client.Publish(topic, defaultQos, retain, payload)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.Done():
+		return t.Error()
+	}
+}
+
+// Subscribe calls fn with every message on the topic, which may contain
+// wildcards.
+func (b *PahoBroker) Subscribe(topic string, fn func(topic string, payload []byte)) error {
+	b.mu.Lock()
+	b.subs = append(b.subs, subscription{topic: topic, fn: fn})
+	b.mu.Unlock()
+	return b.subscribe(subscription{topic: topic, fn: fn})
+}
+
+func (b *PahoBroker) subscribe(s subscription) error {
+	t := b.client.Subscribe(s.topic, defaultQos, func(_ paho.Client, msg paho.Message) {
+		s.fn(msg.Topic(), msg.Payload())
+	})
+	if !t.WaitTimeout(5 * time.Second) {
+		return fmt.Errorf("timeout subscribing to %s", s.topic)
+	}
+	return t.Error()
+}
+
+func (b *PahoBroker) resubscribe() {
+	b.mu.Lock()
+	subs := append([]subscription{}, b.subs...)
+	b.mu.Unlock()
+	for _, s := range subs {
+		if err := b.subscribe(s); err != nil {
+			fmt.Printf("fail resubscribe, topic=%s, err=%s\n", s.topic, err)
+		}
+	}
+}
+
+// Close disconnects from the broker.
+func (b *PahoBroker) Close() {
+	b.client.Disconnect(1000)
+}
@@ -0,0 +1,259 @@
+package hass
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/evanofslack/bambulab-client/fleet"
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/mqtt"
+	opt "github.com/moznion/go-optional"
+)
+
+// Home Assistant entity components
+const (
+	componentSensor = "sensor"
+	componentSwitch = "switch"
+	componentButton = "button"
+	componentSelect = "select"
+)
+
+// Objects accepting commands, the last level of a command topic
+const (
+	objectChamberLight = "chamber_light"
+	objectPause        = "pause"
+	objectResume       = "resume"
+	objectStop         = "stop"
+	objectSpeed        = "speed"
+)
+
+const (
+	payloadOn    = "ON"
+	payloadOff   = "OFF"
+	payloadPress = "PRESS"
+)
+
+// speedLevels are the options of the speed select, in level order.
+var speedLevels = []struct {
+	name  string
+	level mqtt.SpeedLevel
+}{
+	{"silent", mqtt.SpeedSilent},
+	{"standard", mqtt.SpeedStandard},
+	{"sport", mqtt.SpeedSport},
+	{"ludicrous", mqtt.SpeedLudicrous},
+}
+
+// entity is a Home Assistant entity of a printer.
+type entity struct {
+	component string
+	object    string
+	name      string
+	// fields are added to the discovery config, e.g. device_class
+	fields map[string]any
+}
+
+// sensor reads the key of the state payload.
+func sensor(object, name string, fields map[string]any) entity {
+	e := entity{component: componentSensor, object: object, name: name, fields: fields}
+	if e.fields == nil {
+		e.fields = map[string]any{}
+	}
+	e.fields["value_template"] = fmt.Sprintf("{{ value_json.%s }}", object)
+	return e
+}
+
+func temperatureSensor(object, name string) entity {
+	return sensor(object, name, map[string]any{
+		"device_class":        "temperature",
+		"unit_of_measurement": "°C",
+		"state_class":         "measurement",
+	})
+}
+
+// entities lists the entities of the printer. AMS entities are only
+// listed for the units and trays reported in the state.
+func entities(s monitor.State) []entity {
+	es := []entity{
+		temperatureSensor("nozzle_temperature", "Nozzle temperature"),
+		temperatureSensor("nozzle_target_temperature", "Nozzle target temperature"),
+		temperatureSensor("bed_temperature", "Bed temperature"),
+		temperatureSensor("bed_target_temperature", "Bed target temperature"),
+		temperatureSensor("chamber_temperature", "Chamber temperature"),
+		sensor("progress", "Progress", map[string]any{
+			"unit_of_measurement": "%",
+			"state_class":         "measurement",
+		}),
+		sensor("remaining_time", "Remaining time", map[string]any{
+			"device_class":        "duration",
+			"unit_of_measurement": "min",
+		}),
+		sensor("current_layer", "Current layer", nil),
+		sensor("total_layers", "Total layers", nil),
+		sensor("print_state", "Print state", nil),
+		sensor("stage", "Stage", nil),
+		sensor("subtask", "Task", nil),
+		{component: componentSwitch, object: objectChamberLight, name: "Chamber light", fields: map[string]any{
+			"value_template": "{{ value_json.chamber_light }}",
+			"payload_on":     payloadOn,
+			"payload_off":    payloadOff,
+			"state_on":       payloadOn,
+			"state_off":      payloadOff,
+		}},
+		{component: componentButton, object: objectPause, name: "Pause", fields: map[string]any{
+			"payload_press": payloadPress,
+		}},
+		{component: componentButton, object: objectResume, name: "Resume", fields: map[string]any{
+			"payload_press": payloadPress,
+		}},
+		{component: componentButton, object: objectStop, name: "Stop", fields: map[string]any{
+			"payload_press": payloadPress,
+		}},
+		{component: componentSelect, object: objectSpeed, name: "Speed", fields: map[string]any{
+			"value_template": "{{ value_json.speed }}",
+			"options":        speedOptions(),
+		}},
+	}
+	for u, unit := range s.Ams.Units {
+		prefix := fmt.Sprintf("ams_%d", u)
+		label := fmt.Sprintf("AMS %d", u+1)
+		es = append(es,
+			entity{component: componentSensor, object: prefix + "_humidity", name: label + " humidity", fields: map[string]any{
+				"value_template": fmt.Sprintf("{{ value_json.ams[%d].humidity }}", u),
+				"state_class":    "measurement",
+			}},
+			entity{component: componentSensor, object: prefix + "_temperature", name: label + " temperature", fields: map[string]any{
+				"value_template":      fmt.Sprintf("{{ value_json.ams[%d].temperature }}", u),
+				"device_class":        "temperature",
+				"unit_of_measurement": "°C",
+				"state_class":         "measurement",
+			}},
+		)
+		for t := range unit.Trays {
+			tray := fmt.Sprintf("value_json.ams[%d].trays[%d]", u, t)
+			es = append(es, entity{
+				component: componentSensor,
+				object:    fmt.Sprintf("%s_tray_%d", prefix, t),
+				name:      fmt.Sprintf("%s tray %d", label, t+1),
+				fields: map[string]any{
+					"value_template":           fmt.Sprintf("{{ %s.type }}", tray),
+					"json_attributes_template": fmt.Sprintf("{{ %s | tojson }}", tray),
+					"icon":                     "mdi:printer-3d-nozzle",
+				},
+			})
+		}
+	}
+	return es
+}
+
+func speedOptions() []string {
+	options := make([]string, 0, len(speedLevels))
+	for _, l := range speedLevels {
+		options = append(options, l.name)
+	}
+	return options
+}
+
+// discovery is the Home Assistant MQTT discovery config of an entity.
+func (b *Bridge) discovery(cfg fleet.Config, e entity) map[string]any {
+	name := cfg.Name
+	if name == "" {
+		name = cfg.Serial
+	}
+	c := map[string]any{
+		"name":      e.name,
+		"unique_id": uniqueID(cfg.Serial, e.object),
+		"object_id": uniqueID(cfg.Serial, e.object),
+		"device": map[string]any{
+			"identifiers":   []string{cfg.Serial},
+			"name":          name,
+			"manufacturer":  "Bambu Lab",
+			"serial_number": cfg.Serial,
+		},
+		"availability": []map[string]any{
+			{"topic": b.bridgeAvailabilityTopic()},
+			{"topic": b.availabilityTopic(cfg.Serial)},
+		},
+		"availability_mode": "all",
+	}
+	if e.component != componentButton {
+		c["state_topic"] = b.stateTopic(cfg.Serial)
+	}
+	if e.component != componentSensor {
+		c["command_topic"] = b.commandTopic(cfg.Serial, e.object)
+	}
+	if _, ok := e.fields["json_attributes_template"]; ok {
+		c["json_attributes_topic"] = b.stateTopic(cfg.Serial)
+	}
+	for k, v := range e.fields {
+		c[k] = v
+	}
+	return c
+}
+
+func uniqueID(serial, object string) string {
+	return strings.ToLower(serial) + "_" + object
+}
+
+// statePayload is the state topic payload read by the entity templates.
+// Unknown values are null.
+func statePayload(s monitor.State) map[string]any {
+	p := map[string]any{
+		"nozzle_temperature":        value(s.Nozzle.Temperature),
+		"nozzle_target_temperature": value(s.Nozzle.TemperatureTarget),
+		"bed_temperature":           value(s.Bed.Temperature),
+		"bed_target_temperature":    value(s.Bed.TemperatureTarget),
+		"chamber_temperature":       value(s.Chamber.Temperature),
+		"progress":                  value(s.CurrentPrint.Percent),
+		"remaining_time":            value(s.CurrentPrint.TimeRemaining),
+		"current_layer":             value(s.CurrentPrint.LayerNumber),
+		"total_layers":              value(s.CurrentPrint.LayerNumberTarget),
+		"print_state":               value(opt.Map(s.Gcode.State, strings.ToLower)),
+		"stage":                     value(s.CurrentPrint.StageName),
+		"subtask":                   value(s.CurrentPrint.Subtask),
+		"speed":                     value(s.Speed.LevelName),
+		"chamber_light":             value(opt.Map(s.Lights.Chamber, onOff)),
+	}
+	ams := make([]map[string]any, 0, len(s.Ams.Units))
+	for _, unit := range s.Ams.Units {
+		trays := make([]map[string]any, 0, len(unit.Trays))
+		for _, t := range unit.Trays {
+			trays = append(trays, map[string]any{
+				"type":      value(t.Type),
+				"name":      value(t.Name),
+				"brand":     value(t.Brand),
+				"color":     value(opt.Map(t.Color, hexColor)),
+				"remaining": value(t.Remaining),
+			})
+		}
+		ams = append(ams, map[string]any{
+			"humidity":    value(unit.Humidity),
+			"temperature": value(unit.Temperature),
+			"trays":       trays,
+		})
+	}
+	p["ams"] = ams
+	return p
+}
+
+func value[T any](o opt.Option[T]) any {
+	if o.IsNone() {
+		return nil
+	}
+	return o.Unwrap()
+}
+
+func onOff(on bool) string {
+	if on {
+		return payloadOn
+	}
+	return payloadOff
+}
+
+// hexColor turns a tray color, RRGGBBAA, into a css color.
+func hexColor(c string) string {
+	if len(c) >= 6 {
+		c = c[:6]
+	}
+	return "#" + c
+}
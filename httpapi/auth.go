@@ -0,0 +1,57 @@
+package httpapi
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Middleware wraps a handler, e.g. to authenticate requests.
+type Middleware func(http.Handler) http.Handler
+
+// AuthFunc reports whether the request may be served.
+type AuthFunc func(r *http.Request) bool
+
+// Authenticate rejects requests for which fn returns false with
+// 401 Unauthorized.
+func Authenticate(fn AuthFunc) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !fn(r) {
+				writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BearerToken only serves requests with an "Authorization: Bearer <token>"
+// header naming one of the tokens.
+func BearerToken(tokens ...string) Middleware {
+	return Authenticate(func(r *http.Request) bool {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || got == "" {
+			return false
+		}
+		for _, t := range tokens {
+			if subtle.ConstantTimeCompare([]byte(got), []byte(t)) == 1 {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Chain applies the middlewares in order, the first being outermost.
+func Chain(ms ...Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		for i := len(ms) - 1; i >= 0; i-- {
+			next = ms[i](next)
+		}
+		return next
+	}
+}
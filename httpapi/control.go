@@ -0,0 +1,162 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/evanofslack/bambulab-client/fleet"
+	"github.com/evanofslack/bambulab-client/mqtt"
+)
+
+const maxBodySize = 1 << 20
+
+// LightRequest is the body of a light action.
+// Node defaults to the chamber light.
+type LightRequest struct {
+	Node string `json:"node"`
+	On   bool   `json:"on"`
+}
+
+// SpeedRequest is the body of a speed action, level 1 (silent)
+// to 4 (ludicrous).
+type SpeedRequest struct {
+	Level mqtt.SpeedLevel `json:"level"`
+}
+
+// PrintRequest is the body of a print action, starting a project file
+// already on the printer or reachable by url.
+type PrintRequest struct {
+	URL           string `json:"url"`
+	Plate         int    `json:"plate"`
+	SubtaskName   string `json:"subtask_name"`
+	BedType       string `json:"bed_type"`
+	UseAms        bool   `json:"use_ams"`
+	AmsMapping    []int  `json:"ams_mapping"`
+	Timelapse     bool   `json:"timelapse"`
+	BedLevelling  bool   `json:"bed_levelling"`
+	FlowCali      bool   `json:"flow_cali"`
+	VibrationCali bool   `json:"vibration_cali"`
+	LayerInspect  bool   `json:"layer_inspect"`
+}
+
+func (p PrintRequest) projectFile() mqtt.ProjectFile {
+	return mqtt.ProjectFile{
+		URL:           p.URL,
+		Plate:         p.Plate,
+		SubtaskName:   p.SubtaskName,
+		BedType:       p.BedType,
+		UseAms:        p.UseAms,
+		AmsMapping:    p.AmsMapping,
+		Timelapse:     p.Timelapse,
+		BedLevelling:  p.BedLevelling,
+		FlowCali:      p.FlowCali,
+		VibrationCali: p.VibrationCali,
+		LayerInspect:  p.LayerInspect,
+	}
+}
+
+// Result is the body of a successful control action.
+type Result struct {
+	Serial  string `json:"serial"`
+	Command string `json:"command"`
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	s.publish(w, r, "pause", func(ctx context.Context, c *mqtt.Client) error {
+		return c.PublishPause(ctx)
+	})
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	s.publish(w, r, "resume", func(ctx context.Context, c *mqtt.Client) error {
+		return c.PublishResume(ctx)
+	})
+}
+
+func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
+	s.publish(w, r, "stop", func(ctx context.Context, c *mqtt.Client) error {
+		return c.PublishStop(ctx)
+	})
+}
+
+func (s *Server) handleLight(w http.ResponseWriter, r *http.Request) {
+	var req LightRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	switch req.Node {
+	case "":
+		req.Node = mqtt.LightChamber
+	case mqtt.LightChamber, mqtt.LightWork:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid light node %q", req.Node))
+		return
+	}
+	s.publish(w, r, "ledctrl", func(ctx context.Context, c *mqtt.Client) error {
+		return c.PublishLight(ctx, req.Node, req.On)
+	})
+}
+
+func (s *Server) handleSpeed(w http.ResponseWriter, r *http.Request) {
+	var req SpeedRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Level < mqtt.SpeedSilent || req.Level > mqtt.SpeedLudicrous {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid speed level %d", req.Level))
+		return
+	}
+	s.publish(w, r, "print_speed", func(ctx context.Context, c *mqtt.Client) error {
+		return c.PublishSpeed(ctx, req.Level)
+	})
+}
+
+func (s *Server) handlePrint(w http.ResponseWriter, r *http.Request) {
+	var req PrintRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.URL == "" {
+		writeError(w, http.StatusBadRequest, errors.New("url required"))
+		return
+	}
+	s.publish(w, r, "project_file", func(ctx context.Context, c *mqtt.Client) error {
+		return c.PublishProjectFile(ctx, req.projectFile())
+	})
+}
+
+// publish sends a command to the printer named by the serial path value.
+func (s *Server) publish(w http.ResponseWriter, r *http.Request, command string, send func(context.Context, *mqtt.Client) error) {
+	serial := r.PathValue("serial")
+	c, ok := s.fleet.Client(serial)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", fleet.ErrNotFound, serial))
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.publishTimeout)
+	defer cancel()
+	if err := send(ctx, c); err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		writeError(w, status, fmt.Errorf("fail %s: %w", command, err))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, Result{Serial: serial, Command: command})
+}
+
+// decode reads the json request body into v, writing a bad request
+// response if it is invalid.
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %w", err))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,223 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/fleet"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultKeepAlive = 15 * time.Second
+	writeTimeout     = 10 * time.Second
+)
+
+var errStreamClosed = errors.New("stream closed")
+
+// WithCheckOrigin decides which origins may open a websocket, by
+// default only the origin of the server itself.
+func WithCheckOrigin(fn func(r *http.Request) bool) Option {
+	return func(srv *Server) {
+		srv.upgrader.CheckOrigin = fn
+	}
+}
+
+// WithStreamHistory sets how many events are kept per printer for
+// clients resuming a stream.
+func WithStreamHistory(n int) Option {
+	return func(srv *Server) {
+		srv.streamHistory = n
+	}
+}
+
+// Close stops streaming events, ending every open stream.
+func (s *Server) Close() {
+	s.mu.Lock()
+	streams := s.streams
+	s.streams = make(map[string]*stream)
+	s.mu.Unlock()
+	for _, st := range streams {
+		st.close()
+	}
+}
+
+// stream is the event stream of the printer named by the serial path
+// value, writing a not found response if it is not in the fleet.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request) (*stream, bool) {
+	serial := r.PathValue("serial")
+	m, ok := s.fleet.Monitor(serial)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", fleet.ErrNotFound, serial))
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// A printer removed and added again has a new monitor
+	if st, ok := s.streams[serial]; ok && st.monitor == m && !st.closed() {
+		return st, true
+	}
+	st, err := newStream(m, s.streamHistory)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	s.streams[serial] = st
+	return st, true
+}
+
+// listen starts following the stream from the event id the client last
+// saw, if any.
+func listen(st *stream, w http.ResponseWriter, lastEventID string) ([]StreamEvent, chan StreamEvent, bool) {
+	backlog, l, err := st.listen(lastEventID)
+	if errors.Is(err, errStreamClosed) {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return nil, nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, nil, false
+	}
+	return backlog, l, true
+}
+
+// handleEvents streams the printer as server sent events. The event name
+// is the type of the StreamEvent and the data is the StreamEvent itself.
+// Browsers resume with the Last-Event-ID header after a reconnect, other
+// clients may pass the last_event_id parameter.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	st, ok := s.stream(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	backlog, l, ok := listen(st, w, lastEventID)
+	if !ok {
+		return
+	}
+	defer st.unlisten(l)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	for _, e := range backlog {
+		if err := writeSSE(w, e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(s.keepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-l:
+			// A closed listener fell behind or the printer was removed,
+			// the client reconnects and resumes
+			if !ok {
+				return
+			}
+			if err := writeSSE(w, e); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeSSE(w http.ResponseWriter, e StreamEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
+
+// handleWebsocket streams the printer over a websocket, one StreamEvent
+// per text message. Clients resume with the last_event_id parameter.
+func (s *Server) handleWebsocket(w http.ResponseWriter, r *http.Request) {
+	st, ok := s.stream(w, r)
+	if !ok {
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		writeError(w, http.StatusBadRequest, errors.New("websocket upgrade required"))
+		return
+	}
+	backlog, l, ok := listen(st, w, r.URL.Query().Get("last_event_id"))
+	if !ok {
+		return
+	}
+	defer st.unlisten(l)
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied
+		return
+	}
+	defer conn.Close()
+
+	// Read until the client goes away, the stream is one way
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, e := range backlog {
+		if err := writeWebsocket(conn, e); err != nil {
+			return
+		}
+	}
+	keepAlive := time.NewTicker(s.keepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+		case e, ok := <-l:
+			if !ok {
+				msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "resume from last event")
+				conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeTimeout))
+				return
+			}
+			if err := writeWebsocket(conn, e); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeWebsocket(conn *websocket.Conn, e StreamEvent) error {
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return conn.WriteJSON(e)
+}
@@ -0,0 +1,290 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/fleet"
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/store"
+	"github.com/gorilla/websocket"
+	opt "github.com/moznion/go-optional"
+)
+
+const (
+	contentType           = "application/json"
+	defaultPublishTimeout = 10 * time.Second
+	defaultRecordBuffer   = 64
+)
+
+var ErrNoStore = errors.New("no job store configured")
+
+// Printer summarises a printer in the fleet.
+type Printer struct {
+	Serial    string             `json:"serial"`
+	Name      string             `json:"name,omitempty"`
+	Tags      []string           `json:"tags,omitempty"`
+	Local     bool               `json:"local"`
+	State     opt.Option[string] `json:"state"`
+	Subtask   opt.Option[string] `json:"subtask"`
+	Percent   opt.Option[int]    `json:"percent"`
+	Remaining opt.Option[int]    `json:"remaining"`
+}
+
+func newPrinter(cfg fleet.Config, s monitor.State) Printer {
+	return Printer{
+		Serial:    cfg.Serial,
+		Name:      cfg.Name,
+		Tags:      cfg.Tags,
+		Local:     cfg.Host != "",
+		State:     s.Gcode.State,
+		Subtask:   s.CurrentPrint.Subtask,
+		Percent:   s.CurrentPrint.Percent,
+		Remaining: s.CurrentPrint.TimeRemaining,
+	}
+}
+
+// Error is the body of every unsuccessful response.
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithStore serves job history from the store, which Run populates with
+// the jobs of the fleet.
+func WithStore(s *store.Store, opts ...store.RecorderOption) Option {
+	return func(srv *Server) {
+		srv.store = s
+		srv.recorder = store.NewRecorder(s, opts...)
+	}
+}
+
+// WithAuth wraps every route in the middleware, e.g. BearerToken.
+func WithAuth(m Middleware) Option {
+	return func(srv *Server) {
+		srv.auth = m
+	}
+}
+
+// WithPublishTimeout limits how long control actions wait for the
+// broker to accept a command.
+func WithPublishTimeout(d time.Duration) Option {
+	return func(srv *Server) {
+		srv.publishTimeout = d
+	}
+}
+
+// Server is an http.Handler serving the printers of a fleet as JSON.
+//
+//	GET  /printers
+//	GET  /printers/{serial}
+//	GET  /printers/{serial}/state
+//	GET  /printers/{serial}/jobs?from=&to=&outcome=
+//	GET  /printers/{serial}/ams
+//	GET  /printers/{serial}/events  server sent events, see StreamEvent
+//	GET  /printers/{serial}/ws      websocket, see StreamEvent
+//	POST /printers/{serial}/pause
+//	POST /printers/{serial}/resume
+//	POST /printers/{serial}/stop
+//	POST /printers/{serial}/light  {"node": "chamber_light", "on": true}
+//	POST /printers/{serial}/speed  {"level": 2}
+//	POST /printers/{serial}/print  {"url": "file:///sdcard/cube.3mf", ...}
+type Server struct {
+	fleet          *fleet.Fleet
+	store          *store.Store
+	recorder       *store.Recorder
+	auth           Middleware
+	publishTimeout time.Duration
+	streamHistory  int
+	keepAlive      time.Duration
+	upgrader       websocket.Upgrader
+	handler        http.Handler
+	mu             sync.Mutex
+	streams        map[string]*stream
+}
+
+// New creates a server for the printers of the fleet.
+func New(f *fleet.Fleet, opts ...Option) *Server {
+	s := &Server{
+		fleet:          f,
+		publishTimeout: defaultPublishTimeout,
+		streamHistory:  defaultStreamHistory,
+		keepAlive:      defaultKeepAlive,
+		streams:        make(map[string]*stream),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /printers", s.handlePrinters)
+	mux.HandleFunc("GET /printers/{serial}", s.handlePrinter)
+	mux.HandleFunc("GET /printers/{serial}/state", s.handleState)
+	mux.HandleFunc("GET /printers/{serial}/jobs", s.handleJobs)
+	mux.HandleFunc("GET /printers/{serial}/ams", s.handleAms)
+	mux.HandleFunc("GET /printers/{serial}/events", s.handleEvents)
+	mux.HandleFunc("GET /printers/{serial}/ws", s.handleWebsocket)
+	mux.HandleFunc("POST /printers/{serial}/pause", s.handlePause)
+	mux.HandleFunc("POST /printers/{serial}/resume", s.handleResume)
+	mux.HandleFunc("POST /printers/{serial}/stop", s.handleStop)
+	mux.HandleFunc("POST /printers/{serial}/light", s.handleLight)
+	mux.HandleFunc("POST /printers/{serial}/speed", s.handleSpeed)
+	mux.HandleFunc("POST /printers/{serial}/print", s.handlePrint)
+
+	s.handler = mux
+	if s.auth != nil {
+		s.handler = s.auth(mux)
+	}
+	return s
+}
+
+// Run records the jobs of the fleet in the store until ctx is done, see
+// store.Recorder. Without a store it waits for ctx.
+func (s *Server) Run(ctx context.Context) {
+	if s.recorder == nil {
+		<-ctx.Done()
+		return
+	}
+	sub := s.fleet.Subscribe(defaultRecordBuffer)
+	defer s.fleet.Unsubscribe(sub)
+	events := make(chan store.Event)
+	go func() {
+		defer close(events)
+		for e := range sub {
+			select {
+			case <-ctx.Done():
+				return
+			case events <- store.Event{Event: e.Event, Serial: e.Printer.Serial}:
+			}
+		}
+	}()
+	s.recorder.Run(ctx, events)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+func (s *Server) handlePrinters(w http.ResponseWriter, r *http.Request) {
+	states := s.fleet.States()
+	configs := s.fleet.Printers()
+	printers := make([]Printer, 0, len(configs))
+	for _, cfg := range configs {
+		printers = append(printers, newPrinter(cfg, states[cfg.Serial]))
+	}
+	writeJSON(w, http.StatusOK, printers)
+}
+
+func (s *Server) handlePrinter(w http.ResponseWriter, r *http.Request) {
+	cfg, state, ok := s.printer(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newPrinter(cfg, state))
+}
+
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	_, state, ok := s.printer(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+func (s *Server) handleAms(w http.ResponseWriter, r *http.Request) {
+	_, state, ok := s.printer(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, state.Ams)
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	cfg, _, ok := s.printer(w, r)
+	if !ok {
+		return
+	}
+	if s.store == nil {
+		writeError(w, http.StatusNotImplemented, ErrNoStore)
+		return
+	}
+	q, err := parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	q.Serial = cfg.Serial
+	jobs, err := s.store.Jobs(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if jobs == nil {
+		jobs = []store.Job{}
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// parseQuery reads the optional from, to (RFC 3339) and outcome
+// parameters of a jobs request.
+func parseQuery(r *http.Request) (store.Query, error) {
+	q := store.Query{}
+	values := r.URL.Query()
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		v := values.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, fmt.Errorf("invalid %s: %w", p.name, err)
+		}
+		*p.t = t
+	}
+	switch o := store.Outcome(values.Get("outcome")); o {
+	case "", store.OutcomeFinished, store.OutcomeFailed, store.OutcomeCancelled:
+		q.Outcome = o
+	default:
+		return q, fmt.Errorf("invalid outcome %q", o)
+	}
+	return q, nil
+}
+
+// printer looks up the printer named by the serial path value, writing
+// a not found response if it is not in the fleet.
+func (s *Server) printer(w http.ResponseWriter, r *http.Request) (fleet.Config, monitor.State, bool) {
+	serial := r.PathValue("serial")
+	for _, cfg := range s.fleet.Printers() {
+		if cfg.Serial != serial {
+			continue
+		}
+		state, ok := s.fleet.State(serial)
+		if ok {
+			return cfg, state, true
+		}
+	}
+	writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", fleet.ErrNotFound, serial))
+	return fleet.Config{}, monitor.State{}, false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Printf("fail write response, err=%s\n", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, Error{Error: err.Error()})
+}
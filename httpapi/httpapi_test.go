@@ -0,0 +1,236 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/fleet"
+	"github.com/evanofslack/bambulab-client/printertest"
+	"github.com/evanofslack/bambulab-client/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer serves a fleet with one fake printer, waiting for its
+// first report so reads see the printer state.
+func newTestServer(t *testing.T, opts ...Option) (*Server, *printertest.Server) {
+	p, err := printertest.NewServer()
+	assert.Nil(t, err)
+	t.Cleanup(p.Close)
+	report := printertest.DefaultReport()
+	report["gcode_state"] = "RUNNING"
+	report["subtask_name"] = "cube"
+	report["mc_percent"] = 42
+	p.SetReport(report)
+
+	f := fleet.New()
+	t.Cleanup(f.Close)
+	assert.Nil(t, f.Add(fleet.Config{
+		Serial:     p.Serial,
+		Name:       "garage",
+		Host:       "127.0.0.1",
+		AccessCode: p.AccessCode,
+	}, fleet.WithClientOptions(p.ClientOptions()...)))
+	assert.Eventually(t, func() bool {
+		s, _ := f.State(p.Serial)
+		return s.Gcode.State.TakeOr("") == "RUNNING"
+	}, 5*time.Second, 10*time.Millisecond)
+	return New(f, opts...), p
+}
+
+func do(s http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestServer_Printers(t *testing.T) {
+	s, p := newTestServer(t)
+
+	w := do(s, http.MethodGet, "/printers", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, contentType, w.Header().Get("Content-Type"))
+	var printers []map[string]any
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &printers))
+	assert.Len(t, printers, 1)
+	assert.Equal(t, p.Serial, printers[0]["serial"])
+	assert.Equal(t, "garage", printers[0]["name"])
+	assert.Equal(t, true, printers[0]["local"])
+	assert.Equal(t, "RUNNING", printers[0]["state"])
+	assert.Equal(t, "cube", printers[0]["subtask"])
+	assert.Equal(t, float64(42), printers[0]["percent"])
+
+	w = do(s, http.MethodGet, "/printers/"+p.Serial, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"garage"`)
+}
+
+func TestServer_State(t *testing.T) {
+	s, p := newTestServer(t)
+
+	w := do(s, http.MethodGet, "/printers/"+p.Serial+"/state", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var state map[string]any
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &state))
+	assert.Equal(t, "RUNNING", state["Gcode"].(map[string]any)["State"])
+
+	w = do(s, http.MethodGet, "/printers/"+p.Serial+"/ams", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"Units"`)
+}
+
+func TestServer_NotFound(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/printers/missing"},
+		{http.MethodGet, "/printers/missing/state"},
+		{http.MethodGet, "/printers/missing/ams"},
+		{http.MethodGet, "/printers/missing/jobs"},
+		{http.MethodPost, "/printers/missing/pause"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := do(s, tt.method, tt.path, "")
+			assert.Equal(t, http.StatusNotFound, w.Code)
+			var e Error
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &e))
+			assert.Contains(t, e.Error, "missing")
+		})
+	}
+
+	w := do(s, http.MethodGet, "/printers/missing/pause", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestServer_Jobs(t *testing.T) {
+	s, p := newTestServer(t)
+	w := do(s, http.MethodGet, "/printers/"+p.Serial+"/jobs", "")
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+
+	st, err := store.Open(t.TempDir())
+	assert.Nil(t, err)
+	ended := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	assert.Nil(t, st.AddJob(store.Job{Serial: p.Serial, Name: "cube", Outcome: store.OutcomeFinished, EndedAt: ended}))
+	assert.Nil(t, st.AddJob(store.Job{Serial: p.Serial, Name: "boat", Outcome: store.OutcomeFailed, EndedAt: ended.Add(time.Hour)}))
+	assert.Nil(t, st.AddJob(store.Job{Serial: "other", Name: "other", Outcome: store.OutcomeFinished, EndedAt: ended}))
+	s = New(s.fleet, WithStore(st))
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		jobs   []string
+	}{
+		{name: "all", status: http.StatusOK, jobs: []string{"cube", "boat"}},
+		{name: "outcome", query: "?outcome=failed", status: http.StatusOK, jobs: []string{"boat"}},
+		{name: "to", query: "?to=2024-05-01T12:30:00Z", status: http.StatusOK, jobs: []string{"cube"}},
+		{name: "none", query: "?from=2025-01-01T00:00:00Z", status: http.StatusOK, jobs: []string{}},
+		{name: "invalid time", query: "?from=yesterday", status: http.StatusBadRequest},
+		{name: "invalid outcome", query: "?outcome=exploded", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(s, http.MethodGet, "/printers/"+p.Serial+"/jobs"+tt.query, "")
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status != http.StatusOK {
+				return
+			}
+			var jobs []store.Job
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &jobs))
+			names := []string{}
+			for _, j := range jobs {
+				names = append(names, j.Name)
+			}
+			assert.Equal(t, tt.jobs, names)
+		})
+	}
+}
+
+func TestServer_RecordsJobs(t *testing.T) {
+	st, err := store.Open(t.TempDir())
+	assert.Nil(t, err)
+	s, p := newTestServer(t, WithStore(st))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	assert.Nil(t, p.Publish(map[string]any{"gcode_state": "FINISH"}))
+	var jobs []store.Job
+	assert.Eventually(t, func() bool {
+		w := do(s, http.MethodGet, "/printers/"+p.Serial+"/jobs", "")
+		jobs = nil
+		return w.Code == http.StatusOK && json.Unmarshal(w.Body.Bytes(), &jobs) == nil && len(jobs) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "cube", jobs[0].Name)
+	assert.Equal(t, store.OutcomeFinished, jobs[0].Outcome)
+}
+
+func TestServer_Control(t *testing.T) {
+	tests := []struct {
+		action  string
+		body    string
+		command string
+		fields  map[string]any
+	}{
+		{action: "pause", command: "pause"},
+		{action: "resume", command: "resume"},
+		{action: "stop", command: "stop"},
+		{action: "light", body: `{"on": true}`, command: "ledctrl",
+			fields: map[string]any{"led_node": "chamber_light", "led_mode": "on"}},
+		{action: "light", body: `{"node": "work_light", "on": false}`, command: "ledctrl",
+			fields: map[string]any{"led_node": "work_light", "led_mode": "off"}},
+		{action: "speed", body: `{"level": 3}`, command: "print_speed",
+			fields: map[string]any{"param": "3"}},
+		{action: "print", body: `{"url": "file:///sdcard/cube.3mf", "plate": 2, "use_ams": true}`, command: "project_file",
+			fields: map[string]any{"url": "file:///sdcard/cube.3mf", "param": "Metadata/plate_2.gcode", "use_ams": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			// WaitCommand finds the first command, so each case gets a printer
+			s, p := newTestServer(t)
+			w := do(s, http.MethodPost, "/printers/"+p.Serial+"/"+tt.action, tt.body)
+			assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+			var res Result
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &res))
+			assert.Equal(t, Result{Serial: p.Serial, Command: tt.command}, res)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			cmd, err := p.WaitCommand(ctx, tt.command)
+			assert.Nil(t, err)
+			for k, v := range tt.fields {
+				assert.Equal(t, v, cmd.Fields[k], k)
+			}
+		})
+	}
+}
+
+func TestServer_ControlInvalid(t *testing.T) {
+	s, p := newTestServer(t)
+
+	tests := []struct {
+		action string
+		body   string
+	}{
+		{"light", `{"node": "disco", "on": true}`},
+		{"light", `not json`},
+		{"speed", `{"level": 9}`},
+		{"speed", `{"level": 2, "extra": true}`},
+		{"print", `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action+" "+tt.body, func(t *testing.T) {
+			w := do(s, http.MethodPost, "/printers/"+p.Serial+"/"+tt.action, tt.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+)
+
+const (
+	defaultStreamHistory  = 256
+	defaultListenerBuffer = 64
+)
+
+// Stream event types besides the monitor event names, e.g. print_started.
+const (
+	StreamSnapshot = "snapshot"
+	StreamDiff     = "diff"
+)
+
+// StreamEvent is one message on the event stream of a printer.
+//
+// A snapshot carries the full state, a diff carries a JSON merge patch
+// (RFC 7386) against the state of the previous event. Other events carry
+// a patch only if they changed the state themselves, e.g. state_stale,
+// the change causing a print event is in the diff sent just before.
+type StreamEvent struct {
+	ID   uint64          `json:"id"`
+	Type string          `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// stream turns the events of a monitor into a log of diffs that listeners
+// may follow and resume from.
+//
+// IDs start from the creation time in nanoseconds, so ids handed out
+// before a restart fall outside the log and resume with a snapshot.
+type stream struct {
+	mu        sync.Mutex
+	monitor   *monitor.Monitor
+	events    <-chan monitor.Event
+	state     map[string]any
+	lastID    uint64
+	history   int
+	log       []StreamEvent
+	listeners map[chan StreamEvent]struct{}
+	done      chan struct{}
+}
+
+func newStream(m *monitor.Monitor, history int) (*stream, error) {
+	s := &stream{
+		monitor:   m,
+		events:    m.Subscribe(defaultListenerBuffer),
+		lastID:    uint64(time.Now().UnixNano()),
+		history:   history,
+		listeners: make(map[chan StreamEvent]struct{}),
+		done:      make(chan struct{}),
+	}
+	// Subscribe before reading the state so no change is missed
+	state, err := toJSONMap(m.CurrentState())
+	if err != nil {
+		m.Unsubscribe(s.events)
+		return nil, err
+	}
+	s.state = state
+	go s.run()
+	return s, nil
+}
+
+func (s *stream) run() {
+	defer close(s.done)
+	for e := range s.events {
+		if err := s.handle(e); err != nil {
+			fmt.Printf("fail stream event, event=%s, err=%s\n", e.Type, err)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for l := range s.listeners {
+		delete(s.listeners, l)
+		close(l)
+	}
+}
+
+func (s *stream) handle(e monitor.Event) error {
+	state, err := toJSONMap(e.State)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	patch := mergePatch(s.state, state)
+	s.state = state
+	var data json.RawMessage
+	if len(patch) > 0 {
+		if data, err = json.Marshal(patch); err != nil {
+			return err
+		}
+	}
+	if e.Type != monitor.EventUpdate {
+		s.append(StreamEvent{Type: e.Type.String(), Time: e.Time, Data: data})
+		return nil
+	}
+	if data != nil {
+		s.append(StreamEvent{Type: StreamDiff, Time: e.Time, Data: data})
+	}
+	return nil
+}
+
+// append adds the event to the log and sends it to every listener.
+// Listeners that have fallen behind are closed, they may resume from
+// the last event they received. The lock must be held.
+func (s *stream) append(e StreamEvent) {
+	s.lastID++
+	e.ID = s.lastID
+	s.log = append(s.log, e)
+	if len(s.log) > s.history {
+		s.log = append(s.log[:0], s.log[len(s.log)-s.history:]...)
+	}
+	for l := range s.listeners {
+		select {
+		case l <- e:
+		default:
+			delete(s.listeners, l)
+			close(l)
+		}
+	}
+}
+
+// listen returns the events a listener has to catch up on followed by a
+// channel of new events. Listeners resuming from an id still in the log
+// catch up on the events after it, others start from a snapshot.
+func (s *stream) listen(lastEventID string) ([]StreamEvent, chan StreamEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		return nil, nil, errStreamClosed
+	default:
+	}
+
+	backlog, ok := s.since(lastEventID)
+	if !ok {
+		data, err := json.Marshal(s.state)
+		if err != nil {
+			return nil, nil, err
+		}
+		backlog = []StreamEvent{{ID: s.lastID, Type: StreamSnapshot, Time: time.Now(), Data: data}}
+	}
+	l := make(chan StreamEvent, defaultListenerBuffer)
+	s.listeners[l] = struct{}{}
+	return backlog, l, nil
+}
+
+// since lists the events after the id, reporting false if the id is not
+// in the log. The lock must be held.
+func (s *stream) since(lastEventID string) ([]StreamEvent, bool) {
+	if lastEventID == "" {
+		return nil, false
+	}
+	id, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err != nil || id > s.lastID {
+		return nil, false
+	}
+	if id == s.lastID {
+		return nil, true
+	}
+	if len(s.log) == 0 || id < s.log[0].ID-1 {
+		return nil, false
+	}
+	start := int(id - (s.log[0].ID - 1))
+	return append([]StreamEvent{}, s.log[start:]...), true
+}
+
+func (s *stream) unlisten(l chan StreamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.listeners[l]; ok {
+		delete(s.listeners, l)
+		close(l)
+	}
+}
+
+func (s *stream) close() {
+	s.monitor.Unsubscribe(s.events)
+	<-s.done
+}
+
+func (s *stream) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// toJSONMap converts v to its generic JSON form.
+func toJSONMap(v any) (map[string]any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// mergePatch is the JSON merge patch turning prev into curr. Objects are
+// patched key by key, anything else is replaced whole.
+func mergePatch(prev, curr map[string]any) map[string]any {
+	patch := map[string]any{}
+	for k, c := range curr {
+		p, ok := prev[k]
+		if ok && reflect.DeepEqual(p, c) {
+			continue
+		}
+		pm, pok := p.(map[string]any)
+		cm, cok := c.(map[string]any)
+		if ok && pok && cok {
+			patch[k] = mergePatch(pm, cm)
+			continue
+		}
+		patch[k] = c
+	}
+	for k := range prev {
+		if _, ok := curr[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	return patch
+}
@@ -0,0 +1,269 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/mqtt"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		prev  string
+		curr  string
+		patch string
+	}{
+		{name: "equal", prev: `{"a":1,"b":{"c":2}}`, curr: `{"a":1,"b":{"c":2}}`, patch: `{}`},
+		{name: "changed", prev: `{"a":1,"b":2}`, curr: `{"a":1,"b":3}`, patch: `{"b":3}`},
+		{name: "nested", prev: `{"a":{"b":1,"c":2}}`, curr: `{"a":{"b":1,"c":3}}`, patch: `{"a":{"c":3}}`},
+		{name: "added", prev: `{}`, curr: `{"a":{"b":1}}`, patch: `{"a":{"b":1}}`},
+		{name: "removed", prev: `{"a":1,"b":2}`, curr: `{"a":1}`, patch: `{"b":null}`},
+		{name: "to null", prev: `{"a":"x"}`, curr: `{"a":null}`, patch: `{"a":null}`},
+		{name: "array", prev: `{"a":[1,2]}`, curr: `{"a":[1,3]}`, patch: `{"a":[1,3]}`},
+		{name: "object to value", prev: `{"a":{"b":1}}`, curr: `{"a":2}`, patch: `{"a":2}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var prev, curr map[string]any
+			assert.Nil(t, json.Unmarshal([]byte(tt.prev), &prev))
+			assert.Nil(t, json.Unmarshal([]byte(tt.curr), &curr))
+			b, err := json.Marshal(mergePatch(prev, curr))
+			assert.Nil(t, err)
+			assert.JSONEq(t, tt.patch, string(b))
+		})
+	}
+}
+
+func sendState(msgs chan<- mqtt.Message, gcodeState string) {
+	msgs <- mqtt.Message{Print: &mqtt.Print{GcodeState: &gcodeState}}
+}
+
+func receive(t *testing.T, l <-chan StreamEvent) StreamEvent {
+	t.Helper()
+	select {
+	case e, ok := <-l:
+		assert.True(t, ok)
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no stream event")
+		return StreamEvent{}
+	}
+}
+
+func gcodeState(t *testing.T, data json.RawMessage) any {
+	var v struct {
+		Gcode map[string]any
+	}
+	assert.Nil(t, json.Unmarshal(data, &v))
+	return v.Gcode["State"]
+}
+
+func TestStream(t *testing.T) {
+	m := monitor.New()
+	msgs := make(chan mqtt.Message)
+	go m.Start(msgs)
+	defer m.Stop()
+	sendState(msgs, "IDLE")
+	assert.Eventually(t, func() bool {
+		return m.CurrentState().Gcode.State.TakeOr("") == "IDLE"
+	}, time.Second, time.Millisecond)
+
+	st, err := newStream(m, 3)
+	assert.Nil(t, err)
+	defer st.close()
+
+	backlog, l, err := st.listen("")
+	assert.Nil(t, err)
+	assert.Len(t, backlog, 1)
+	snapshot := backlog[0]
+	assert.Equal(t, StreamSnapshot, snapshot.Type)
+	assert.Equal(t, "IDLE", gcodeState(t, snapshot.Data))
+
+	sendState(msgs, "RUNNING")
+	started := receive(t, l)
+	assert.Equal(t, StreamDiff, started.Type)
+	assert.Equal(t, snapshot.ID+1, started.ID)
+	assert.Equal(t, "RUNNING", gcodeState(t, started.Data))
+	assert.Equal(t, "print_started", receive(t, l).Type)
+
+	sendState(msgs, "FINISH")
+	finished := receive(t, l)
+	assert.Equal(t, "FINISH", gcodeState(t, finished.Data))
+	assert.Equal(t, "print_finished", receive(t, l).Type)
+	st.unlisten(l)
+
+	t.Run("resume", func(t *testing.T) {
+		backlog, l, err := st.listen(strconv.FormatUint(started.ID, 10))
+		assert.Nil(t, err)
+		defer st.unlisten(l)
+		types := []string{}
+		for _, e := range backlog {
+			types = append(types, e.Type)
+		}
+		assert.Equal(t, []string{"print_started", "diff", "print_finished"}, types)
+	})
+
+	t.Run("up to date", func(t *testing.T) {
+		backlog, l, err := st.listen(strconv.FormatUint(finished.ID+1, 10))
+		assert.Nil(t, err)
+		defer st.unlisten(l)
+		assert.Len(t, backlog, 0)
+	})
+
+	for _, id := range []string{strconv.FormatUint(snapshot.ID, 10), "0", "nope", strconv.FormatUint(finished.ID+2, 10)} {
+		t.Run("snapshot "+id, func(t *testing.T) {
+			// The log only holds three events, so the snapshot id is too old
+			backlog, l, err := st.listen(id)
+			assert.Nil(t, err)
+			defer st.unlisten(l)
+			assert.Len(t, backlog, 1)
+			assert.Equal(t, StreamSnapshot, backlog[0].Type)
+			assert.Equal(t, finished.ID+1, backlog[0].ID)
+			assert.Equal(t, "FINISH", gcodeState(t, backlog[0].Data))
+		})
+	}
+
+	t.Run("slow listener", func(t *testing.T) {
+		_, l, err := st.listen("")
+		assert.Nil(t, err)
+		for i := 0; i <= defaultListenerBuffer; i++ {
+			sendState(msgs, "state"+strconv.Itoa(i))
+		}
+		assert.Eventually(t, func() bool {
+			for {
+				select {
+				case _, ok := <-l:
+					if !ok {
+						return true
+					}
+				default:
+					return false
+				}
+			}
+		}, 5*time.Second, time.Millisecond)
+	})
+}
+
+func TestStream_MonitorStopped(t *testing.T) {
+	m := monitor.New()
+	st, err := newStream(m, defaultStreamHistory)
+	assert.Nil(t, err)
+	_, l, err := st.listen("")
+	assert.Nil(t, err)
+
+	m.Stop()
+	_, ok := <-l
+	assert.False(t, ok)
+	_, _, err = st.listen("")
+	assert.ErrorIs(t, err, errStreamClosed)
+}
+
+// readSSE reads the next event from a server sent event stream.
+func readSSE(t *testing.T, r *bufio.Reader) (string, StreamEvent) {
+	t.Helper()
+	var id, data string
+	for {
+		line, err := r.ReadString('\n')
+		assert.Nil(t, err)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && data != "":
+			var e StreamEvent
+			assert.Nil(t, json.Unmarshal([]byte(data), &e))
+			return id, e
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func percent(t *testing.T, data json.RawMessage) any {
+	var v struct {
+		CurrentPrint map[string]any
+	}
+	assert.Nil(t, json.Unmarshal(data, &v))
+	return v.CurrentPrint["Percent"]
+}
+
+func TestServer_Events(t *testing.T) {
+	s, p := newTestServer(t)
+	t.Cleanup(s.Close)
+	hs := httptest.NewServer(s)
+	t.Cleanup(hs.Close)
+
+	get := func(lastEventID string) *bufio.Reader {
+		req, err := http.NewRequest(http.MethodGet, hs.URL+"/printers/"+p.Serial+"/events", nil)
+		assert.Nil(t, err)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		return bufio.NewReader(resp.Body)
+	}
+
+	r := get("")
+	id, snapshot := readSSE(t, r)
+	assert.Equal(t, StreamSnapshot, snapshot.Type)
+	assert.Equal(t, strconv.FormatUint(snapshot.ID, 10), id)
+	assert.Equal(t, float64(42), percent(t, snapshot.Data))
+
+	assert.Nil(t, p.Publish(map[string]any{"mc_percent": 50}))
+	_, diff := readSSE(t, r)
+	assert.Equal(t, StreamDiff, diff.Type)
+	assert.Equal(t, float64(50), percent(t, diff.Data))
+
+	// Resuming from the snapshot replays the diff
+	_, resumed := readSSE(t, get(id))
+	assert.Equal(t, diff, resumed)
+
+	w := do(s, http.MethodGet, "/printers/missing/events", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestServer_Websocket(t *testing.T) {
+	s, p := newTestServer(t)
+	t.Cleanup(s.Close)
+	hs := httptest.NewServer(s)
+	t.Cleanup(hs.Close)
+	url := "ws" + strings.TrimPrefix(hs.URL, "http") + "/printers/" + p.Serial + "/ws"
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	var snapshot StreamEvent
+	assert.Nil(t, conn.ReadJSON(&snapshot))
+	assert.Equal(t, StreamSnapshot, snapshot.Type)
+	assert.Equal(t, float64(42), percent(t, snapshot.Data))
+
+	assert.Nil(t, p.Publish(map[string]any{"mc_percent": 60}))
+	var diff StreamEvent
+	assert.Nil(t, conn.ReadJSON(&diff))
+	assert.Equal(t, StreamDiff, diff.Type)
+	assert.Equal(t, float64(60), percent(t, diff.Data))
+
+	resumed, _, err := websocket.DefaultDialer.Dial(url+"?last_event_id="+strconv.FormatUint(snapshot.ID, 10), nil)
+	assert.Nil(t, err)
+	defer resumed.Close()
+	var e StreamEvent
+	assert.Nil(t, resumed.ReadJSON(&e))
+	assert.Equal(t, diff, e)
+
+	w := do(s, http.MethodGet, "/printers/"+p.Serial+"/ws", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
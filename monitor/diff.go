@@ -0,0 +1,209 @@
+package monitor
+
+import (
+	"reflect"
+	"strings"
+
+	mqtt "github.com/evanofslack/bambulab-client/mqtt"
+)
+
+const optionPkgPath = "github.com/moznion/go-optional"
+
+// Change is a field that differs between two messages or states.
+// Old and New are nil when the field is unset.
+type Change struct {
+	// Path names the field with dots, using json names for messages,
+	// e.g. print.bed_temper, and field names for states, e.g. Bed.Temperature
+	Path string
+	Old  any
+	New  any
+}
+
+// Diff lists the changed fields in field order.
+type Diff []Change
+
+// Changed reports whether the field at path, or any field under it,
+// changed. Changed("Bed") is true if Bed.Temperature changed.
+func (d Diff) Changed(path string) bool {
+	for _, c := range d {
+		if under(c.Path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the change to the field at exactly path.
+func (d Diff) Get(path string) (Change, bool) {
+	for _, c := range d {
+		if c.Path == path {
+			return c, true
+		}
+	}
+	return Change{}, false
+}
+
+// Filter keeps the changes at or under any of the paths.
+func (d Diff) Filter(paths ...string) Diff {
+	var filtered Diff
+	for _, c := range d {
+		for _, p := range paths {
+			if under(c.Path, p) {
+				filtered = append(filtered, c)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// Paths lists the path of every change.
+func (d Diff) Paths() []string {
+	paths := make([]string, 0, len(d))
+	for _, c := range d {
+		paths = append(paths, c.Path)
+	}
+	return paths
+}
+
+func under(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+".")
+}
+
+// Diff lists the fields that changed going from s to other,
+// with Old taken from s and New from other.
+func (s State) Diff(other State) Diff {
+	d := &differ{}
+	d.walk("", reflect.ValueOf(s), reflect.ValueOf(other))
+	return d.diff
+}
+
+// DiffMessages lists the fields that changed going from old to new.
+func DiffMessages(old, new mqtt.Message) Diff {
+	d := &differ{}
+	d.walk("", reflect.ValueOf(old), reflect.ValueOf(new))
+	return d.diff
+}
+
+// diffMessage lists the fields an incoming partial message changes when
+// merged into og. Fields missing from the partial message are skipped.
+func diffMessage(og, in *mqtt.Message) Diff {
+	if og == nil {
+		og = &mqtt.Message{}
+	}
+	if in == nil {
+		return nil
+	}
+	d := &differ{partial: true}
+	d.walk("", reflect.ValueOf(*og), reflect.ValueOf(*in))
+	return d.diff
+}
+
+// differ walks two values of the same type field by field. Structs are
+// compared field by field, anything else is compared whole.
+type differ struct {
+	// partial skips nil fields of the new value, as they are missing
+	// from a partial message rather than unset
+	partial bool
+	diff    Diff
+}
+
+func (d *differ) walk(path string, old, new reflect.Value) {
+	t := new.Type()
+	switch {
+	case t.PkgPath() == optionPkgPath:
+		if !reflect.DeepEqual(old.Interface(), new.Interface()) {
+			d.add(path, optionValue(old), optionValue(new))
+		}
+	case t.Kind() == reflect.Pointer:
+		if d.partial && new.IsNil() {
+			return
+		}
+		if old.IsNil() && new.IsNil() {
+			return
+		}
+		if t.Elem().Kind() == reflect.Struct {
+			d.walk(path, elem(old), elem(new))
+			return
+		}
+		d.leaf(path, pointerValue(old), pointerValue(new))
+	case t.Kind() == reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := fieldName(f)
+			if name == "" {
+				continue
+			}
+			d.walk(join(path, name), old.Field(i), new.Field(i))
+		}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Map:
+		if d.partial && new.IsNil() {
+			return
+		}
+		// A nil and an empty slice are the same to consumers
+		if old.Len() == 0 && new.Len() == 0 {
+			return
+		}
+		d.leaf(path, old.Interface(), new.Interface())
+	default:
+		d.leaf(path, old.Interface(), new.Interface())
+	}
+}
+
+func (d *differ) leaf(path string, old, new any) {
+	if !reflect.DeepEqual(old, new) {
+		d.add(path, old, new)
+	}
+}
+
+func (d *differ) add(path string, old, new any) {
+	d.diff = append(d.diff, Change{Path: path, Old: old, New: new})
+}
+
+// elem dereferences a pointer to a struct, a nil pointer being the zero
+// struct so that each of its fields is reported.
+func elem(v reflect.Value) reflect.Value {
+	if v.IsNil() {
+		return reflect.Zero(v.Type().Elem())
+	}
+	return v.Elem()
+}
+
+func pointerValue(v reflect.Value) any {
+	if v.IsNil() {
+		return nil
+	}
+	return v.Elem().Interface()
+}
+
+// optionValue unwraps an option, which is a slice of at most one value.
+func optionValue(v reflect.Value) any {
+	if v.Len() == 0 {
+		return nil
+	}
+	return v.Index(0).Interface()
+}
+
+// fieldName is the json name of an exported field, or its field name if
+// it has none. Unexported and ignored fields have no name.
+func fieldName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	switch tag {
+	case "-":
+		return ""
+	case "":
+		return f.Name
+	default:
+		return tag
+	}
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
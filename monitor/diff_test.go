@@ -0,0 +1,167 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	mqtt "github.com/evanofslack/bambulab-client/mqtt"
+	opt "github.com/moznion/go-optional"
+	"github.com/stretchr/testify/assert"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestState_Diff(t *testing.T) {
+	base := State{
+		Bed:   Bed{Temperature: opt.Some(60.0), TemperatureTarget: opt.Some(60)},
+		Gcode: Gcode{State: opt.Some("RUNNING")},
+		Hms:   []Hms{},
+	}
+
+	tests := []struct {
+		name   string
+		change func(s *State)
+		diff   Diff
+	}{
+		{
+			name:   "equal",
+			change: func(s *State) {},
+		},
+		{
+			name:   "value",
+			change: func(s *State) { s.Bed.Temperature = opt.Some(61.5) },
+			diff:   Diff{{Path: "Bed.Temperature", Old: 60.0, New: 61.5}},
+		},
+		{
+			name:   "unset",
+			change: func(s *State) { s.Gcode.State = opt.None[string]() },
+			diff:   Diff{{Path: "Gcode.State", Old: "RUNNING", New: nil}},
+		},
+		{
+			name: "set",
+			change: func(s *State) {
+				s.Gcode.File = opt.Some("cube.gcode")
+				s.Wifi = opt.Some(-40.0)
+			},
+			diff: Diff{
+				{Path: "Gcode.File", Old: nil, New: "cube.gcode"},
+				{Path: "Wifi", Old: nil, New: -40.0},
+			},
+		},
+		{
+			name:   "empty slice",
+			change: func(s *State) { s.Hms = nil },
+		},
+		{
+			name:   "slice",
+			change: func(s *State) { s.Hms = []Hms{{Attr: 1, Code: 2}} },
+			diff:   Diff{{Path: "Hms", Old: []Hms{}, New: []Hms{{Attr: 1, Code: 2}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := base
+			tt.change(&other)
+			assert.Equal(t, tt.diff, base.Diff(other))
+		})
+	}
+}
+
+func TestDiffMessages(t *testing.T) {
+	old := mqtt.Message{Print: &mqtt.Print{BedTemper: ptr(60.0), GcodeState: ptr("IDLE")}}
+	new := mqtt.Message{Print: &mqtt.Print{BedTemper: ptr(60.0), McPercent: ptr(10)}}
+
+	expected := Diff{
+		{Path: "print.gcode_state", Old: "IDLE", New: nil},
+		{Path: "print.mc_percent", Old: nil, New: 10},
+	}
+	assert.Equal(t, expected, DiffMessages(old, new))
+	assert.Empty(t, DiffMessages(old, old))
+	assert.Equal(t, Diff{{Path: "print.gcode_state", Old: nil, New: "IDLE"}}, DiffMessages(mqtt.Message{}, mqtt.Message{Print: &mqtt.Print{GcodeState: ptr("IDLE")}}))
+}
+
+func TestDiffMessage_Partial(t *testing.T) {
+	og := &mqtt.Message{Print: &mqtt.Print{
+		BedTemper:  ptr(60.0),
+		GcodeState: ptr("IDLE"),
+		Ipcam:      &mqtt.Ipcam{IpcamRecord: ptr("enable")},
+	}}
+
+	tests := []struct {
+		name string
+		in   *mqtt.Message
+		diff Diff
+	}{
+		{name: "nil", in: nil},
+		{name: "empty", in: &mqtt.Message{}},
+		{name: "same", in: &mqtt.Message{Print: &mqtt.Print{BedTemper: ptr(60.0)}}},
+		{
+			name: "changed",
+			in:   &mqtt.Message{Print: &mqtt.Print{BedTemper: ptr(65.0)}},
+			diff: Diff{{Path: "print.bed_temper", Old: 60.0, New: 65.0}},
+		},
+		{
+			name: "nested",
+			in:   &mqtt.Message{Print: &mqtt.Print{Ipcam: &mqtt.Ipcam{Timelapse: ptr("disable")}}},
+			diff: Diff{{Path: "print.ipcam.timelapse", Old: nil, New: "disable"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.diff, diffMessage(og, tt.in))
+		})
+	}
+}
+
+func TestDiff_Helpers(t *testing.T) {
+	d := Diff{
+		{Path: "Bed.Temperature", Old: 60.0, New: 61.0},
+		{Path: "Bed.TemperatureTarget", Old: 60, New: 65},
+		{Path: "Gcode.State", Old: "IDLE", New: "RUNNING"},
+	}
+
+	assert.True(t, d.Changed("Bed"))
+	assert.True(t, d.Changed("Bed.Temperature"))
+	assert.False(t, d.Changed("Bed.Temp"))
+	assert.False(t, d.Changed("Nozzle"))
+
+	c, ok := d.Get("Gcode.State")
+	assert.True(t, ok)
+	assert.Equal(t, "RUNNING", c.New)
+	_, ok = d.Get("Bed")
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"Bed.Temperature", "Bed.TemperatureTarget"}, d.Filter("Bed").Paths())
+	assert.Equal(t, []string{"Bed.TemperatureTarget", "Gcode.State"}, d.Filter("Gcode", "Bed.TemperatureTarget").Paths())
+	assert.Empty(t, d.Filter("Fans"))
+}
+
+func TestMonitor_EventDiff(t *testing.T) {
+	m := New()
+	defer m.Stop()
+	events := m.Subscribe(10)
+	msgs := make(chan mqtt.Message)
+	go m.Start(msgs)
+
+	msgs <- mqtt.Message{Print: &mqtt.Print{GcodeState: ptr("IDLE"), BedTemper: ptr(25.0)}}
+	msgs <- mqtt.Message{Print: &mqtt.Print{BedTemper: ptr(40.0)}}
+
+	next := func() Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("no event")
+			return Event{}
+		}
+	}
+	first := next()
+	assert.True(t, first.Diff.Changed("Gcode.State"))
+	assert.Equal(t, []string{"print.bed_temper", "print.gcode_state"}, first.MessageDiff.Paths())
+
+	second := next()
+	assert.Equal(t, Diff{{Path: "Bed.Temperature", Old: 25.0, New: 40.0}}, second.Diff)
+	assert.Equal(t, Diff{{Path: "print.bed_temper", Old: 25.0, New: 40.0}}, second.MessageDiff)
+}
@@ -0,0 +1,120 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType identifies what happened to a printer.
+type EventType int
+
+const (
+	EventUpdate EventType = iota
+	EventPrintStarted
+	EventPrintFinished
+	EventPrintCancelled
+	EventPrintFailed
+	EventStateStale
+	EventStateFresh
+)
+
+func (e EventType) String() string {
+	switch e {
+	case EventUpdate:
+		return "update"
+	case EventPrintStarted:
+		return "print_started"
+	case EventPrintFinished:
+		return "print_finished"
+	case EventPrintCancelled:
+		return "print_cancelled"
+	case EventPrintFailed:
+		return "print_failed"
+	case EventStateStale:
+		return "state_stale"
+	case EventStateFresh:
+		return "state_fresh"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is emitted to subscribers whenever the monitor signals a change.
+// Diff lists the state fields changed since the previous state and
+// MessageDiff the raw message fields changed by the report.
+type Event struct {
+	Type        EventType
+	Time        time.Time
+	State       State
+	Diff        Diff
+	MessageDiff Diff
+}
+
+// subscribers fans events out to any number of buffered channels.
+type subscribers struct {
+	mu     sync.RWMutex
+	chans  map[<-chan Event]chan Event
+	closed bool
+}
+
+func newSubscribers() *subscribers {
+	s := &subscribers{
+		chans: make(map[<-chan Event]chan Event),
+	}
+	return s
+}
+
+func (s *subscribers) add(size int) <-chan Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch := make(chan Event, size)
+	if s.closed {
+		close(ch)
+		return ch
+	}
+	s.chans[ch] = ch
+	return ch
+}
+
+func (s *subscribers) remove(ch <-chan Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.chans[ch]; ok {
+		delete(s.chans, ch)
+		close(c)
+	}
+}
+
+// emit delivers the event to every subscriber with room in its buffer.
+func (s *subscribers) emit(e Event) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range s.chans {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
+
+func (s *subscribers) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch, c := range s.chans {
+		delete(s.chans, ch)
+		close(c)
+	}
+	s.closed = true
+}
+
+// Subscribe returns a channel receiving every event emitted by the monitor.
+// The channel holds up to size events, further events are dropped until the
+// subscriber catches up. The channel is closed on Unsubscribe or Stop.
+func (m *Monitor) Subscribe(size int) <-chan Event {
+	return m.subscribers.add(size)
+}
+
+// Unsubscribe stops delivery of events to the channel and closes it.
+func (m *Monitor) Unsubscribe(ch <-chan Event) {
+	m.subscribers.remove(ch)
+}
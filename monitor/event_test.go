@@ -0,0 +1,74 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonitor_Subscribe(t *testing.T) {
+	monitor := New()
+	events := monitor.Subscribe(10)
+	other := monitor.Subscribe(10)
+
+	monitor.handleChange(&msgIdle, nil)
+	monitor.handleChange(&msgRunning, nil)
+
+	expected := []EventType{EventUpdate, EventUpdate, EventPrintStarted}
+	for _, ch := range []<-chan Event{events, other} {
+		for _, typ := range expected {
+			e := <-ch
+			assert.Equal(t, typ, e.Type)
+		}
+	}
+
+	monitor.Unsubscribe(other)
+	_, ok := <-other
+	assert.False(t, ok)
+
+	monitor.Stop()
+	_, ok = <-events
+	assert.False(t, ok)
+}
+
+func TestMonitor_SubscribeDropsWhenFull(t *testing.T) {
+	monitor := New()
+	defer monitor.Stop()
+	events := monitor.Subscribe(1)
+
+	monitor.handleChange(&msgIdle, nil)
+	monitor.handleChange(&msgRunning, nil)
+
+	e := <-events
+	assert.Equal(t, "IDLE", e.State.Gcode.State.Unwrap())
+	select {
+	case e := <-events:
+		t.Errorf("expected no more events, got %s", e.Type)
+	default:
+	}
+}
+
+func TestMonitor_CancelEvents(t *testing.T) {
+	monitor := New()
+	defer monitor.Stop()
+	events := monitor.Subscribe(10)
+
+	cancel := newCancelReportMsg()
+	monitor.handleChange(&msgRunning, nil)
+	monitor.handleChange(&cancel, nil)
+
+	expected := []EventType{EventUpdate, EventUpdate, EventPrintCancelled}
+	for _, typ := range expected {
+		assert.Equal(t, typ, (<-events).Type)
+	}
+	select {
+	case e := <-events:
+		t.Errorf("expected no more events, got %s", e.Type)
+	default:
+	}
+}
+
+func TestEventType_String(t *testing.T) {
+	assert.Equal(t, "print_finished", EventPrintFinished.String())
+	assert.Equal(t, "unknown", EventType(-1).String())
+}
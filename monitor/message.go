@@ -109,6 +109,26 @@ func mergeIpcam(og *mqtt.Ipcam, in *mqtt.Ipcam) (*mqtt.Ipcam, bool) {
 			changed = true
 		}
 	}
+	if in.TutkServer != nil {
+		if og.TutkServer == nil {
+			og.TutkServer = new(string)
+			changed = true
+		}
+		if *og.TutkServer != *in.TutkServer {
+			og.TutkServer = in.TutkServer
+			changed = true
+		}
+	}
+	if in.ModeBits != nil {
+		if og.ModeBits == nil {
+			og.ModeBits = new(int)
+			changed = true
+		}
+		if *og.ModeBits != *in.ModeBits {
+			og.ModeBits = in.ModeBits
+			changed = true
+		}
+	}
 	return og, changed
 }
 
@@ -116,6 +116,25 @@ func TestMergeIpcam(t *testing.T) {
 	}
 }
 
+func TestMergeIpcamTutkServerModeBits(t *testing.T) {
+	modeBits := func(i int) *int {
+		return &i
+	}
+	og := &mqtt.Ipcam{TutkServer: strPtr("disable"), ModeBits: modeBits(2)}
+
+	og, changed := mergeIpcam(og, &mqtt.Ipcam{TutkServer: strPtr("enable")})
+	assert.True(t, changed)
+	assert.Equal(t, "enable", *og.TutkServer)
+	assert.Equal(t, 2, *og.ModeBits)
+
+	og, changed = mergeIpcam(og, &mqtt.Ipcam{ModeBits: modeBits(3)})
+	assert.True(t, changed)
+	assert.Equal(t, 3, *og.ModeBits)
+
+	_, changed = mergeIpcam(og, &mqtt.Ipcam{TutkServer: strPtr("enable"), ModeBits: modeBits(3)})
+	assert.False(t, changed)
+}
+
 func TestMergeUpload(t *testing.T) {
 	// Helper function to create a pointer to a string
 	strPtr := func(s string) *string {
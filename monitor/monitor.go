@@ -2,6 +2,7 @@ package monitor
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	mqtt "github.com/evanofslack/bambulab-client/mqtt"
@@ -17,17 +18,46 @@ type Monitor struct {
 	PrintFailed chan struct{}
 	messageHistory *messageHistory
 	stateHistory   *stateHistory
+	series         *Series
+	counters       Counters
+	subscribers    *subscribers
+	staleTimeout   time.Duration
+	onStale        func()
+	lastReport     time.Time
+	mu             sync.RWMutex
 	ctx            context.Context
 	cancel         context.CancelFunc
 }
 
+// Counters are running totals of events seen since the monitor was created.
+type Counters struct {
+	PrintsStarted   uint64
+	PrintsFinished  uint64
+	PrintsFailed    uint64
+	PrintsCancelled uint64
+	HmsErrors       uint64
+}
+
+// Option configures a monitor
+type Option func(*Monitor)
+
+// WithSeriesCapacity sets how many samples the monitor keeps in its series.
+// A capacity of zero disables sampling.
+func WithSeriesCapacity(capacity int) Option {
+	return func(m *Monitor) {
+		m.series = NewSeries(capacity)
+	}
+}
+
 // New creates a new monitor
-func New() *Monitor {
+func New(opts ...Option) *Monitor {
 	ctx, cancel := context.WithCancel(context.Background())
 	m := &Monitor{
 		Update:         make(chan struct{}),
 		messageHistory: newMessageHistory(),
 		stateHistory:   newStateHistory(),
+		series:         NewSeries(defaultSeriesCapacity),
+		subscribers:    newSubscribers(),
 		PrintStarted:   make(chan struct{}),
 		PrintFinished:  make(chan struct{}),
 		PrintCancelled: make(chan struct{}),
@@ -35,11 +65,22 @@ func New() *Monitor {
 		ctx:            ctx,
 		cancel:         cancel,
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
 	return m
 }
 
 // Start starts the monitor updating from the incoming messages
 func (m *Monitor) Start(msgs <-chan mqtt.Message) {
+	m.mu.Lock()
+	m.lastReport = time.Now()
+	m.mu.Unlock()
+	if m.staleTimeout > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go m.watch(done)
+	}
 	for {
 		select {
 		case <-m.ctx.Done():
@@ -48,9 +89,19 @@ func (m *Monitor) Start(msgs <-chan mqtt.Message) {
 			if !ok {
 				return
 			}
+			now := time.Now()
+			m.mu.Lock()
+			if state, wasStale := m.reported(now); wasStale {
+				m.mu.Unlock()
+				m.subscribers.emit(Event{Type: EventStateFresh, Time: now, State: state, Diff: Diff{{Path: "Stale", Old: true, New: false}}})
+				m.mu.Lock()
+			}
+			// Diff before merging, the current message is merged in place
+			msgDiff := diffMessage(m.messageHistory.current, &msg)
 			newMsg, changed := mergeMessage(m.messageHistory.current, &msg)
+			m.mu.Unlock()
 			if changed {
-				m.handleChange(newMsg)
+				m.handleChange(newMsg, msgDiff)
 			}
 		}
 	}
@@ -59,30 +110,52 @@ func (m *Monitor) Start(msgs <-chan mqtt.Message) {
 // CurrentMessage is the current mqtt message in its raw form,
 // same form as it comes from mqtt messages.
 func (m *Monitor) CurrentMessage() mqtt.Message {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return *m.messageHistory.current
 }
 
 // PreviousMessage is the previous mqtt message in its raw form,
 // same form as it comes from mqtt messages.
 func (m *Monitor) PreviousMessage() mqtt.Message {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return *m.messageHistory.previous
 }
 
 // CurrentState is the current interpreted state
 func (m *Monitor) CurrentState() State {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return m.stateHistory.current
 }
 
 // PreviousState is the previous interpreted state
 func (m *Monitor) PreviousState() State {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return m.stateHistory.previous
 }
 
+// Counters are the running totals of print events and hms errors
+func (m *Monitor) Counters() Counters {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.counters
+}
+
+// Series is the timeseries of samples taken on each state change
+func (m *Monitor) Series() *Series {
+	return m.series
+}
+
 func (m *Monitor) Stop() {
 	m.cancel()
+	m.subscribers.close()
 }
 
-func (m *Monitor) handleChange(newMsg *mqtt.Message) {
+func (m *Monitor) handleChange(newMsg *mqtt.Message, msgDiff Diff) {
+	m.mu.Lock()
 	m.LastUpdate = time.Now()
 	// Update history
 	m.messageHistory.previous = m.messageHistory.current
@@ -92,6 +165,16 @@ func (m *Monitor) handleChange(newMsg *mqtt.Message) {
 	newState := stateFromMessage(newMsg)
 	m.stateHistory.previous = m.stateHistory.current
 	m.stateHistory.current = newState
+	diff := m.stateHistory.previous.Diff(newState)
+	m.series.Add(sampleFromState(m.LastUpdate, newState))
+	curr, prev := m.stateHistory.current, m.stateHistory.previous
+	events := eventsFromChange(curr, prev)
+	m.updateCounters(events, curr, prev)
+	m.mu.Unlock()
+
+	for _, t := range events {
+		m.subscribers.emit(Event{Type: t, Time: m.LastUpdate, State: newState, Diff: diff, MessageDiff: msgDiff})
+	}
 
 	select {
 	case <-m.ctx.Done():
@@ -100,7 +183,7 @@ func (m *Monitor) handleChange(newMsg *mqtt.Message) {
 	default:
 	}
 
-	if isPrintStarted(m.stateHistory.current, m.stateHistory.previous) {
+	if isPrintStarted(curr, prev) {
 		select {
 		case <-m.ctx.Done():
 			return
@@ -108,7 +191,7 @@ func (m *Monitor) handleChange(newMsg *mqtt.Message) {
 		default:
 		}
 	}
-	if isPrintFinished(m.stateHistory.current, m.stateHistory.previous) {
+	if isPrintFinished(curr, prev) {
 		select {
 		case <-m.ctx.Done():
 			return
@@ -116,7 +199,7 @@ func (m *Monitor) handleChange(newMsg *mqtt.Message) {
 		default:
 		}
 	}
-	if isPrintCancelled(m.stateHistory.current) {
+	if isPrintCancelled(curr) {
 		select {
 		case <-m.ctx.Done():
 			return
@@ -124,7 +207,7 @@ func (m *Monitor) handleChange(newMsg *mqtt.Message) {
 		default:
 		}
 	}
-	if isPrintFailed(m.stateHistory.current, m.stateHistory.previous) {
+	if isPrintFailed(curr, prev) {
 		select {
 		case <-m.ctx.Done():
 			return
@@ -134,6 +217,42 @@ func (m *Monitor) handleChange(newMsg *mqtt.Message) {
 	}
 }
 
+func (m *Monitor) updateCounters(events []EventType, curr, prev State) {
+	for _, e := range events {
+		switch e {
+		case EventPrintStarted:
+			m.counters.PrintsStarted++
+		case EventPrintFinished:
+			m.counters.PrintsFinished++
+		case EventPrintCancelled:
+			m.counters.PrintsCancelled++
+		case EventPrintFailed:
+			m.counters.PrintsFailed++
+		}
+	}
+	m.counters.HmsErrors += uint64(len(newHms(curr.Hms, prev.Hms)))
+}
+
+// eventsFromChange lists the events caused by a state change, always
+// starting with an update.
+func eventsFromChange(curr, prev State) []EventType {
+	events := []EventType{EventUpdate}
+	if isPrintStarted(curr, prev) {
+		events = append(events, EventPrintStarted)
+	}
+	if isPrintFinished(curr, prev) {
+		events = append(events, EventPrintFinished)
+	}
+	if isPrintCancelled(curr) && !isPrintCancelled(prev) {
+		events = append(events, EventPrintCancelled)
+	}
+	// A cancelled print is reported as failed with the cancel error
+	if isPrintFailed(curr, prev) && !isPrintCancelled(curr) {
+		events = append(events, EventPrintFailed)
+	}
+	return events
+}
+
 func isPrintStarted(curr, prev State) bool {
 	if curr.Gcode.State.IsNone() || prev.Gcode.State.IsNone() {
 		return false
@@ -186,6 +305,23 @@ func isPrintFailed(curr, prev State) bool {
 	return finished
 }
 
+// newHms returns the hms messages in curr that were not in prev
+func newHms(curr, prev []Hms) []Hms {
+	added := []Hms{}
+	for _, c := range curr {
+		seen := false
+		for _, p := range prev {
+			if c == p {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			added = append(added, c)
+		}
+	}
+	return added
+}
 
 type messageHistory struct {
 	current  *mqtt.Message
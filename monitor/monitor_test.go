@@ -7,6 +7,7 @@ import (
 	"time"
 
 	mqtt "github.com/evanofslack/bambulab-client/mqtt"
+	opt "github.com/moznion/go-optional"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -63,11 +64,11 @@ func TestMonitor_HandleChange(t *testing.T) {
 	msg2 := newStateMsg(state2)
 
 	// Simulate change in message.
-	monitor.handleChange(&msg1)
+	monitor.handleChange(&msg1, nil)
 	assert.Equal(t, state1, *monitor.messageHistory.current.Print.GcodeState)
 
 	// Simulate another change in message.
-	monitor.handleChange(&msg2)
+	monitor.handleChange(&msg2, nil)
 	assert.Equal(t, state2, *monitor.messageHistory.current.Print.GcodeState)
 	assert.Equal(t, state1, *monitor.messageHistory.previous.Print.GcodeState)
 }
@@ -115,8 +116,8 @@ func TestMonitor_PrintStart(t *testing.T) {
 		t.Error(err)
 	}
 	// Simulate print start.
-	monitor.handleChange(&msgIdle)    // Initial state.
-	monitor.handleChange(&msgRunning) // Transition to running.
+	monitor.handleChange(&msgIdle, nil)    // Initial state.
+	monitor.handleChange(&msgRunning, nil) // Transition to running.
 	wg.Wait()
 }
 
@@ -148,7 +149,7 @@ func TestMonitor_PrintFinish(t *testing.T) {
 		t.Error(err)
 	}
 	// Simulate print finish.
-	monitor.handleChange(&msgFinished)
+	monitor.handleChange(&msgFinished, nil)
 	wg.Wait()
 }
 
@@ -180,7 +181,7 @@ func TestMonitor_PrintCancel(t *testing.T) {
 		t.Error(err)
 	}
 	// Simulate print cancellation.
-	monitor.handleChange(&msgCancelled)
+	monitor.handleChange(&msgCancelled, nil)
 
 	wg.Wait()
 }
@@ -213,11 +214,91 @@ func TestMonitor_PrintFail(t *testing.T) {
 		t.Error(err)
 	}
 	// Simulate print cancellation.
-	monitor.handleChange(&msgFailed)
+	monitor.handleChange(&msgFailed, nil)
 
 	wg.Wait()
 }
 
+func TestMonitor_Counters(t *testing.T) {
+	monitor := New()
+	defer monitor.Stop()
+
+	hms := []any{map[string]any{"attr": float64(50331904), "code": float64(65543)}}
+	msgHms := mqtt.Message{Print: &mqtt.Print{Hms: &hms}}
+
+	monitor.handleChange(&msgIdle, nil)
+	monitor.handleChange(&msgRunning, nil)
+	monitor.handleChange(&msgHms, nil)
+	monitor.handleChange(&msgHms, nil)
+	monitor.handleChange(&msgFinished, nil)
+	monitor.handleChange(&msgCancelled, nil)
+	monitor.handleChange(&msgCancelled, nil)
+
+	counters := monitor.Counters()
+	assert.Equal(t, uint64(1), counters.PrintsStarted)
+	assert.Equal(t, uint64(1), counters.PrintsFinished)
+	assert.Equal(t, uint64(1), counters.PrintsCancelled)
+	assert.Equal(t, uint64(0), counters.PrintsFailed)
+	assert.Equal(t, uint64(1), counters.HmsErrors)
+}
+
+func TestMonitor_CountersCancelReport(t *testing.T) {
+	monitor := New()
+	defer monitor.Stop()
+
+	cancel := newCancelReportMsg()
+	monitor.handleChange(&msgIdle, nil)
+	monitor.handleChange(&msgRunning, nil)
+	monitor.handleChange(&cancel, nil)
+
+	assert.Equal(t, Counters{PrintsStarted: 1, PrintsCancelled: 1}, monitor.Counters())
+}
+
+func TestHms_ErrorCode(t *testing.T) {
+	hms := Hms{Attr: 50331904, Code: 65543}
+	assert.Equal(t, "0300_0100_0001_0007", hms.ErrorCode())
+}
+
+func TestInterpretCamera(t *testing.T) {
+	modeBits := 3
+	camera := interpretCamera(&mqtt.Ipcam{
+		IpcamDev:    strPtr("1"),
+		IpcamRecord: strPtr("enable"),
+		Resolution:  strPtr("1080p"),
+		Timelapse:   strPtr("disable"),
+		TutkServer:  strPtr("enable"),
+		ModeBits:    &modeBits,
+	})
+	assert.Equal(t, "1", camera.Device.Unwrap())
+	assert.True(t, camera.Recording.Unwrap())
+	assert.Equal(t, "1080p", camera.Resolution.Unwrap())
+	assert.False(t, camera.Timelapse.Unwrap())
+	assert.True(t, camera.TutkServer.Unwrap())
+	assert.Equal(t, 3, camera.ModeBits.Unwrap())
+}
+
+func TestInterpretCurrentPrintStage(t *testing.T) {
+	tests := []struct {
+		stage *int
+		name  opt.Option[string]
+	}{
+		{stage: nil, name: opt.None[string]()},
+		{stage: ptr(2), name: opt.Some("heatbed_preheating")},
+		{stage: ptr(255), name: opt.Some("idle")},
+		{stage: ptr(999), name: opt.None[string]()},
+	}
+	for _, tt := range tests {
+		c := interpretCurrentPrint(&mqtt.Print{StgCur: tt.stage})
+		assert.Equal(t, opt.FromNillable(tt.stage), c.Stage)
+		assert.Equal(t, tt.name, c.StageName)
+	}
+}
+
+func TestInterpretAmsTrayType(t *testing.T) {
+	trays := interpretAmsTray(&[]mqtt.Tray{{TrayType: strPtr("PETG")}})
+	assert.Equal(t, "PETG", trays[0].Type.Unwrap())
+}
+
 func signalReady(ctx context.Context, r chan struct{}) error {
 	select {
 	case <-ctx.Done():
@@ -246,6 +327,13 @@ func newStateMsg(state string) mqtt.Message {
 	return msg
 }
 
+// newCancelReportMsg is a cancel as reported by the printer.
+func newCancelReportMsg() mqtt.Message {
+	state := stateFailed
+	e := 50348044
+	return mqtt.Message{Print: &mqtt.Print{GcodeState: &state, PrintError: &e}}
+}
+
 func newCancelMsg() mqtt.Message {
 	e := 50348044
 	msg := mqtt.Message{
@@ -0,0 +1,182 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	opt "github.com/moznion/go-optional"
+)
+
+const defaultSeriesCapacity = 3600
+
+// Sample is a timestamped reading of the values that change over a print.
+type Sample struct {
+	Time                    time.Time
+	BedTemperature          opt.Option[float64]
+	BedTemperatureTarget    opt.Option[int]
+	ChamberTemperature      opt.Option[int]
+	NozzleTemperature       opt.Option[float64]
+	NozzleTemperatureTarget opt.Option[int]
+	FanAuxilliary           opt.Option[float64]
+	FanChamber              opt.Option[float64]
+	FanPart                 opt.Option[float64]
+	FanHotend               opt.Option[float64]
+	Percent                 opt.Option[int]
+	LayerNumber             opt.Option[int]
+}
+
+func sampleFromState(t time.Time, s State) Sample {
+	return Sample{
+		Time:                    t,
+		BedTemperature:          s.Bed.Temperature,
+		BedTemperatureTarget:    s.Bed.TemperatureTarget,
+		ChamberTemperature:      s.Chamber.Temperature,
+		NozzleTemperature:       s.Nozzle.Temperature,
+		NozzleTemperatureTarget: s.Nozzle.TemperatureTarget,
+		FanAuxilliary:           s.Fans.Auxilliary,
+		FanChamber:              s.Fans.Chamber,
+		FanPart:                 s.Fans.Part,
+		FanHotend:               s.Fans.Hotend,
+		Percent:                 s.CurrentPrint.Percent,
+		LayerNumber:             s.CurrentPrint.LayerNumber,
+	}
+}
+
+// Series is a fixed size ring buffer of samples, oldest first.
+// Once full, adding a sample overwrites the oldest one.
+type Series struct {
+	mu      sync.RWMutex
+	samples []Sample
+	start   int
+	size    int
+}
+
+// NewSeries creates a series holding at most capacity samples.
+func NewSeries(capacity int) *Series {
+	if capacity < 0 {
+		capacity = 0
+	}
+	s := &Series{
+		samples: make([]Sample, capacity),
+	}
+	return s
+}
+
+// Add appends a sample to the series. Samples are expected in time order.
+func (s *Series) Add(sample Sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.samples) == 0 {
+		return
+	}
+	end := (s.start + s.size) % len(s.samples)
+	s.samples[end] = sample
+	if s.size < len(s.samples) {
+		s.size++
+	} else {
+		s.start = (s.start + 1) % len(s.samples)
+	}
+}
+
+// Len is the number of samples held.
+func (s *Series) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.size
+}
+
+// Capacity is the maximum number of samples held.
+func (s *Series) Capacity() int {
+	return len(s.samples)
+}
+
+// All returns every sample held, oldest first.
+func (s *Series) All() []Sample {
+	return s.Range(time.Time{}, time.Time{})
+}
+
+// Range returns samples with times between from and to inclusive, oldest first.
+// A zero from or to leaves that end of the range open.
+func (s *Series) Range(from, to time.Time) []Sample {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Sample{}
+	for i := 0; i < s.size; i++ {
+		sample := s.samples[(s.start+i)%len(s.samples)]
+		if !from.IsZero() && sample.Time.Before(from) {
+			continue
+		}
+		if !to.IsZero() && sample.Time.After(to) {
+			break
+		}
+		out = append(out, sample)
+	}
+	return out
+}
+
+// Downsample returns samples between from and to grouped into buckets of
+// the given interval. Each bucket is stamped with its start time, floating
+// point values are averaged and whole number values take the last reading.
+func (s *Series) Downsample(from, to time.Time, interval time.Duration) []Sample {
+	samples := s.Range(from, to)
+	if interval <= 0 {
+		return samples
+	}
+	out := []Sample{}
+	var bucket []Sample
+	var bucketStart time.Time
+	for _, sample := range samples {
+		start := sample.Time.Truncate(interval)
+		if len(bucket) > 0 && !start.Equal(bucketStart) {
+			out = append(out, mergeSamples(bucketStart, bucket))
+			bucket = bucket[:0]
+		}
+		bucketStart = start
+		bucket = append(bucket, sample)
+	}
+	if len(bucket) > 0 {
+		out = append(out, mergeSamples(bucketStart, bucket))
+	}
+	return out
+}
+
+func mergeSamples(t time.Time, samples []Sample) Sample {
+	merged := Sample{
+		Time:                    t,
+		BedTemperatureTarget:    lastSome(samples, func(s Sample) opt.Option[int] { return s.BedTemperatureTarget }),
+		ChamberTemperature:      lastSome(samples, func(s Sample) opt.Option[int] { return s.ChamberTemperature }),
+		NozzleTemperatureTarget: lastSome(samples, func(s Sample) opt.Option[int] { return s.NozzleTemperatureTarget }),
+		Percent:                 lastSome(samples, func(s Sample) opt.Option[int] { return s.Percent }),
+		LayerNumber:             lastSome(samples, func(s Sample) opt.Option[int] { return s.LayerNumber }),
+		BedTemperature:          mean(samples, func(s Sample) opt.Option[float64] { return s.BedTemperature }),
+		NozzleTemperature:       mean(samples, func(s Sample) opt.Option[float64] { return s.NozzleTemperature }),
+		FanAuxilliary:           mean(samples, func(s Sample) opt.Option[float64] { return s.FanAuxilliary }),
+		FanChamber:              mean(samples, func(s Sample) opt.Option[float64] { return s.FanChamber }),
+		FanPart:                 mean(samples, func(s Sample) opt.Option[float64] { return s.FanPart }),
+		FanHotend:               mean(samples, func(s Sample) opt.Option[float64] { return s.FanHotend }),
+	}
+	return merged
+}
+
+func lastSome[T any](samples []Sample, get func(Sample) opt.Option[T]) opt.Option[T] {
+	for i := len(samples) - 1; i >= 0; i-- {
+		if v := get(samples[i]); v.IsSome() {
+			return v
+		}
+	}
+	return opt.None[T]()
+}
+
+func mean(samples []Sample, get func(Sample) opt.Option[float64]) opt.Option[float64] {
+	sum, n := 0.0, 0
+	for _, s := range samples {
+		if v := get(s); v.IsSome() {
+			sum += v.Unwrap()
+			n++
+		}
+	}
+	if n == 0 {
+		return opt.None[float64]()
+	}
+	return opt.Some(sum / float64(n))
+}
@@ -0,0 +1,119 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	mqtt "github.com/evanofslack/bambulab-client/mqtt"
+	opt "github.com/moznion/go-optional"
+	"github.com/stretchr/testify/assert"
+)
+
+var seriesBase = time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+
+func newSample(offset time.Duration, nozzle float64, percent int) Sample {
+	return Sample{
+		Time:              seriesBase.Add(offset),
+		NozzleTemperature: opt.Some(nozzle),
+		Percent:           opt.Some(percent),
+	}
+}
+
+func TestSeries_Add(t *testing.T) {
+	s := NewSeries(3)
+	for i := 0; i < 5; i++ {
+		s.Add(newSample(time.Duration(i)*time.Second, float64(i), i))
+	}
+	assert.Equal(t, 3, s.Len())
+	assert.Equal(t, 3, s.Capacity())
+
+	all := s.All()
+	assert.Len(t, all, 3)
+	assert.Equal(t, 2.0, all[0].NozzleTemperature.Unwrap())
+	assert.Equal(t, 4.0, all[2].NozzleTemperature.Unwrap())
+}
+
+func TestSeries_ZeroCapacity(t *testing.T) {
+	s := NewSeries(0)
+	s.Add(newSample(0, 1, 1))
+	assert.Equal(t, 0, s.Len())
+	assert.Empty(t, s.All())
+}
+
+func TestSeries_Range(t *testing.T) {
+	s := NewSeries(10)
+	for i := 0; i < 10; i++ {
+		s.Add(newSample(time.Duration(i)*time.Second, float64(i), i))
+	}
+
+	tests := []struct {
+		name     string
+		from     time.Time
+		to       time.Time
+		expected []int
+	}{
+		{
+			name:     "closed range",
+			from:     seriesBase.Add(2 * time.Second),
+			to:       seriesBase.Add(4 * time.Second),
+			expected: []int{2, 3, 4},
+		},
+		{
+			name:     "open start",
+			to:       seriesBase.Add(1 * time.Second),
+			expected: []int{0, 1},
+		},
+		{
+			name:     "open end",
+			from:     seriesBase.Add(8 * time.Second),
+			expected: []int{8, 9},
+		},
+		{
+			name:     "outside",
+			from:     seriesBase.Add(time.Minute),
+			expected: []int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []int{}
+			for _, sample := range s.Range(tt.from, tt.to) {
+				got = append(got, sample.Percent.Unwrap())
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestSeries_Downsample(t *testing.T) {
+	s := NewSeries(10)
+	s.Add(newSample(0, 10, 1))
+	s.Add(newSample(5*time.Second, 20, 2))
+	s.Add(newSample(10*time.Second, 30, 3))
+	s.Add(Sample{Time: seriesBase.Add(15 * time.Second)})
+
+	got := s.Downsample(time.Time{}, time.Time{}, 10*time.Second)
+	assert.Len(t, got, 2)
+
+	assert.Equal(t, seriesBase, got[0].Time)
+	assert.Equal(t, 15.0, got[0].NozzleTemperature.Unwrap())
+	assert.Equal(t, 2, got[0].Percent.Unwrap())
+
+	assert.Equal(t, seriesBase.Add(10*time.Second), got[1].Time)
+	assert.Equal(t, 30.0, got[1].NozzleTemperature.Unwrap())
+	assert.Equal(t, 3, got[1].Percent.Unwrap())
+	assert.True(t, got[1].BedTemperature.IsNone())
+}
+
+func TestMonitor_Series(t *testing.T) {
+	monitor := New(WithSeriesCapacity(2))
+	defer monitor.Stop()
+
+	for _, temp := range []float64{20, 40, 60} {
+		monitor.handleChange(&mqtt.Message{Print: &mqtt.Print{NozzleTemper: &temp}}, nil)
+	}
+	samples := monitor.Series().All()
+	assert.Len(t, samples, 2)
+	assert.Equal(t, 40.0, samples[0].NozzleTemperature.Unwrap())
+	assert.Equal(t, 60.0, samples[1].NozzleTemperature.Unwrap())
+}
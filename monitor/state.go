@@ -1,6 +1,7 @@
 package monitor
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 
@@ -17,6 +18,7 @@ type State struct {
 	CurrentPrint CurrentPrint
 	Fans         Fans
 	Gcode        Gcode
+	Hms          []Hms
 	Lights       Lights
 	Nozzle       Nozzle
 	Speed        Speed
@@ -26,6 +28,9 @@ type State struct {
 	ProjectID    opt.Option[string]
 	SDCard       opt.Option[bool]
 	Wifi         opt.Option[float64]
+	// Stale is set when no report has arrived within the stale timeout,
+	// see WithStaleTimeout
+	Stale bool
 }
 
 // Ams is AMS metadata
@@ -56,6 +61,7 @@ type AmsTray struct {
 	Remaining opt.Option[int]
 	TempMax   opt.Option[float64]
 	TempMin   opt.Option[float64]
+	Type      opt.Option[string]
 	Weight    opt.Option[float64]
 }
 
@@ -65,9 +71,12 @@ type Bed struct {
 }
 
 type Camera struct {
+	Device     opt.Option[string]
+	ModeBits   opt.Option[int]
 	Recording  opt.Option[bool]
 	Resolution opt.Option[string]
 	Timelapse  opt.Option[bool]
+	TutkServer opt.Option[bool]
 }
 
 type Chamber struct {
@@ -79,7 +88,11 @@ type CurrentPrint struct {
 	LayerNumberTarget opt.Option[int]
 	Percent           opt.Option[int]
 	PrintError        opt.Option[int]
+	Stage             opt.Option[int]
+	StageName         opt.Option[string]
 	Subtask           opt.Option[string]
+	SubtaskID         opt.Option[string]
+	TaskID            opt.Option[string]
 	TimeRemaining     opt.Option[int]
 }
 
@@ -95,6 +108,20 @@ type Gcode struct {
 	State opt.Option[string]
 }
 
+// Hms is a health management system message reported by the printer
+type Hms struct {
+	Attr int
+	Code int
+}
+
+// ErrorCode formats the message as shown in the Bambu Lab wiki,
+// e.g. 0300_0100_0001_0007
+func (h Hms) ErrorCode() string {
+	return fmt.Sprintf("%04X_%04X_%04X_%04X",
+		uint32(h.Attr)>>16, uint32(h.Attr)&0xFFFF,
+		uint32(h.Code)>>16, uint32(h.Code)&0xFFFF)
+}
+
 type Lights struct {
 	Chamber opt.Option[bool]
 }
@@ -142,6 +169,7 @@ func stateFromMessage(m *mqtt.Message) State {
 	s.CurrentPrint = interpretCurrentPrint(p)
 	s.Gcode = interpretGcode(p)
 	s.Fans = interpretFans(p)
+	s.Hms = interpretHms(p.Hms)
 	s.Lights = interpretLights(p)
 	s.Nozzle = interpretNozzle(p)
 	s.Speed = interpretSpeed(p)
@@ -202,6 +230,7 @@ func interpretAmsTray(ins *[]mqtt.Tray) []AmsTray {
 		tray.K = opt.FromNillable(in.K)
 		tray.Name = opt.FromNillable(in.TrayIDName)
 		tray.Remaining = opt.FromNillable(in.Remain)
+		tray.Type = opt.FromNillable(in.TrayType)
 		tray.TempMax = strToFloat(in.NozzleTempMax)
 		tray.TempMin = strToFloat(in.NozzleTempMin)
 		tray.Weight = strToFloat(in.TrayWeight)
@@ -225,9 +254,12 @@ func interpretCamera(c *mqtt.Ipcam) Camera {
 	if c == nil {
 		return camera
 	}
+	camera.Device = opt.FromNillable(c.IpcamDev)
+	camera.ModeBits = opt.FromNillable(c.ModeBits)
 	camera.Recording = enabledToBool(c.IpcamRecord)
 	camera.Resolution = opt.FromNillable(c.Resolution)
 	camera.Timelapse = enabledToBool(c.Timelapse)
+	camera.TutkServer = enabledToBool(c.TutkServer)
 	return camera
 }
 
@@ -249,11 +281,62 @@ func interpretCurrentPrint(p *mqtt.Print) CurrentPrint {
 	c.LayerNumberTarget = opt.FromNillable(p.TotalLayerNum)
 	c.Percent = opt.FromNillable(p.McPercent)
 	c.Subtask = opt.FromNillable(p.SubtaskName)
+	c.SubtaskID = opt.FromNillable(p.SubtaskID)
+	c.TaskID = opt.FromNillable(p.TaskID)
 	c.TimeRemaining = opt.FromNillable(p.McRemainingTime)
 	c.PrintError = opt.FromNillable(p.PrintError)
+	c.Stage = opt.FromNillable(p.StgCur)
+	c.StageName = opt.None[string]()
+	if c.Stage.IsSome() {
+		if name, ok := stageNames[c.Stage.Unwrap()]; ok {
+			c.StageName = opt.Some(name)
+		}
+	}
 	return c
 }
 
+// stageNames are the current stages (stg_cur) of a print
+var stageNames = map[int]string{
+	-1:  "idle",
+	0:   "printing",
+	1:   "auto_bed_leveling",
+	2:   "heatbed_preheating",
+	3:   "sweeping_xy_mech_mode",
+	4:   "changing_filament",
+	5:   "m400_pause",
+	6:   "paused_filament_runout",
+	7:   "heating_hotend",
+	8:   "calibrating_extrusion",
+	9:   "scanning_bed_surface",
+	10:  "inspecting_first_layer",
+	11:  "identifying_build_plate_type",
+	12:  "calibrating_micro_lidar",
+	13:  "homing_toolhead",
+	14:  "cleaning_nozzle_tip",
+	15:  "checking_extruder_temperature",
+	16:  "paused_user",
+	17:  "paused_front_cover_falling",
+	18:  "calibrating_micro_lidar",
+	19:  "calibrating_extrusion_flow",
+	20:  "paused_nozzle_temperature_malfunction",
+	21:  "paused_heat_bed_temperature_malfunction",
+	22:  "filament_unloading",
+	23:  "paused_skipped_step",
+	24:  "filament_loading",
+	25:  "calibrating_motor_noise",
+	26:  "paused_ams_lost",
+	27:  "paused_low_fan_speed_heat_break",
+	28:  "paused_chamber_temperature_control_error",
+	29:  "cooling_chamber",
+	30:  "paused_user_gcode",
+	31:  "motor_noise_showoff",
+	32:  "paused_nozzle_filament_covered_detected",
+	33:  "paused_cutter_error",
+	34:  "paused_first_layer_error",
+	35:  "paused_nozzle_clog",
+	255: "idle",
+}
+
 func interpretFans(p *mqtt.Print) Fans {
 	f := Fans{}
 	if p == nil {
@@ -276,6 +359,29 @@ func interpretGcode(p *mqtt.Print) Gcode {
 	return g
 }
 
+func interpretHms(in *[]any) []Hms {
+	hms := []Hms{}
+	if in == nil {
+		return hms
+	}
+	for _, raw := range *in {
+		entry, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		attr, ok := entry["attr"].(float64)
+		if !ok {
+			continue
+		}
+		code, ok := entry["code"].(float64)
+		if !ok {
+			continue
+		}
+		hms = append(hms, Hms{Attr: int(attr), Code: int(code)})
+	}
+	return hms
+}
+
 func interpretLights(p *mqtt.Print) Lights {
 	l := Lights{}
 	if p == nil {
@@ -401,9 +507,9 @@ func enabledToBool(in *string) opt.Option[bool] {
 		return opt.None[bool]()
 	}
 	switch strings.ToLower(*in) {
-	case "enabled":
+	case "enable", "enabled":
 		return opt.Some(true)
-	case "disabled":
+	case "disable", "disabled":
 		return opt.Some(false)
 	default:
 		return opt.None[bool]()
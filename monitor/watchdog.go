@@ -0,0 +1,107 @@
+package monitor
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultStaleTimeout is the stale timeout used by printers and fleets.
+	// They request a full report when stale, so a printer that is quiet
+	// but connected turns fresh again straight away
+	DefaultStaleTimeout = time.Minute
+
+	minWatchdogInterval = 10 * time.Millisecond
+)
+
+// WithStaleTimeout marks the state stale when no report has arrived for
+// the timeout, emitting EventStateStale, and fresh again with
+// EventStateFresh once reports resume. A timeout of zero, the default,
+// disables the watchdog.
+func WithStaleTimeout(timeout time.Duration) Option {
+	return func(m *Monitor) {
+		m.staleTimeout = timeout
+	}
+}
+
+// WithStaleHandler calls fn when the state goes stale, and again every
+// stale timeout while it stays stale, e.g. to request a full report.
+// fn runs in its own goroutine and is skipped while a call is running.
+func WithStaleHandler(fn func()) Option {
+	return func(m *Monitor) {
+		m.onStale = fn
+	}
+}
+
+// LastReport is when the last report arrived, whether or not it changed
+// the state. LastUpdate only moves when the state changes.
+func (m *Monitor) LastReport() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lastReport
+}
+
+// Stale reports whether no report has arrived within the stale timeout.
+func (m *Monitor) Stale() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.stateHistory.current.Stale
+}
+
+// watch marks the state stale when reports stop arriving, until done is
+// closed.
+func (m *Monitor) watch(done <-chan struct{}) {
+	interval := m.staleTimeout / 4
+	if interval < minWatchdogInterval {
+		interval = minWatchdogInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var requested time.Time
+	var handling atomic.Bool
+	for {
+		select {
+		case <-done:
+			return
+		case <-m.ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			stale := m.stateHistory.current.Stale
+			if stale && now.Sub(requested) < m.staleTimeout {
+				m.mu.Unlock()
+				continue
+			}
+			if !stale && now.Sub(m.lastReport) < m.staleTimeout {
+				m.mu.Unlock()
+				continue
+			}
+			m.stateHistory.current.Stale = true
+			state := m.stateHistory.current
+			m.mu.Unlock()
+
+			if !stale {
+				m.subscribers.emit(Event{Type: EventStateStale, Time: now, State: state, Diff: Diff{{Path: "Stale", Old: false, New: true}}})
+			}
+			requested = now
+			// A slow handler must not hold up detecting the next change
+			if m.onStale != nil && handling.CompareAndSwap(false, true) {
+				go func() {
+					defer handling.Store(false)
+					m.onStale()
+				}()
+			}
+		}
+	}
+}
+
+// reported records that a report arrived, returning the state if it was
+// stale until now. The lock must be held.
+func (m *Monitor) reported(now time.Time) (State, bool) {
+	m.lastReport = now
+	if !m.stateHistory.current.Stale {
+		return State{}, false
+	}
+	m.stateHistory.current.Stale = false
+	return m.stateHistory.current, true
+}
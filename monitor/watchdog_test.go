@@ -0,0 +1,107 @@
+package monitor
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mqtt "github.com/evanofslack/bambulab-client/mqtt"
+	"github.com/stretchr/testify/assert"
+)
+
+func nextEvent(t *testing.T, events <-chan Event, typ EventType) Event {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Type == typ {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("no %s event", typ)
+			return Event{}
+		}
+	}
+}
+
+func TestMonitor_Watchdog(t *testing.T) {
+	var requested atomic.Int32
+	monitor := New(WithStaleTimeout(50*time.Millisecond), WithStaleHandler(func() { requested.Add(1) }))
+	defer monitor.Stop()
+	events := monitor.Subscribe(10)
+
+	msgs := make(chan mqtt.Message, 1)
+	go monitor.Start(msgs)
+	msgs <- msgIdle
+	nextEvent(t, events, EventUpdate)
+	assert.False(t, monitor.Stale())
+	assert.False(t, monitor.LastReport().IsZero())
+
+	e := nextEvent(t, events, EventStateStale)
+	assert.True(t, e.State.Stale)
+	assert.Equal(t, Diff{{Path: "Stale", Old: false, New: true}}, e.Diff)
+	assert.True(t, monitor.Stale())
+	assert.True(t, monitor.CurrentState().Stale)
+	assert.Eventually(t, func() bool { return requested.Load() >= 1 }, time.Second, 10*time.Millisecond)
+
+	// The handler is called again while the state stays stale
+	assert.Eventually(t, func() bool { return requested.Load() >= 2 }, time.Second, 10*time.Millisecond)
+
+	// Any report makes the state fresh, even one without changes
+	msgs <- msgIdle
+	e = nextEvent(t, events, EventStateFresh)
+	assert.False(t, e.State.Stale)
+	assert.Equal(t, Diff{{Path: "Stale", Old: true, New: false}}, e.Diff)
+	assert.False(t, monitor.Stale())
+}
+
+func TestMonitor_WatchdogDisabled(t *testing.T) {
+	monitor := New()
+	defer monitor.Stop()
+	events := monitor.Subscribe(10)
+
+	msgs := make(chan mqtt.Message)
+	go monitor.Start(msgs)
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected %s event", e.Type)
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.False(t, monitor.Stale())
+}
+
+func TestEventType_StringStale(t *testing.T) {
+	assert.Equal(t, "state_stale", EventStateStale.String())
+	assert.Equal(t, "state_fresh", EventStateFresh.String())
+}
+
+func TestMonitor_WatchdogSlowHandler(t *testing.T) {
+	var calls, running atomic.Int32
+	release := make(chan struct{})
+	handler := func() {
+		calls.Add(1)
+		if running.Add(1) > 1 {
+			t.Error("concurrent stale handler calls")
+		}
+		<-release
+		running.Add(-1)
+	}
+	monitor := New(WithStaleTimeout(20*time.Millisecond), WithStaleHandler(handler))
+	defer monitor.Stop()
+	events := monitor.Subscribe(10)
+
+	msgs := make(chan mqtt.Message, 1)
+	go monitor.Start(msgs)
+	msgs <- msgIdle
+	nextEvent(t, events, EventStateStale)
+
+	// A blocked handler does not hold up the watchdog
+	msgs <- msgIdle
+	nextEvent(t, events, EventStateFresh)
+	nextEvent(t, events, EventStateStale)
+	assert.Equal(t, int32(1), calls.Load())
+
+	close(release)
+	assert.Eventually(t, func() bool { return calls.Load() >= 2 }, time.Second, 10*time.Millisecond)
+}
@@ -2,8 +2,13 @@ package mqtt
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -15,19 +20,80 @@ const (
 	defaultPort          = 8883
 	defaultProtocol      = "ssl"
 	defaultQos           = 1
+	subscribeTimeout     = 5 * time.Second
+)
+
+// Cloud broker endpoints for NewCloudClient
+const (
+	GlobalEndpoint = "us.mqtt.bambulab.com"
+	ChinaEndpoint  = "cn.mqtt.bambulab.com"
 )
 
 type Client struct {
 	mqtt     mqtt.Client
 	local    bool
+	host     string
+	password string
 	deviceId string
 	msgs     chan<- Message
+	onReport func(topic string, payload []byte)
+	sequence atomic.Uint64
+	// subscribed is closed once OnConnect has subscribed after Connect
+	subscribed chan struct{}
+	log        io.Writer
+	mu         sync.Mutex
+}
+
+// ClientOption configures how a Client connects.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	broker    string
+	tlsConfig *tls.Config
+	log       io.Writer
+}
+
+// WithBroker connects to the broker url, e.g. ssl://127.0.0.1:8883,
+// instead of the printer or cloud endpoint.
+func WithBroker(url string) ClientOption {
+	return func(o *clientOptions) {
+		o.broker = url
+	}
+}
+
+// WithTLSConfig sets the tls config used to connect. Local clients skip
+// verifying the certificate of the printer by default.
+func WithTLSConfig(cfg *tls.Config) ClientOption {
+	return func(o *clientOptions) {
+		o.tlsConfig = cfg
+	}
+}
+
+// WithLogOutput writes the logs of the client to w instead of stdout.
+func WithLogOutput(w io.Writer) ClientOption {
+	return func(o *clientOptions) {
+		o.log = w
+	}
 }
 
-func newClient(url, deviceId, username, password, clientId string, local bool) (*Client, error) {
+func newClient(host, deviceId, username, password, clientId string, local bool, options []ClientOption) (*Client, error) {
+	o := clientOptions{
+		broker: fmt.Sprintf("%s://%s:%d", defaultProtocol, host, defaultPort),
+		log:    os.Stdout,
+	}
+	if local {
+		// Printers present a self signed certificate
+		o.tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	for _, opt := range options {
+		opt(&o)
+	}
 	opts := mqtt.NewClientOptions()
-	opts.AddBroker(url)
+	opts.AddBroker(o.broker)
 	opts.SetClientID(clientId)
+	if o.tlsConfig != nil {
+		opts.SetTLSConfig(o.tlsConfig)
+	}
 
 	opts.SetOrderMatters(false)       // Allow out of order messages (use this option unless in order delivery is essential)
 	opts.ConnectTimeout = time.Second // Minimal delays on connect
@@ -41,69 +107,167 @@ func newClient(url, deviceId, username, password, clientId string, local bool) (
 	opts.SetUsername(username)
 	opts.SetPassword(password)
 
+	client := &Client{
+		local:    local,
+		host:     host,
+		password: password,
+		deviceId: deviceId,
+		log:      o.log,
+	}
+
 	// Log events
 	opts.OnConnectionLost = func(cl mqtt.Client, err error) {
-		fmt.Println("connection lost")
+		fmt.Fprintln(client.log, "connection lost")
 	}
 	opts.OnConnect = func(mqtt.Client) {
-		fmt.Println("connection established")
+		fmt.Fprintln(client.log, "connection established")
+		// Subscriptions do not survive a reconnect with a clean session
+		client.resubscribe()
+		client.mu.Lock()
+		if client.subscribed != nil {
+			close(client.subscribed)
+			client.subscribed = nil
+		}
+		client.mu.Unlock()
 	}
 	opts.OnReconnecting = func(mqtt.Client, *mqtt.ClientOptions) {
-		fmt.Println("attempting to reconnect")
+		fmt.Fprintln(client.log, "attempting to reconnect")
 	}
 
-	c := mqtt.NewClient(opts)
-
-	client := &Client{
-		mqtt:     c,
-		local:    local,
-		deviceId: deviceId,
-	}
+	client.mqtt = mqtt.NewClient(opts)
 	return client, nil
 }
 
 // NewLocalClient creates a new client connecting to local printer mqtt server
-func NewLocalClient(ip, deviceId, accessCode string) (*Client, error) {
-	url := fmt.Sprintf("%s://%s:%d", defaultProtocol, ip, defaultPort)
-	return newClient(url, deviceId, defaultLocalUsername, accessCode, defaultClientId, true)
+func NewLocalClient(ip, deviceId, accessCode string, opts ...ClientOption) (*Client, error) {
+	return newClient(ip, deviceId, defaultLocalUsername, accessCode, clientId(deviceId), true, opts)
 }
 
 // NewCloudClient creates a new client connecting to bambulab cloud mqtt server
-func NewCloudClient(endpoint, deviceId, username, password string) (*Client, error) {
-	url := fmt.Sprintf("%s://%s:%d", defaultProtocol, endpoint, defaultPort)
-	return newClient(url, deviceId, username, password, defaultClientId, false)
+func NewCloudClient(endpoint, deviceId, username, password string, opts ...ClientOption) (*Client, error) {
+	return newClient(endpoint, deviceId, username, password, clientId(deviceId), false, opts)
+}
+
+// clientId is unique per device so that many clients may share a broker
+func clientId(deviceId string) string {
+	return fmt.Sprintf("%s-%s", defaultClientId, deviceId)
+}
+
+// Local reports whether the client connects directly to the printer
+func (c *Client) Local() bool {
+	return c.local
+}
+
+// Host is the printer ip for local clients, or the cloud endpoint
+func (c *Client) Host() string {
+	return c.host
+}
+
+// DeviceID is the serial of the printer
+func (c *Client) DeviceID() string {
+	return c.deviceId
+}
+
+// AccessCode is the printer access code for local clients,
+// empty for cloud clients
+func (c *Client) AccessCode() string {
+	if !c.local {
+		return ""
+	}
+	return c.password
 }
 
 func (c *Client) Connect() error {
+	subscribed := make(chan struct{})
+	c.mu.Lock()
+	c.subscribed = subscribed
+	c.mu.Unlock()
 	if token := c.mqtt.Connect(); token.Wait() && token.Error() != nil {
 		return token.Error()
 	}
-	fmt.Println("mqtt client connected")
+	// OnConnect subscribes in the background, wait for it so that reports
+	// requested straight after connecting are received
+	select {
+	case <-subscribed:
+	case <-time.After(subscribeTimeout):
+	}
+	fmt.Fprintln(c.log, "mqtt client connected")
 	return nil
 }
 
+// LogOutput is where the client writes its logs, see WithLogOutput.
+func (c *Client) LogOutput() io.Writer {
+	return c.log
+}
+
+// Connected reports whether the connection to the broker is open, false
+// while connecting or reconnecting.
+func (c *Client) Connected() bool {
+	return c.mqtt.IsConnectionOpen()
+}
+
 func (c *Client) Disconnect() {
 	c.mqtt.Disconnect(1000)
 }
 
+// Subscribe sends reports from the printer to msgs. It may be called before
+// Connect, in which case the subscription is made once connected.
 func (c *Client) Subscribe(msgs chan<- Message) {
-	topic := c.reportTopic()
+	c.mu.Lock()
 	c.msgs = msgs
-	c.mqtt.Subscribe(topic, 1, c.handle)
-	fmt.Printf("mqtt client subscribed, topic=%s\n", topic)
+	c.mu.Unlock()
+	if c.mqtt.IsConnected() {
+		c.subscribe()
+	}
+}
+
+func (c *Client) resubscribe() {
+	c.mu.Lock()
+	subscribed := c.msgs != nil
+	c.mu.Unlock()
+	if subscribed {
+		c.subscribe()
+	}
+}
+
+func (c *Client) subscribe() {
+	topic := c.reportTopic()
+	token := c.mqtt.Subscribe(topic, 1, c.handle)
+	if token.WaitTimeout(subscribeTimeout) && token.Error() != nil {
+		fmt.Fprintf(c.log, "fail subscribe, topic=%s, err=%s\n", topic, token.Error())
+		return
+	}
+	fmt.Fprintf(c.log, "mqtt client subscribed, topic=%s\n", topic)
+}
+
+// OnReport calls fn with the raw payload of every report before it is
+// parsed, e.g. to record it. fn must not block.
+func (c *Client) OnReport(fn func(topic string, payload []byte)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onReport = fn
 }
 
 func (c *Client) handle(_ mqtt.Client, msg mqtt.Message) {
+	c.mu.Lock()
+	onReport := c.onReport
+	c.mu.Unlock()
+	if onReport != nil {
+		onReport(msg.Topic(), msg.Payload())
+	}
 	var m Message
 	if err := json.Unmarshal(msg.Payload(), &m); err != nil {
-		fmt.Printf("fail parse msg, err=%s, msg=%s\n", err, msg.Payload())
+		fmt.Fprintf(c.log, "fail parse msg, err=%s, msg=%s\n", err, msg.Payload())
 		return
 	}
-	if c.msgs == nil {
-		fmt.Printf("fail handle msg, chan nil, msg=%s\n", msg.Payload())
+	c.mu.Lock()
+	msgs := c.msgs
+	c.mu.Unlock()
+	if msgs == nil {
+		fmt.Fprintf(c.log, "fail handle msg, chan nil, msg=%s\n", msg.Payload())
 		return
 	}
-	c.msgs <- m
+	msgs <- m
 }
 
 func (c *Client) publish(ctx context.Context, msg []byte) error {
@@ -0,0 +1,54 @@
+package mqtt
+
+import (
+	"bytes"
+	"crypto/tls"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClient_Options(t *testing.T) {
+	tlsConfig := &tls.Config{ServerName: "printer"}
+	tests := []struct {
+		name   string
+		opts   []ClientOption
+		broker string
+		tls    *tls.Config
+	}{
+		{name: "default", broker: "ssl://192.168.1.50:8883", tls: &tls.Config{InsecureSkipVerify: true}},
+		{name: "broker", opts: []ClientOption{WithBroker("ssl://127.0.0.1:1883")}, broker: "ssl://127.0.0.1:1883", tls: &tls.Config{InsecureSkipVerify: true}},
+		{name: "tls", opts: []ClientOption{WithTLSConfig(tlsConfig)}, broker: "ssl://192.168.1.50:8883", tls: tlsConfig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewLocalClient("192.168.1.50", "01S00A000000000", "12345678", tt.opts...)
+			assert.Nil(t, err)
+			assert.Equal(t, "192.168.1.50", c.Host())
+			r := c.mqtt.OptionsReader()
+			assert.Len(t, r.Servers(), 1)
+			assert.Equal(t, tt.broker, r.Servers()[0].String())
+			assert.Equal(t, tt.tls, r.TLSConfig())
+		})
+	}
+}
+
+func TestNewCloudClient_VerifiesCertificate(t *testing.T) {
+	c, err := NewCloudClient(GlobalEndpoint, "01S00A000000000", "u_1", "token")
+	assert.Nil(t, err)
+	r := c.mqtt.OptionsReader()
+	assert.Equal(t, "ssl://us.mqtt.bambulab.com:8883", r.Servers()[0].String())
+	assert.False(t, r.TLSConfig() != nil && r.TLSConfig().InsecureSkipVerify)
+}
+
+func TestNewClient_LogOutput(t *testing.T) {
+	c, err := NewLocalClient("192.168.1.50", "01S00A000000000", "12345678")
+	assert.Nil(t, err)
+	assert.Equal(t, os.Stdout, c.LogOutput())
+
+	buf := &bytes.Buffer{}
+	c, err = NewLocalClient("192.168.1.50", "01S00A000000000", "12345678", WithLogOutput(buf))
+	assert.Nil(t, err)
+	assert.Equal(t, buf, c.LogOutput())
+}
@@ -0,0 +1,48 @@
+package mqtt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/mqtt"
+	"github.com/evanofslack/bambulab-client/printertest"
+	"github.com/stretchr/testify/assert"
+)
+
+// Reports requested straight after connecting must not be missed while the
+// client is still subscribing.
+func TestClient_ConnectSubscribes(t *testing.T) {
+	s, err := printertest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	for i := 0; i < 20; i++ {
+		c, err := s.Client()
+		assert.Nil(t, err)
+		msgs := make(chan mqtt.Message, 1)
+		c.Subscribe(msgs)
+		assert.Nil(t, c.Connect())
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		assert.Nil(t, c.PublishPushAll(ctx))
+		select {
+		case <-msgs:
+		case <-ctx.Done():
+			t.Fatalf("no report after connecting, attempt %d", i)
+		}
+		cancel()
+		c.Disconnect()
+	}
+}
+
+// Printers present a self signed certificate, which local clients accept.
+func TestNewLocalClient_SelfSignedCertificate(t *testing.T) {
+	s, err := printertest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	c, err := mqtt.NewLocalClient("127.0.0.1", s.Serial, s.AccessCode, mqtt.WithBroker("ssl://"+s.Addr))
+	assert.Nil(t, err)
+	assert.Nil(t, c.Connect())
+	c.Disconnect()
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 type PushingData struct {
@@ -27,10 +29,275 @@ func newPushingData() PushingData {
 // Send pushing.pushall request to broker
 func (c *Client) PublishPushAll(ctx context.Context) error {
 	data := newPushingData()
+	data.Pushing.SequenceID = c.nextSequenceID()
 	b, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("mqtt client published, cmd=%s\n", "pushall")
+	fmt.Fprintf(c.log, "mqtt client published, cmd=%s\n", "pushall")
 	return c.publish(ctx, b)
 }
+
+// ProjectFile describes a 3mf project on the printer storage to print
+type ProjectFile struct {
+	// URL of the project, e.g. file:///sdcard/cube.3mf
+	URL           string
+	Plate         int
+	SubtaskName   string
+	BedType       string
+	UseAms        bool
+	AmsMapping    []int
+	Timelapse     bool
+	BedLevelling  bool
+	FlowCali      bool
+	VibrationCali bool
+	LayerInspect  bool
+}
+
+type ProjectFileData struct {
+	Print struct {
+		SequenceID    string `json:"sequence_id"`
+		Command       string `json:"command"`
+		Param         string `json:"param"`
+		URL           string `json:"url"`
+		File          string `json:"file"`
+		Md5           string `json:"md5"`
+		ProjectID     string `json:"project_id"`
+		ProfileID     string `json:"profile_id"`
+		TaskID        string `json:"task_id"`
+		SubtaskID     string `json:"subtask_id"`
+		SubtaskName   string `json:"subtask_name"`
+		BedType       string `json:"bed_type"`
+		UseAms        bool   `json:"use_ams"`
+		AmsMapping    []int  `json:"ams_mapping"`
+		Timelapse     bool   `json:"timelapse"`
+		BedLevelling  bool   `json:"bed_levelling"`
+		FlowCali      bool   `json:"flow_cali"`
+		VibrationCali bool   `json:"vibration_cali"`
+		LayerInspect  bool   `json:"layer_inspect"`
+	} `json:"print"`
+}
+
+func newProjectFileData(f ProjectFile) ProjectFileData {
+	p := ProjectFileData{}
+	p.Print.SequenceID = "0"
+	p.Print.Command = "project_file"
+	plate := f.Plate
+	if plate < 1 {
+		plate = 1
+	}
+	p.Print.Param = fmt.Sprintf("Metadata/plate_%d.gcode", plate)
+	p.Print.URL = f.URL
+	p.Print.ProjectID = "0"
+	p.Print.ProfileID = "0"
+	p.Print.TaskID = "0"
+	p.Print.SubtaskID = "0"
+	p.Print.SubtaskName = f.SubtaskName
+	p.Print.BedType = f.BedType
+	if p.Print.BedType == "" {
+		p.Print.BedType = "auto"
+	}
+	p.Print.UseAms = f.UseAms
+	p.Print.AmsMapping = f.AmsMapping
+	if p.Print.AmsMapping == nil {
+		p.Print.AmsMapping = []int{}
+	}
+	p.Print.Timelapse = f.Timelapse
+	p.Print.BedLevelling = f.BedLevelling
+	p.Print.FlowCali = f.FlowCali
+	p.Print.VibrationCali = f.VibrationCali
+	p.Print.LayerInspect = f.LayerInspect
+	return p
+}
+
+// Send print.project_file request to broker, starting a print
+func (c *Client) PublishProjectFile(ctx context.Context, f ProjectFile) error {
+	data := newProjectFileData(f)
+	data.Print.SequenceID = c.nextSequenceID()
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.log, "mqtt client published, cmd=%s\n", "project_file")
+	return c.publish(ctx, b)
+}
+
+type CameraData struct {
+	Camera struct {
+		SequenceID string `json:"sequence_id"`
+		Command    string `json:"command"`
+		Control    string `json:"control,omitempty"`
+		Resolution string `json:"resolution,omitempty"`
+	} `json:"camera"`
+}
+
+func newCameraControlData(command string, enable bool) CameraData {
+	c := CameraData{}
+	c.Camera.SequenceID = "0"
+	c.Camera.Command = command
+	c.Camera.Control = "disable"
+	if enable {
+		c.Camera.Control = "enable"
+	}
+	return c
+}
+
+func newCameraResolutionData(resolution string) CameraData {
+	c := CameraData{}
+	c.Camera.SequenceID = "0"
+	c.Camera.Command = "ipcam_resolution_set"
+	c.Camera.Resolution = resolution
+	return c
+}
+
+// Send camera.ipcam_record_set request to broker, toggling camera recording
+func (c *Client) PublishIpcamRecord(ctx context.Context, enable bool) error {
+	return c.publishCamera(ctx, newCameraControlData("ipcam_record_set", enable))
+}
+
+// Send camera.ipcam_timelapse request to broker, toggling timelapse capture
+func (c *Client) PublishIpcamTimelapse(ctx context.Context, enable bool) error {
+	return c.publishCamera(ctx, newCameraControlData("ipcam_timelapse", enable))
+}
+
+// Send camera.ipcam_resolution_set request to broker, e.g. "720p" or "1080p"
+func (c *Client) PublishIpcamResolution(ctx context.Context, resolution string) error {
+	return c.publishCamera(ctx, newCameraResolutionData(resolution))
+}
+
+func (c *Client) publishCamera(ctx context.Context, data CameraData) error {
+	data.Camera.SequenceID = c.nextSequenceID()
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.log, "mqtt client published, cmd=%s\n", data.Camera.Command)
+	return c.publish(ctx, b)
+}
+
+// SpeedLevel is the print speed profile.
+type SpeedLevel int
+
+const (
+	SpeedSilent    SpeedLevel = 1
+	SpeedStandard  SpeedLevel = 2
+	SpeedSport     SpeedLevel = 3
+	SpeedLudicrous SpeedLevel = 4
+)
+
+type PrintCommandData struct {
+	Print struct {
+		SequenceID string `json:"sequence_id"`
+		Command    string `json:"command"`
+		Param      string `json:"param"`
+	} `json:"print"`
+}
+
+func newPrintCommandData(command, param string) PrintCommandData {
+	p := PrintCommandData{}
+	p.Print.SequenceID = "0"
+	p.Print.Command = command
+	p.Print.Param = param
+	return p
+}
+
+// Send print.pause request to broker
+func (c *Client) PublishPause(ctx context.Context) error {
+	return c.publishPrintCommand(ctx, newPrintCommandData("pause", ""))
+}
+
+// Send print.resume request to broker
+func (c *Client) PublishResume(ctx context.Context) error {
+	return c.publishPrintCommand(ctx, newPrintCommandData("resume", ""))
+}
+
+// Send print.stop request to broker, cancelling the current print
+func (c *Client) PublishStop(ctx context.Context) error {
+	return c.publishPrintCommand(ctx, newPrintCommandData("stop", ""))
+}
+
+// Send print.print_speed request to broker
+func (c *Client) PublishSpeed(ctx context.Context, level SpeedLevel) error {
+	if level < SpeedSilent || level > SpeedLudicrous {
+		return fmt.Errorf("invalid speed level %d", level)
+	}
+	return c.publishPrintCommand(ctx, newPrintCommandData("print_speed", strconv.Itoa(int(level))))
+}
+
+// Send print.gcode_line request to broker, running gcode on the printer
+func (c *Client) PublishGcode(ctx context.Context, gcode string) error {
+	if !strings.HasSuffix(gcode, "\n") {
+		gcode += "\n"
+	}
+	return c.publishPrintCommand(ctx, newPrintCommandData("gcode_line", gcode))
+}
+
+func (c *Client) publishPrintCommand(ctx context.Context, data PrintCommandData) error {
+	data.Print.SequenceID = c.nextSequenceID()
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.log, "mqtt client published, cmd=%s\n", data.Print.Command)
+	return c.publish(ctx, b)
+}
+
+// Light nodes controlled by PublishLight
+const (
+	LightChamber = "chamber_light"
+	LightWork    = "work_light"
+)
+
+type LedControlData struct {
+	System struct {
+		SequenceID   string `json:"sequence_id"`
+		Command      string `json:"command"`
+		LedNode      string `json:"led_node"`
+		LedMode      string `json:"led_mode"`
+		LedOnTime    int    `json:"led_on_time"`
+		LedOffTime   int    `json:"led_off_time"`
+		LoopTimes    int    `json:"loop_times"`
+		IntervalTime int    `json:"interval_time"`
+	} `json:"system"`
+}
+
+func newLedControlData(node string, on bool) LedControlData {
+	l := LedControlData{}
+	l.System.SequenceID = "0"
+	l.System.Command = "ledctrl"
+	l.System.LedNode = node
+	l.System.LedMode = "off"
+	if on {
+		l.System.LedMode = "on"
+	}
+	l.System.LedOnTime = 500
+	l.System.LedOffTime = 500
+	return l
+}
+
+// Send system.ledctrl request to broker, switching a light on or off
+func (c *Client) PublishLight(ctx context.Context, node string, on bool) error {
+	data := newLedControlData(node, on)
+	data.System.SequenceID = c.nextSequenceID()
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.log, "mqtt client published, cmd=%s\n", "ledctrl")
+	return c.publish(ctx, b)
+}
+
+// nextSequenceID numbers the requests of the client, printers echo it in
+// their response.
+func (c *Client) nextSequenceID() string {
+	return strconv.FormatUint(c.sequence.Add(1), 10)
+}
+
+// Send an arbitrary json request to broker
+func (c *Client) PublishRaw(ctx context.Context, payload []byte) error {
+	if !json.Valid(payload) {
+		return fmt.Errorf("invalid json payload")
+	}
+	fmt.Fprintf(c.log, "mqtt client published, cmd=%s\n", "raw")
+	return c.publish(ctx, payload)
+}
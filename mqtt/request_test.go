@@ -0,0 +1,113 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalPushingData(t *testing.T) {
+	b, err := json.Marshal(newPushingData())
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"pushing": {"sequence_id": "0", "command": "pushall", "version": 1, "push_target": 1}}`, string(b))
+}
+
+func TestMarshalProjectFileData(t *testing.T) {
+	f := ProjectFile{
+		URL:          "file:///sdcard/cube.3mf",
+		SubtaskName:  "cube",
+		UseAms:       true,
+		AmsMapping:   []int{2},
+		BedLevelling: true,
+	}
+	b, err := json.Marshal(newProjectFileData(f))
+	assert.Nil(t, err)
+
+	var raw map[string]map[string]any
+	assert.Nil(t, json.Unmarshal(b, &raw))
+	p := raw["print"]
+	assert.Equal(t, "project_file", p["command"])
+	assert.Equal(t, "Metadata/plate_1.gcode", p["param"])
+	assert.Equal(t, "file:///sdcard/cube.3mf", p["url"])
+	assert.Equal(t, "cube", p["subtask_name"])
+	assert.Equal(t, "auto", p["bed_type"])
+	assert.Equal(t, true, p["use_ams"])
+	assert.Equal(t, []any{float64(2)}, p["ams_mapping"])
+	assert.Equal(t, true, p["bed_levelling"])
+	assert.Equal(t, false, p["timelapse"])
+}
+
+func TestMarshalCameraData(t *testing.T) {
+	tests := []struct {
+		name string
+		data CameraData
+		want string
+	}{
+		{
+			name: "record enable",
+			data: newCameraControlData("ipcam_record_set", true),
+			want: `{"camera": {"sequence_id": "0", "command": "ipcam_record_set", "control": "enable"}}`,
+		},
+		{
+			name: "timelapse disable",
+			data: newCameraControlData("ipcam_timelapse", false),
+			want: `{"camera": {"sequence_id": "0", "command": "ipcam_timelapse", "control": "disable"}}`,
+		},
+		{
+			name: "resolution",
+			data: newCameraResolutionData("1080p"),
+			want: `{"camera": {"sequence_id": "0", "command": "ipcam_resolution_set", "resolution": "1080p"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.data)
+			assert.Nil(t, err)
+			assert.JSONEq(t, tt.want, string(b))
+		})
+	}
+}
+
+func TestMarshalPrintCommandData(t *testing.T) {
+	tests := []struct {
+		name string
+		data PrintCommandData
+		want string
+	}{
+		{
+			name: "pause",
+			data: newPrintCommandData("pause", ""),
+			want: `{"print": {"sequence_id": "0", "command": "pause", "param": ""}}`,
+		},
+		{
+			name: "speed",
+			data: newPrintCommandData("print_speed", "3"),
+			want: `{"print": {"sequence_id": "0", "command": "print_speed", "param": "3"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.data)
+			assert.Nil(t, err)
+			assert.JSONEq(t, tt.want, string(b))
+		})
+	}
+}
+
+func TestMarshalLedControlData(t *testing.T) {
+	b, err := json.Marshal(newLedControlData(LightChamber, true))
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"system": {"sequence_id": "0", "command": "ledctrl", "led_node": "chamber_light", "led_mode": "on", "led_on_time": 500, "led_off_time": 500, "loop_times": 0, "interval_time": 0}}`, string(b))
+}
+
+func TestClient_NextSequenceID(t *testing.T) {
+	c, err := NewLocalClient("192.168.1.50", "01S00A000000000", "12345678")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", c.nextSequenceID())
+	assert.Equal(t, "2", c.nextSequenceID())
+
+	other, err := NewLocalClient("192.168.1.51", "01S00A000000001", "12345678")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", other.nextSequenceID())
+}
@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"github.com/evanofslack/bambulab-client/monitor"
+)
+
+// Condition is a predicate on the state of a printer.
+type Condition func(s monitor.State) bool
+
+// All holds when every condition holds.
+func All(conds ...Condition) Condition {
+	return func(s monitor.State) bool {
+		for _, c := range conds {
+			if !c(s) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Any holds when at least one condition holds.
+func Any(conds ...Condition) Condition {
+	return func(s monitor.State) bool {
+		for _, c := range conds {
+			if c(s) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not holds when the condition does not.
+func Not(c Condition) Condition {
+	return func(s monitor.State) bool {
+		return !c(s)
+	}
+}
+
+// GcodeState holds when the printer is in one of the gcode states,
+// e.g. RUNNING.
+func GcodeState(states ...string) Condition {
+	return func(s monitor.State) bool {
+		if s.Gcode.State.IsNone() {
+			return false
+		}
+		for _, state := range states {
+			if s.Gcode.State.Unwrap() == state {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Idle holds when the printer is not printing.
+func Idle() Condition {
+	return GcodeState("IDLE", "FINISH", "FAILED")
+}
+
+// Printing holds when a print is running or paused.
+func Printing() Condition {
+	return GcodeState("PREPARE", "RUNNING", "PAUSE")
+}
+
+// BedAbove holds when the bed is hotter than the temperature in °C.
+func BedAbove(temperature float64) Condition {
+	return func(s monitor.State) bool {
+		return s.Bed.Temperature.IsSome() && s.Bed.Temperature.Unwrap() > temperature
+	}
+}
+
+// NozzleAbove holds when the nozzle is hotter than the temperature in °C.
+func NozzleAbove(temperature float64) Condition {
+	return func(s monitor.State) bool {
+		return s.Nozzle.Temperature.IsSome() && s.Nozzle.Temperature.Unwrap() > temperature
+	}
+}
+
+// RemainingUnder holds while printing with less than the minutes left.
+func RemainingUnder(minutes int) Condition {
+	return func(s monitor.State) bool {
+		remaining := s.CurrentPrint.TimeRemaining
+		return Printing()(s) && remaining.IsSome() && remaining.Unwrap() < minutes
+	}
+}
+
+// ProgressAbove holds while printing past the percentage.
+func ProgressAbove(percent int) Condition {
+	return func(s monitor.State) bool {
+		p := s.CurrentPrint.Percent
+		return Printing()(s) && p.IsSome() && p.Unwrap() > percent
+	}
+}
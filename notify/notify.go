@@ -0,0 +1,493 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/fleet"
+	"github.com/evanofslack/bambulab-client/monitor"
+)
+
+// Event kinds a rule may match, the monitor event names plus hms_error.
+const (
+	EventUpdate         = "update"
+	EventPrintStarted   = "print_started"
+	EventPrintFinished  = "print_finished"
+	EventPrintCancelled = "print_cancelled"
+	EventPrintFailed    = "print_failed"
+	EventStateStale     = "state_stale"
+	EventStateFresh     = "state_fresh"
+	EventHmsError       = "hms_error"
+)
+
+const (
+	defaultDedupeWindow = 10 * time.Minute
+	defaultSendTimeout  = 10 * time.Second
+)
+
+// Priority of a notification, used by sinks that support it.
+type Priority int
+
+const (
+	PriorityLow Priority = iota - 1
+	PriorityDefault
+	PriorityHigh
+)
+
+var (
+	ErrNoName      = errors.New("rule name required")
+	ErrUnknownSink = errors.New("unknown sink")
+)
+
+// Notification is sent to sinks when a rule matches.
+type Notification struct {
+	Rule     string        `json:"rule"`
+	Event    string        `json:"event"`
+	Serial   string        `json:"serial"`
+	Printer  string        `json:"printer"`
+	Title    string        `json:"title"`
+	Message  string        `json:"message"`
+	Priority Priority      `json:"priority"`
+	Hms      []monitor.Hms `json:"hms,omitempty"`
+	Time     time.Time     `json:"time"`
+}
+
+// Rule decides which events are notified and where to.
+//
+// Conditions of rules matching update events are edge triggered, the rule
+// matches when they start to hold rather than on every update while they
+// hold, e.g. once when the bed gets hot while idle.
+type Rule struct {
+	Name string
+	// Events the rule matches, any event but updates if empty
+	Events []string
+	// Tags of which the printer must have at least one, any printer if empty
+	Tags []string
+	// Serials of printers the rule applies to, any printer if empty
+	Serials []string
+	// When must hold for the state at the time of the event
+	When []Condition
+	// Sinks to notify by name, every sink if empty
+	Sinks []string
+	// Cooldown is the least time between notifications of the rule for
+	// a printer
+	Cooldown time.Duration
+	Priority Priority
+	// Title and Message are text/template templates executed with
+	// TemplateData, a default text is used if empty
+	Title   string
+	Message string
+}
+
+// TemplateData is the data rule templates are executed with.
+type TemplateData struct {
+	Rule    string
+	Event   string
+	Printer fleet.Config
+	Name    string
+	State   monitor.State
+	Hms     []monitor.Hms
+}
+
+type rule struct {
+	Rule
+	title   *template.Template
+	message *template.Template
+}
+
+type ruleKey struct {
+	rule   string
+	serial string
+}
+
+// Option configures an Engine.
+type Option func(*Engine)
+
+// WithDedupeWindow suppresses notifications identical to one sent within
+// the window, 10 minutes by default.
+func WithDedupeWindow(d time.Duration) Option {
+	return func(e *Engine) {
+		e.dedupeWindow = d
+	}
+}
+
+// WithRateLimit allows each sink at most n notifications per period,
+// further notifications are dropped.
+func WithRateLimit(n int, per time.Duration) Option {
+	return func(e *Engine) {
+		e.rateLimit = n
+		e.ratePeriod = per
+	}
+}
+
+// Engine evaluates rules over printer events and notifies sinks.
+type Engine struct {
+	mu           sync.Mutex
+	rules        []*rule
+	sinks        map[string]Sink
+	dedupeWindow time.Duration
+	rateLimit    int
+	ratePeriod   time.Duration
+	sent         map[string]time.Time
+	fired        map[ruleKey]time.Time
+	matched      map[ruleKey]bool
+	sends        map[string][]time.Time
+	now          func() time.Time
+}
+
+// New creates an engine with no rules or sinks.
+func New(opts ...Option) *Engine {
+	e := &Engine{
+		sinks:        make(map[string]Sink),
+		dedupeWindow: defaultDedupeWindow,
+		sent:         make(map[string]time.Time),
+		fired:        make(map[ruleKey]time.Time),
+		matched:      make(map[ruleKey]bool),
+		sends:        make(map[string][]time.Time),
+		now:          time.Now,
+	}
+	for _, o := range opts {
+		o(e)
+	}
+	return e
+}
+
+// AddSink registers a sink that rules can refer to by name.
+func (e *Engine) AddSink(name string, s Sink) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sinks[name] = s
+}
+
+// AddRule adds a rule. The sinks it names must already be added.
+func (e *Engine) AddRule(r Rule) error {
+	if r.Name == "" {
+		return ErrNoName
+	}
+	title, err := template.New("title").Parse(r.Title)
+	if err != nil {
+		return fmt.Errorf("invalid title of rule %q: %w", r.Name, err)
+	}
+	message, err := template.New("message").Parse(r.Message)
+	if err != nil {
+		return fmt.Errorf("invalid message of rule %q: %w", r.Name, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, name := range r.Sinks {
+		if _, ok := e.sinks[name]; !ok {
+			return fmt.Errorf("%w %q in rule %q", ErrUnknownSink, name, r.Name)
+		}
+	}
+	e.rules = append(e.rules, &rule{Rule: r, title: title, message: message})
+	return nil
+}
+
+// Run notifies the events of a fleet until the context is done or the
+// channel is closed.
+func (e *Engine) Run(ctx context.Context, events <-chan fleet.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			e.Handle(ctx, ev.Printer, ev.Event)
+		}
+	}
+}
+
+// Handle evaluates the rules for an event of the printer, sending a
+// notification for every rule that matches. It returns the notifications
+// sent to at least one sink.
+func (e *Engine) Handle(ctx context.Context, printer fleet.Config, ev monitor.Event) []Notification {
+	kinds := []string{ev.Type.String()}
+	var hms []monitor.Hms
+	if ev.Type == monitor.EventUpdate {
+		if hms = addedHms(ev.Diff); len(hms) > 0 {
+			kinds = append(kinds, EventHmsError)
+		}
+	}
+
+	var sent []Notification
+	for _, kind := range kinds {
+		for _, r := range e.match(printer, kind, ev.State) {
+			n, err := r.notification(printer, kind, ev, hms)
+			if err != nil {
+				fmt.Printf("fail render notification, rule=%s, err=%s\n", r.Name, err)
+				continue
+			}
+			if e.send(ctx, r, n) {
+				sent = append(sent, n)
+			}
+		}
+	}
+	return sent
+}
+
+// match lists the rules matching an event, recording when they fired.
+func (e *Engine) match(printer fleet.Config, kind string, s monitor.State) []*rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+	var matched []*rule
+	for _, r := range e.rules {
+		if !r.matchPrinter(printer) || !r.matchEvent(kind) {
+			continue
+		}
+		key := ruleKey{rule: r.Name, serial: printer.Serial}
+		ok := r.matchState(s)
+		if kind == EventUpdate {
+			// Edge triggered, only when the conditions start to hold
+			was := e.matched[key]
+			e.matched[key] = ok
+			ok = ok && !was
+		}
+		if !ok {
+			continue
+		}
+		if last, ok := e.fired[key]; ok && r.Cooldown > 0 && now.Sub(last) < r.Cooldown {
+			continue
+		}
+		e.fired[key] = now
+		matched = append(matched, r)
+	}
+	return matched
+}
+
+// send delivers the notification to the sinks of the rule, skipping
+// duplicates and sinks over their rate limit.
+func (e *Engine) send(ctx context.Context, r *rule, n Notification) bool {
+	e.mu.Lock()
+	now := e.now()
+	key := dedupeKey(n)
+	if last, ok := e.sent[key]; ok && now.Sub(last) < e.dedupeWindow {
+		e.mu.Unlock()
+		return false
+	}
+	names := r.Sinks
+	if len(names) == 0 {
+		for name := range e.sinks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	sinks := map[string]Sink{}
+	for _, name := range names {
+		if e.allow(name, now) {
+			sinks[name] = e.sinks[name]
+		} else {
+			fmt.Printf("notification rate limited, sink=%s, rule=%s\n", name, r.Name)
+		}
+	}
+	if len(sinks) > 0 {
+		e.sent[key] = now
+	}
+	e.mu.Unlock()
+
+	delivered := false
+	for name, s := range sinks {
+		ctx, cancel := context.WithTimeout(ctx, defaultSendTimeout)
+		err := s.Send(ctx, n)
+		cancel()
+		if err != nil {
+			fmt.Printf("fail send notification, sink=%s, rule=%s, err=%s\n", name, r.Name, err)
+			continue
+		}
+		delivered = true
+	}
+	return delivered
+}
+
+// allow reports whether the sink is under its rate limit, counting the
+// send if so. The lock must be held.
+func (e *Engine) allow(sink string, now time.Time) bool {
+	if e.rateLimit <= 0 {
+		return true
+	}
+	var recent []time.Time
+	for _, t := range e.sends[sink] {
+		if now.Sub(t) < e.ratePeriod {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= e.rateLimit {
+		e.sends[sink] = recent
+		return false
+	}
+	e.sends[sink] = append(recent, now)
+	return true
+}
+
+// dedupeKey identifies notifications about the same thing.
+func dedupeKey(n Notification) string {
+	codes := make([]string, 0, len(n.Hms))
+	for _, h := range n.Hms {
+		codes = append(codes, h.ErrorCode())
+	}
+	return strings.Join([]string{n.Rule, n.Serial, n.Event, n.Title, n.Message, strings.Join(codes, ",")}, "\x00")
+}
+
+func (r *rule) matchPrinter(p fleet.Config) bool {
+	if len(r.Serials) > 0 && !contains(r.Serials, p.Serial) {
+		return false
+	}
+	if len(r.Tags) == 0 {
+		return true
+	}
+	for _, t := range r.Tags {
+		if p.HasTag(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) matchEvent(kind string) bool {
+	if len(r.Events) == 0 {
+		return kind != EventUpdate
+	}
+	return contains(r.Events, kind)
+}
+
+func (r *rule) matchState(s monitor.State) bool {
+	for _, c := range r.When {
+		if !c(s) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *rule) notification(printer fleet.Config, kind string, ev monitor.Event, hms []monitor.Hms) (Notification, error) {
+	name := printer.Name
+	if name == "" {
+		name = printer.Serial
+	}
+	data := TemplateData{
+		Rule:    r.Name,
+		Event:   kind,
+		Printer: printer,
+		Name:    name,
+		State:   ev.State,
+		Hms:     hms,
+	}
+	n := Notification{
+		Rule:     r.Name,
+		Event:    kind,
+		Serial:   printer.Serial,
+		Printer:  name,
+		Priority: r.Priority,
+		Time:     ev.Time,
+	}
+	if kind == EventHmsError {
+		n.Hms = hms
+	}
+	var err error
+	if n.Title, err = execute(r.title, data, defaultTitle(data)); err != nil {
+		return n, err
+	}
+	if n.Message, err = execute(r.message, data, defaultMessage(data)); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func execute(t *template.Template, data TemplateData, fallback string) (string, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	if b.Len() == 0 {
+		return fallback, nil
+	}
+	return b.String(), nil
+}
+
+func defaultTitle(d TemplateData) string {
+	switch d.Event {
+	case EventPrintStarted:
+		return d.Name + ": print started"
+	case EventPrintFinished:
+		return d.Name + ": print finished"
+	case EventPrintCancelled:
+		return d.Name + ": print cancelled"
+	case EventPrintFailed:
+		return d.Name + ": print failed"
+	case EventHmsError:
+		return d.Name + ": HMS error"
+	case EventStateStale:
+		return d.Name + ": not reporting"
+	case EventStateFresh:
+		return d.Name + ": reporting again"
+	default:
+		return d.Name + ": " + d.Rule
+	}
+}
+
+func defaultMessage(d TemplateData) string {
+	if d.Event == EventHmsError {
+		codes := make([]string, 0, len(d.Hms))
+		for _, h := range d.Hms {
+			codes = append(codes, h.ErrorCode())
+		}
+		return "HMS " + strings.Join(codes, ", ")
+	}
+	s := d.State
+	parts := []string{}
+	if s.CurrentPrint.Subtask.IsSome() && s.CurrentPrint.Subtask.Unwrap() != "" {
+		parts = append(parts, s.CurrentPrint.Subtask.Unwrap())
+	}
+	if s.Gcode.State.IsSome() {
+		parts = append(parts, strings.ToLower(s.Gcode.State.Unwrap()))
+	}
+	if s.CurrentPrint.Percent.IsSome() {
+		parts = append(parts, fmt.Sprintf("%d%%", s.CurrentPrint.Percent.Unwrap()))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// addedHms lists the hms messages added by an update.
+func addedHms(d monitor.Diff) []monitor.Hms {
+	c, ok := d.Get("Hms")
+	if !ok {
+		return nil
+	}
+	curr, _ := c.New.([]monitor.Hms)
+	prev, _ := c.Old.([]monitor.Hms)
+	var added []monitor.Hms
+	for _, h := range curr {
+		if !containsHms(prev, h) {
+			added = append(added, h)
+		}
+	}
+	return added
+}
+
+func containsHms(hms []monitor.Hms, h monitor.Hms) bool {
+	for _, o := range hms {
+		if o == h {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, v string) bool {
+	for _, o := range values {
+		if o == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,268 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/fleet"
+	"github.com/evanofslack/bambulab-client/monitor"
+	opt "github.com/moznion/go-optional"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	garage = fleet.Config{Serial: "A", Name: "garage", Tags: []string{"home"}}
+	office = fleet.Config{Serial: "B", Tags: []string{"work"}}
+)
+
+type recorder struct {
+	mu   sync.Mutex
+	sent []Notification
+}
+
+func (r *recorder) Send(ctx context.Context, n Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func (r *recorder) titles() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	titles := []string{}
+	for _, n := range r.sent {
+		titles = append(titles, n.Title)
+	}
+	return titles
+}
+
+// clock is a fake time that only moves when told to.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func newTestEngine(t *testing.T, opts ...Option) (*Engine, *recorder, *clock) {
+	c := &clock{t: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	e := New(opts...)
+	e.now = c.now
+	r := &recorder{}
+	e.AddSink("test", r)
+	return e, r, c
+}
+
+func state(gcodeState string, bed float64) monitor.State {
+	return monitor.State{
+		Gcode:        monitor.Gcode{State: opt.Some(gcodeState)},
+		Bed:          monitor.Bed{Temperature: opt.Some(bed)},
+		CurrentPrint: monitor.CurrentPrint{Subtask: opt.Some("cube"), Percent: opt.Some(100)},
+	}
+}
+
+func event(typ monitor.EventType, s monitor.State) monitor.Event {
+	return monitor.Event{Type: typ, State: s}
+}
+
+func TestEngine_PrintEvents(t *testing.T) {
+	e, r, _ := newTestEngine(t)
+	assert.Nil(t, e.AddRule(Rule{Name: "done", Events: []string{EventPrintFinished, EventPrintFailed}}))
+
+	ctx := context.Background()
+	assert.Len(t, e.Handle(ctx, garage, event(monitor.EventPrintStarted, state("RUNNING", 60))), 0)
+	assert.Len(t, e.Handle(ctx, garage, event(monitor.EventUpdate, state("FINISH", 60))), 0)
+	sent := e.Handle(ctx, garage, event(monitor.EventPrintFinished, state("FINISH", 60)))
+	assert.Len(t, sent, 1)
+	assert.Equal(t, Notification{
+		Rule:    "done",
+		Event:   EventPrintFinished,
+		Serial:  "A",
+		Printer: "garage",
+		Title:   "garage: print finished",
+		Message: "cube, finish, 100%",
+	}, sent[0])
+	assert.Equal(t, []string{"garage: print finished"}, r.titles())
+
+	e.Handle(ctx, office, event(monitor.EventPrintFailed, state("FAILED", 60)))
+	assert.Equal(t, []string{"garage: print finished", "B: print failed"}, r.titles())
+}
+
+func TestEngine_Filters(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		printer fleet.Config
+		matched bool
+	}{
+		{name: "any", rule: Rule{}, printer: garage, matched: true},
+		{name: "tag", rule: Rule{Tags: []string{"home", "lab"}}, printer: garage, matched: true},
+		{name: "other tag", rule: Rule{Tags: []string{"home"}}, printer: office},
+		{name: "serial", rule: Rule{Serials: []string{"B"}}, printer: office, matched: true},
+		{name: "other serial", rule: Rule{Serials: []string{"B"}}, printer: garage},
+		{name: "condition", rule: Rule{When: []Condition{GcodeState("FINISH")}}, printer: garage, matched: true},
+		{name: "failed condition", rule: Rule{When: []Condition{BedAbove(80)}}, printer: garage},
+		{name: "other event", rule: Rule{Events: []string{EventPrintFailed}}, printer: garage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, _, _ := newTestEngine(t)
+			tt.rule.Name = tt.name
+			assert.Nil(t, e.AddRule(tt.rule))
+			sent := e.Handle(context.Background(), tt.printer, event(monitor.EventPrintFinished, state("FINISH", 60)))
+			assert.Equal(t, tt.matched, len(sent) == 1)
+		})
+	}
+}
+
+func TestEngine_StateConditionEdgeTriggered(t *testing.T) {
+	e, r, c := newTestEngine(t, WithDedupeWindow(0))
+	assert.Nil(t, e.AddRule(Rule{
+		Name:    "hot bed",
+		Events:  []string{EventUpdate},
+		When:    []Condition{BedAbove(50), Idle()},
+		Title:   "{{ .Name }}: bed still hot",
+		Message: "bed at {{ .State.Bed.Temperature.Unwrap }}°C",
+	}))
+
+	ctx := context.Background()
+	for _, s := range []monitor.State{
+		state("RUNNING", 60), // printing, no match
+		state("FINISH", 60),  // starts to hold
+		state("FINISH", 58),  // still holds
+		state("FINISH", 40),  // cooled down
+		state("IDLE", 55),    // holds again
+	} {
+		c.t = c.t.Add(time.Minute)
+		e.Handle(ctx, garage, event(monitor.EventUpdate, s))
+	}
+	assert.Equal(t, []string{"garage: bed still hot", "garage: bed still hot"}, r.titles())
+	assert.Equal(t, "bed at 60°C", r.sent[0].Message)
+	assert.Equal(t, "bed at 55°C", r.sent[1].Message)
+}
+
+func TestEngine_HmsError(t *testing.T) {
+	e, r, _ := newTestEngine(t)
+	assert.Nil(t, e.AddRule(Rule{Name: "hms", Events: []string{EventHmsError}, Priority: PriorityHigh}))
+
+	prev := state("RUNNING", 60)
+	prev.Hms = []monitor.Hms{{Attr: 1, Code: 1}}
+	curr := prev
+	curr.Hms = []monitor.Hms{{Attr: 1, Code: 1}, {Attr: 50331904, Code: 65543}}
+
+	ctx := context.Background()
+	ev := event(monitor.EventUpdate, curr)
+	ev.Diff = prev.Diff(curr)
+	sent := e.Handle(ctx, garage, ev)
+	assert.Len(t, sent, 1)
+	assert.Equal(t, EventHmsError, sent[0].Event)
+	assert.Equal(t, PriorityHigh, sent[0].Priority)
+	assert.Equal(t, []monitor.Hms{{Attr: 50331904, Code: 65543}}, sent[0].Hms)
+	assert.Equal(t, "HMS 0300_0100_0001_0007", sent[0].Message)
+
+	// Updates without new hms messages are not errors
+	ev = event(monitor.EventUpdate, curr)
+	ev.Diff = curr.Diff(prev)
+	assert.Len(t, e.Handle(ctx, garage, ev), 0)
+	assert.Len(t, r.titles(), 1)
+}
+
+func TestEngine_DedupeAndCooldown(t *testing.T) {
+	e, r, c := newTestEngine(t, WithDedupeWindow(10*time.Minute))
+	assert.Nil(t, e.AddRule(Rule{Name: "failed", Events: []string{EventPrintFailed}}))
+	assert.Nil(t, e.AddRule(Rule{Name: "started", Events: []string{EventPrintStarted}, Cooldown: time.Hour, Title: "{{ .Name }} started {{ .State.Bed.Temperature.Unwrap }}"}))
+
+	ctx := context.Background()
+	failed := event(monitor.EventPrintFailed, state("FAILED", 60))
+	assert.Len(t, e.Handle(ctx, garage, failed), 1)
+	c.t = c.t.Add(time.Minute)
+	assert.Len(t, e.Handle(ctx, garage, failed), 0, "duplicate within window")
+	assert.Len(t, e.Handle(ctx, office, failed), 1, "other printer")
+	c.t = c.t.Add(10 * time.Minute)
+	assert.Len(t, e.Handle(ctx, garage, failed), 1, "window passed")
+
+	// Different notifications of the rule are limited by its cooldown
+	assert.Len(t, e.Handle(ctx, garage, event(monitor.EventPrintStarted, state("RUNNING", 60))), 1)
+	c.t = c.t.Add(30 * time.Minute)
+	assert.Len(t, e.Handle(ctx, garage, event(monitor.EventPrintStarted, state("RUNNING", 61))), 0)
+	c.t = c.t.Add(31 * time.Minute)
+	assert.Len(t, e.Handle(ctx, garage, event(monitor.EventPrintStarted, state("RUNNING", 62))), 1)
+	assert.Len(t, r.titles(), 5)
+}
+
+func TestEngine_RateLimit(t *testing.T) {
+	e, r, c := newTestEngine(t, WithRateLimit(2, time.Minute), WithDedupeWindow(0))
+	other := &recorder{}
+	e.AddSink("other", other)
+	assert.Nil(t, e.AddRule(Rule{Name: "all", Events: []string{EventPrintStarted}}))
+	assert.Nil(t, e.AddRule(Rule{Name: "limited", Events: []string{EventPrintStarted}, Sinks: []string{"test"}}))
+
+	ctx := context.Background()
+	started := event(monitor.EventPrintStarted, state("RUNNING", 60))
+	e.Handle(ctx, garage, started)
+	e.Handle(ctx, garage, started)
+	assert.Len(t, r.titles(), 2)
+	assert.Len(t, other.titles(), 2)
+
+	c.t = c.t.Add(time.Minute)
+	e.Handle(ctx, garage, started)
+	assert.Len(t, r.titles(), 4)
+	assert.Len(t, other.titles(), 3)
+}
+
+func TestEngine_AddRule(t *testing.T) {
+	e, _, _ := newTestEngine(t)
+	assert.ErrorIs(t, e.AddRule(Rule{}), ErrNoName)
+	assert.ErrorIs(t, e.AddRule(Rule{Name: "x", Sinks: []string{"missing"}}), ErrUnknownSink)
+	assert.NotNil(t, e.AddRule(Rule{Name: "x", Title: "{{ .Name"}))
+	assert.Nil(t, e.AddRule(Rule{Name: "x", Sinks: []string{"test"}}))
+}
+
+func TestEngine_Run(t *testing.T) {
+	e, r, _ := newTestEngine(t)
+	assert.Nil(t, e.AddRule(Rule{Name: "done", Events: []string{EventPrintFinished}}))
+
+	events := make(chan fleet.Event, 1)
+	events <- fleet.Event{Event: event(monitor.EventPrintFinished, state("FINISH", 60)), Printer: garage}
+	close(events)
+	e.Run(context.Background(), events)
+	assert.Equal(t, []string{"garage: print finished"}, r.titles())
+}
+
+func TestConditions(t *testing.T) {
+	printing := state("RUNNING", 60)
+	printing.CurrentPrint.TimeRemaining = opt.Some(5)
+	printing.CurrentPrint.Percent = opt.Some(90)
+	printing.Nozzle.Temperature = opt.Some(220.0)
+	idle := state("IDLE", 30)
+
+	tests := []struct {
+		name string
+		cond Condition
+		s    monitor.State
+		ok   bool
+	}{
+		{"remaining under", RemainingUnder(10), printing, true},
+		{"remaining over", RemainingUnder(5), printing, false},
+		{"remaining idle", RemainingUnder(10), idle, false},
+		{"progress", ProgressAbove(80), printing, true},
+		{"nozzle", NozzleAbove(200), printing, true},
+		{"nozzle unknown", NozzleAbove(0), idle, false},
+		{"idle", Idle(), idle, true},
+		{"printing", Printing(), printing, true},
+		{"gcode unknown", GcodeState("IDLE"), monitor.State{}, false},
+		{"all", All(Idle(), BedAbove(20)), idle, true},
+		{"all fails", All(Idle(), BedAbove(40)), idle, false},
+		{"any", Any(Printing(), BedAbove(20)), idle, true},
+		{"not", Not(Idle()), idle, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.ok, tt.cond(tt.s))
+		})
+	}
+}
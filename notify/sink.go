@@ -0,0 +1,172 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Sink delivers notifications.
+type Sink interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(ctx context.Context, n Notification) error
+
+func (f SinkFunc) Send(ctx context.Context, n Notification) error {
+	return f(ctx, n)
+}
+
+// Webhook posts the notification as JSON to a url.
+type Webhook struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+func (w *Webhook) Send(ctx context.Context, n Notification) error {
+	return postJSON(ctx, w.Client, w.URL, n, w.Headers)
+}
+
+// Ntfy publishes the notification to an ntfy topic.
+type Ntfy struct {
+	// URL of the topic, e.g. https://ntfy.sh/my-printers
+	URL string
+	// Token authenticates with access controlled topics
+	Token  string
+	Client *http.Client
+}
+
+func (s *Ntfy) Send(ctx context.Context, n Notification) error {
+	headers := map[string]string{
+		"Title":    n.Title,
+		"Priority": ntfyPriority(n.Priority),
+		"Tags":     ntfyTag(n.Event),
+	}
+	if s.Token != "" {
+		headers["Authorization"] = "Bearer " + s.Token
+	}
+	return post(ctx, s.Client, s.URL, "text/plain", []byte(n.Message), headers)
+}
+
+func ntfyPriority(p Priority) string {
+	switch {
+	case p < PriorityDefault:
+		return "low"
+	case p > PriorityDefault:
+		return "high"
+	default:
+		return "default"
+	}
+}
+
+// ntfyTag is the emoji shown with the notification.
+func ntfyTag(event string) string {
+	switch event {
+	case EventPrintFinished:
+		return "white_check_mark"
+	case EventPrintFailed, EventHmsError:
+		return "warning"
+	case EventPrintCancelled:
+		return "x"
+	default:
+		return "printer"
+	}
+}
+
+// Slack posts the notification to a Slack compatible incoming webhook.
+type Slack struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+func (s *Slack) Send(ctx context.Context, n Notification) error {
+	text := fmt.Sprintf("*%s*", n.Title)
+	if n.Message != "" {
+		text += "\n" + n.Message
+	}
+	return postJSON(ctx, s.Client, s.WebhookURL, slackPayload{Text: text}, nil)
+}
+
+// Discord posts the notification to a Discord compatible webhook.
+type Discord struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+type discordPayload struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Color       int    `json:"color"`
+	Timestamp   string `json:"timestamp,omitempty"`
+}
+
+func (s *Discord) Send(ctx context.Context, n Notification) error {
+	embed := discordEmbed{
+		Title:       n.Title,
+		Description: n.Message,
+		Color:       discordColor(n.Event),
+	}
+	if !n.Time.IsZero() {
+		embed.Timestamp = n.Time.UTC().Format("2006-01-02T15:04:05Z")
+	}
+	return postJSON(ctx, s.Client, s.WebhookURL, discordPayload{Embeds: []discordEmbed{embed}}, nil)
+}
+
+func discordColor(event string) int {
+	switch event {
+	case EventPrintFinished:
+		return 0x2ECC71
+	case EventPrintFailed, EventHmsError:
+		return 0xE74C3C
+	case EventPrintCancelled:
+		return 0x95A5A6
+	default:
+		return 0x3498DB
+	}
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, v any, headers map[string]string) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return post(ctx, client, url, "application/json", body, headers)
+}
+
+func post(ctx context.Context, client *http.Client, url, contentType string, body []byte, headers map[string]string) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type capture struct {
+	header http.Header
+	body   []byte
+}
+
+func newCaptureServer(t *testing.T, status int) (*httptest.Server, *capture) {
+	c := &capture{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		c.header = r.Header.Clone()
+		c.body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		w.Write([]byte("nope"))
+	}))
+	t.Cleanup(s.Close)
+	return s, c
+}
+
+var testNotification = Notification{
+	Rule:     "done",
+	Event:    EventPrintFinished,
+	Serial:   "A",
+	Printer:  "garage",
+	Title:    "garage: print finished",
+	Message:  "cube, finish, 100%",
+	Priority: PriorityHigh,
+	Time:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+}
+
+func TestSinks(t *testing.T) {
+	tests := []struct {
+		name        string
+		sink        func(url string) Sink
+		contentType string
+		body        string
+		headers     map[string]string
+	}{
+		{
+			name: "webhook",
+			sink: func(url string) Sink {
+				return &Webhook{URL: url, Headers: map[string]string{"X-Key": "secret"}}
+			},
+			contentType: "application/json",
+			body:        `{"rule":"done","event":"print_finished","serial":"A","printer":"garage","title":"garage: print finished","message":"cube, finish, 100%","priority":1,"time":"2024-05-01T12:00:00Z"}`,
+			headers:     map[string]string{"X-Key": "secret"},
+		},
+		{
+			name:        "ntfy",
+			sink:        func(url string) Sink { return &Ntfy{URL: url, Token: "tk"} },
+			contentType: "text/plain",
+			body:        "cube, finish, 100%",
+			headers: map[string]string{
+				"Title":         "garage: print finished",
+				"Priority":      "high",
+				"Tags":          "white_check_mark",
+				"Authorization": "Bearer tk",
+			},
+		},
+		{
+			name:        "slack",
+			sink:        func(url string) Sink { return &Slack{WebhookURL: url} },
+			contentType: "application/json",
+			body:        `{"text":"*garage: print finished*\ncube, finish, 100%"}`,
+		},
+		{
+			name:        "discord",
+			sink:        func(url string) Sink { return &Discord{WebhookURL: url} },
+			contentType: "application/json",
+			body:        `{"embeds":[{"title":"garage: print finished","description":"cube, finish, 100%","color":3066993,"timestamp":"2024-05-01T12:00:00Z"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newCaptureServer(t, http.StatusOK)
+			assert.Nil(t, tt.sink(s.URL).Send(context.Background(), testNotification))
+			assert.Equal(t, tt.contentType, c.header.Get("Content-Type"))
+			if json.Valid([]byte(tt.body)) {
+				assert.JSONEq(t, tt.body, string(c.body))
+			} else {
+				assert.Equal(t, tt.body, string(c.body))
+			}
+			for k, v := range tt.headers {
+				assert.Equal(t, v, c.header.Get(k), k)
+			}
+		})
+	}
+}
+
+func TestSink_ErrorStatus(t *testing.T) {
+	s, _ := newCaptureServer(t, http.StatusForbidden)
+	err := (&Slack{WebhookURL: s.URL}).Send(context.Background(), testNotification)
+	assert.EqualError(t, err, "unexpected status 403: nope")
+}
@@ -0,0 +1,243 @@
+package printer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/mqtt"
+)
+
+const (
+	defaultMessageBuffer = 64
+	pushAllTimeout       = 10 * time.Second
+)
+
+var ErrRunning = errors.New("printer already running")
+
+// Printer owns the mqtt client and monitor of one printer.
+type Printer struct {
+	client  *mqtt.Client
+	monitor *monitor.Monitor
+	msgs    chan mqtt.Message
+	ready   chan struct{}
+	running atomic.Bool
+}
+
+// New creates a printer from an mqtt client. The monitor is configured with opts.
+// By default the state goes stale after monitor.DefaultStaleTimeout without a
+// report, and a full report is requested until reports resume.
+func New(c *mqtt.Client, opts ...monitor.Option) *Printer {
+	p := &Printer{
+		client: c,
+		msgs:   make(chan mqtt.Message, defaultMessageBuffer),
+		ready:  make(chan struct{}),
+	}
+	defaults := []monitor.Option{
+		monitor.WithStaleTimeout(monitor.DefaultStaleTimeout),
+		monitor.WithStaleHandler(p.requestPushAll),
+	}
+	p.monitor = monitor.New(append(defaults, opts...)...)
+	return p
+}
+
+// requestPushAll asks a printer with stale state for a full report. It is
+// skipped while disconnected, the monitor calls it again every stale
+// timeout while the state stays stale.
+func (p *Printer) requestPushAll() {
+	if !p.client.Connected() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pushAllTimeout)
+	defer cancel()
+	if err := p.client.PublishPushAll(ctx); err != nil {
+		fmt.Fprintf(p.client.LogOutput(), "fail request pushall, serial=%s, err=%s\n", p.Serial(), err)
+	}
+}
+
+// NewLocal creates a printer connecting over the local network.
+func NewLocal(ip, serial, accessCode string, opts ...monitor.Option) (*Printer, error) {
+	c, err := mqtt.NewLocalClient(ip, serial, accessCode)
+	if err != nil {
+		return nil, err
+	}
+	return New(c, opts...), nil
+}
+
+// NewCloud creates a printer connecting through the cloud broker.
+func NewCloud(endpoint, serial, username, password string, opts ...monitor.Option) (*Printer, error) {
+	c, err := mqtt.NewCloudClient(endpoint, serial, username, password)
+	if err != nil {
+		return nil, err
+	}
+	return New(c, opts...), nil
+}
+
+// Run connects to the printer, requests a full report and keeps the monitor
+// updated until ctx is done. A printer can only be run once.
+func (p *Printer) Run(ctx context.Context) error {
+	if !p.running.CompareAndSwap(false, true) {
+		return ErrRunning
+	}
+	defer p.monitor.Stop()
+
+	events := p.monitor.Subscribe(1)
+	go p.waitReady(events)
+	go p.monitor.Start(p.msgs)
+	p.client.Subscribe(p.msgs)
+
+	// Connect retries until it succeeds, so give up once ctx is done
+	connected := make(chan error, 1)
+	go func() {
+		connected <- p.client.Connect()
+	}()
+	select {
+	case <-ctx.Done():
+		p.client.Disconnect()
+		return nil
+	case err := <-connected:
+		if err != nil {
+			return fmt.Errorf("connect printer %s: %w", p.Serial(), err)
+		}
+	}
+	defer p.client.Disconnect()
+
+	pushCtx, cancel := context.WithTimeout(ctx, pushAllTimeout)
+	if err := p.client.PublishPushAll(pushCtx); err != nil {
+		fmt.Fprintf(p.client.LogOutput(), "fail request pushall, serial=%s, err=%s\n", p.Serial(), err)
+	}
+	cancel()
+
+	<-ctx.Done()
+	return nil
+}
+
+// waitReady closes ready on the first report, the state going stale
+// before any report does not make the printer ready.
+func (p *Printer) waitReady(events <-chan monitor.Event) {
+	defer p.monitor.Unsubscribe(events)
+	for e := range events {
+		if e.Type == monitor.EventUpdate {
+			close(p.ready)
+			return
+		}
+	}
+}
+
+// Ready is closed once the first report from the printer has been received.
+func (p *Printer) Ready() <-chan struct{} {
+	return p.ready
+}
+
+// WaitReady blocks until the first report is received or ctx is done.
+func (p *Printer) WaitReady(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.ready:
+		return nil
+	}
+}
+
+// Serial is the serial number of the printer.
+func (p *Printer) Serial() string {
+	return p.client.DeviceID()
+}
+
+// Client is the underlying mqtt client.
+func (p *Printer) Client() *mqtt.Client {
+	return p.client
+}
+
+// Monitor is the underlying monitor.
+func (p *Printer) Monitor() *monitor.Monitor {
+	return p.monitor
+}
+
+// State is the current state of the printer.
+func (p *Printer) State() monitor.State {
+	return p.monitor.CurrentState()
+}
+
+// Counters are the print and error counts since the printer started running.
+func (p *Printer) Counters() monitor.Counters {
+	return p.monitor.Counters()
+}
+
+// Subscribe returns a channel receiving monitor events, see monitor.Subscribe.
+func (p *Printer) Subscribe(size int) <-chan monitor.Event {
+	return p.monitor.Subscribe(size)
+}
+
+// Unsubscribe stops delivery of events to the channel and closes it.
+func (p *Printer) Unsubscribe(ch <-chan monitor.Event) {
+	p.monitor.Unsubscribe(ch)
+}
+
+// PushAll requests a full report from the printer.
+func (p *Printer) PushAll(ctx context.Context) error {
+	return p.client.PublishPushAll(ctx)
+}
+
+// Pause pauses the current print.
+func (p *Printer) Pause(ctx context.Context) error {
+	return p.client.PublishPause(ctx)
+}
+
+// Resume resumes a paused print.
+func (p *Printer) Resume(ctx context.Context) error {
+	return p.client.PublishResume(ctx)
+}
+
+// Stop cancels the current print.
+func (p *Printer) Stop(ctx context.Context) error {
+	return p.client.PublishStop(ctx)
+}
+
+// SetSpeed changes the speed profile of the current print.
+func (p *Printer) SetSpeed(ctx context.Context, level mqtt.SpeedLevel) error {
+	return p.client.PublishSpeed(ctx, level)
+}
+
+// SetLight switches a light, e.g. mqtt.LightChamber, on or off.
+func (p *Printer) SetLight(ctx context.Context, node string, on bool) error {
+	return p.client.PublishLight(ctx, node, on)
+}
+
+// SendGcode runs gcode on the printer.
+func (p *Printer) SendGcode(ctx context.Context, gcode string) error {
+	return p.client.PublishGcode(ctx, gcode)
+}
+
+// SetRecording enables or disables camera recording.
+func (p *Printer) SetRecording(ctx context.Context, enable bool) error {
+	return p.client.PublishIpcamRecord(ctx, enable)
+}
+
+// SetTimelapse enables or disables timelapse capture.
+func (p *Printer) SetTimelapse(ctx context.Context, enable bool) error {
+	return p.client.PublishIpcamTimelapse(ctx, enable)
+}
+
+// SetResolution sets the camera resolution, e.g. "720p" or "1080p".
+func (p *Printer) SetResolution(ctx context.Context, resolution string) error {
+	return p.client.PublishIpcamResolution(ctx, resolution)
+}
+
+// StartPrint starts printing a project already on the printer storage.
+func (p *Printer) StartPrint(ctx context.Context, f mqtt.ProjectFile) error {
+	return p.client.PublishProjectFile(ctx, f)
+}
+
+// PrintFile uploads and prints a local project, see PrintFile.
+func (p *Printer) PrintFile(ctx context.Context, localPath string, opts PrintOptions) error {
+	return PrintFile(ctx, p.client, p.monitor, localPath, opts)
+}
+
+// Publish sends a raw json request to the printer.
+func (p *Printer) Publish(ctx context.Context, payload []byte) error {
+	return p.client.PublishRaw(ctx, payload)
+}
@@ -0,0 +1,96 @@
+package printer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/mqtt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrinter_Run(t *testing.T) {
+	// Nothing listens on this address so the printer never connects
+	p, err := NewLocal("127.0.0.1", "01S00A000000000", "12345678")
+	assert.Nil(t, err)
+	assert.Equal(t, "01S00A000000000", p.Serial())
+	assert.True(t, p.Client().Local())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- p.Run(ctx)
+	}()
+
+	select {
+	case <-p.Ready():
+		t.Fatal("ready before any report")
+	default:
+	}
+
+	state := "RUNNING"
+	percent := 42
+	p.msgs <- mqtt.Message{Print: &mqtt.Print{GcodeState: &state, McPercent: &percent}}
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	assert.Nil(t, p.WaitReady(waitCtx))
+	assert.Equal(t, "RUNNING", p.State().Gcode.State.Unwrap())
+	assert.Equal(t, 42, p.State().CurrentPrint.Percent.Unwrap())
+
+	cancel()
+	assert.Nil(t, <-errc)
+	assert.True(t, errors.Is(p.Run(context.Background()), ErrRunning))
+}
+
+func TestPrinter_WaitReadyTimeout(t *testing.T) {
+	p, err := NewCloud(mqtt.GlobalEndpoint, "01S00A000000000", "u_1", "token")
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.True(t, errors.Is(p.WaitReady(ctx), context.DeadlineExceeded))
+}
+
+func TestPrinter_RequestPushAllDisconnected(t *testing.T) {
+	// Publishing while never connected would wait for pushAllTimeout
+	p, err := NewLocal("127.0.0.1", "01S00A000000000", "12345678")
+	assert.Nil(t, err)
+	done := make(chan struct{})
+	go func() {
+		p.requestPushAll()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("pushall requested while disconnected")
+	}
+}
+
+func TestPrinter_NotReadyWhenStale(t *testing.T) {
+	p, err := NewLocal("127.0.0.1", "01S00A000000000", "12345678", monitor.WithStaleTimeout(20*time.Millisecond))
+	assert.Nil(t, err)
+	events := p.Subscribe(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	select {
+	case e := <-events:
+		assert.Equal(t, monitor.EventStateStale, e.Type)
+	case <-time.After(time.Second):
+		t.Fatal("no stale event")
+	}
+	select {
+	case <-p.Ready():
+		t.Fatal("ready without a report")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	state := "IDLE"
+	p.msgs <- mqtt.Message{Print: &mqtt.Print{GcodeState: &state}}
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	assert.Nil(t, p.WaitReady(waitCtx))
+}
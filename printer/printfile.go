@@ -0,0 +1,160 @@
+package printer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/ftps"
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/mqtt"
+)
+
+const defaultStartTimeout = 5 * time.Minute
+
+// Step is a stage of starting a print from a local file.
+type Step string
+
+const (
+	StepCheck   Step = "check"
+	StepUpload  Step = "upload"
+	StepStart   Step = "start"
+	StepConfirm Step = "confirm"
+)
+
+var (
+	ErrPrinterBusy  = errors.New("printer is busy")
+	ErrPrintFailed  = errors.New("print failed to start")
+	ErrStartTimeout = errors.New("timed out waiting for print to start")
+)
+
+// PrintError describes which step of PrintFile failed.
+type PrintError struct {
+	Step Step
+	Err  error
+}
+
+func (e *PrintError) Error() string {
+	return fmt.Sprintf("print file: %s: %s", e.Step, e.Err)
+}
+
+func (e *PrintError) Unwrap() error {
+	return e.Err
+}
+
+// PrintOptions configure how a file is printed.
+type PrintOptions struct {
+	// RemoteName is the file name on the printer, defaults to the local file name
+	RemoteName string
+	// Plate is the plate of the project to print, defaults to 1
+	Plate         int
+	BedType       string
+	UseAms        bool
+	AmsMapping    []int
+	Timelapse     bool
+	BedLevelling  bool
+	FlowCali      bool
+	VibrationCali bool
+	LayerInspect  bool
+	// StartTimeout is how long to wait for the print to start, defaults to 5 minutes
+	StartTimeout time.Duration
+	// Progress reports upload progress
+	Progress ftps.ProgressFunc
+}
+
+type uploader interface {
+	Upload(ctx context.Context, localPath, remotePath string, progress ftps.ProgressFunc) error
+}
+
+type starter interface {
+	PublishProjectFile(ctx context.Context, f mqtt.ProjectFile) error
+}
+
+// PrintFile uploads a 3mf project to the printer, starts printing it and
+// waits for the monitor to report the print is running. The monitor must be
+// receiving reports from the client. Errors are of type *PrintError.
+func PrintFile(ctx context.Context, c *mqtt.Client, m *monitor.Monitor, localPath string, opts PrintOptions) error {
+	files, err := ftps.NewFromClient(c)
+	if err != nil {
+		return &PrintError{Step: StepUpload, Err: err}
+	}
+	return printFile(ctx, files, c, m, localPath, opts)
+}
+
+func printFile(ctx context.Context, up uploader, st starter, m *monitor.Monitor, localPath string, opts PrintOptions) error {
+	if state := m.CurrentState().Gcode.State; state.IsSome() && isBusy(state.Unwrap()) {
+		return &PrintError{Step: StepCheck, Err: fmt.Errorf("%w: %s", ErrPrinterBusy, state.Unwrap())}
+	}
+
+	name := opts.RemoteName
+	if name == "" {
+		name = filepath.Base(localPath)
+	}
+	if err := up.Upload(ctx, localPath, "/"+name, opts.Progress); err != nil {
+		return &PrintError{Step: StepUpload, Err: err}
+	}
+
+	// Subscribe before starting so the transition can't be missed
+	events := m.Subscribe(16)
+	defer m.Unsubscribe(events)
+
+	f := mqtt.ProjectFile{
+		URL:           "file:///sdcard/" + name,
+		Plate:         opts.Plate,
+		SubtaskName:   strings.TrimSuffix(name, filepath.Ext(name)),
+		BedType:       opts.BedType,
+		UseAms:        opts.UseAms,
+		AmsMapping:    opts.AmsMapping,
+		Timelapse:     opts.Timelapse,
+		BedLevelling:  opts.BedLevelling,
+		FlowCali:      opts.FlowCali,
+		VibrationCali: opts.VibrationCali,
+		LayerInspect:  opts.LayerInspect,
+	}
+	if err := st.PublishProjectFile(ctx, f); err != nil {
+		return &PrintError{Step: StepStart, Err: err}
+	}
+
+	if err := waitStarted(ctx, events, opts.StartTimeout); err != nil {
+		return &PrintError{Step: StepConfirm, Err: err}
+	}
+	return nil
+}
+
+// waitStarted waits for the gcode state to leave idle and preparing.
+func waitStarted(ctx context.Context, events <-chan monitor.Event, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = defaultStartTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return ErrStartTimeout
+		case e, ok := <-events:
+			if !ok {
+				return errors.New("monitor stopped")
+			}
+			if e.Type == monitor.EventPrintFailed {
+				return ErrPrintFailed
+			}
+			if state := e.State.Gcode.State; state.IsSome() && isStarted(state.Unwrap()) {
+				return nil
+			}
+		}
+	}
+}
+
+func isBusy(state string) bool {
+	return state == "PREPARE" || state == "RUNNING" || state == "PAUSE"
+}
+
+func isStarted(state string) bool {
+	return state == "RUNNING" || state == "PAUSE"
+}
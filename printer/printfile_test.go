@@ -0,0 +1,133 @@
+package printer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/ftps"
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/mqtt"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeUploader struct {
+	remote string
+	err    error
+}
+
+func (u *fakeUploader) Upload(_ context.Context, _, remotePath string, _ ftps.ProgressFunc) error {
+	u.remote = remotePath
+	return u.err
+}
+
+// fakeStarter reports the given gcode states to the monitor once a print is started.
+type fakeStarter struct {
+	msgs   chan mqtt.Message
+	states []string
+	file   mqtt.ProjectFile
+}
+
+func (s *fakeStarter) PublishProjectFile(_ context.Context, f mqtt.ProjectFile) error {
+	s.file = f
+	for _, state := range s.states {
+		s.msgs <- mqtt.Message{Print: &mqtt.Print{GcodeState: &state}}
+	}
+	return nil
+}
+
+func newTestMonitor(t *testing.T, initial string) (*monitor.Monitor, chan mqtt.Message) {
+	m := monitor.New()
+	t.Cleanup(m.Stop)
+	msgs := make(chan mqtt.Message, 10)
+	go m.Start(msgs)
+	if initial != "" {
+		msgs <- mqtt.Message{Print: &mqtt.Print{GcodeState: &initial}}
+		assert.Eventually(t, func() bool {
+			return m.CurrentState().Gcode.State.IsSome()
+		}, time.Second, 10*time.Millisecond)
+	}
+	return m, msgs
+}
+
+func TestPrintFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		initial   string
+		states    []string
+		uploadErr error
+		step      Step
+		err       error
+	}{
+		{
+			name:    "started",
+			initial: "FINISH",
+			states:  []string{"PREPARE", "RUNNING"},
+		},
+		{
+			name:    "busy",
+			initial: "RUNNING",
+			step:    StepCheck,
+			err:     ErrPrinterBusy,
+		},
+		{
+			name:      "upload failed",
+			initial:   "IDLE",
+			uploadErr: errors.New("disk full"),
+			step:      StepUpload,
+		},
+		{
+			name:    "failed to start",
+			initial: "IDLE",
+			states:  []string{"PREPARE", "FAILED"},
+			step:    StepConfirm,
+			err:     ErrPrintFailed,
+		},
+		{
+			name:    "timeout",
+			initial: "IDLE",
+			states:  []string{"PREPARE"},
+			step:    StepConfirm,
+			err:     ErrStartTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, msgs := newTestMonitor(t, tt.initial)
+			up := &fakeUploader{err: tt.uploadErr}
+			st := &fakeStarter{msgs: msgs, states: tt.states}
+			opts := PrintOptions{StartTimeout: 200 * time.Millisecond, Plate: 2}
+
+			err := printFile(context.Background(), up, st, m, "/tmp/models/cube.3mf", opts)
+			if tt.step == "" {
+				assert.Nil(t, err)
+				assert.Equal(t, "/cube.3mf", up.remote)
+				assert.Equal(t, "file:///sdcard/cube.3mf", st.file.URL)
+				assert.Equal(t, "cube", st.file.SubtaskName)
+				assert.Equal(t, 2, st.file.Plate)
+				return
+			}
+			var printErr *PrintError
+			assert.True(t, errors.As(err, &printErr))
+			assert.Equal(t, tt.step, printErr.Step)
+			if tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err))
+			}
+			if tt.uploadErr != nil {
+				assert.True(t, errors.Is(err, tt.uploadErr))
+			}
+		})
+	}
+}
+
+func TestPrintFile_CloudClient(t *testing.T) {
+	c, err := mqtt.NewCloudClient("us.mqtt.bambulab.com", "01S00A000000000", "u_1", "token")
+	assert.Nil(t, err)
+	m, _ := newTestMonitor(t, "")
+	err = PrintFile(context.Background(), c, m, "cube.3mf", PrintOptions{})
+	var printErr *PrintError
+	assert.True(t, errors.As(err, &printErr))
+	assert.Equal(t, StepUpload, printErr.Step)
+	assert.True(t, errors.Is(err, ftps.ErrNotLocal))
+}
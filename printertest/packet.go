@@ -0,0 +1,235 @@
+package printertest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Control packet types of MQTT 3.1.1
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetUnsubscribe = 10
+	packetUnsuback    = 11
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+)
+
+// Connack return codes
+const (
+	connackAccepted       = 0
+	connackBadProtocol    = 1
+	connackBadCredentials = 4
+)
+
+const (
+	connectFlagUsername = 0x80
+	connectFlagPassword = 0x40
+	connectFlagWill     = 0x04
+)
+
+var errMalformed = errors.New("malformed packet")
+
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+type connect struct {
+	protocolLevel byte
+	clientID      string
+	username      string
+	password      string
+}
+
+type publish struct {
+	topic    string
+	qos      byte
+	packetID uint16
+	payload  []byte
+}
+
+type subscribe struct {
+	packetID uint16
+	topics   []string
+	qos      []byte
+}
+
+func readPacket(r *bufio.Reader) (packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	length, err := readRemainingLength(r)
+	if err != nil {
+		return packet{}, err
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+	return packet{kind: header >> 4, flags: header & 0x0f, body: body}, nil
+}
+
+func readRemainingLength(r io.ByteReader) (int, error) {
+	length, shift := 0, 0
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return length, nil
+		}
+		shift += 7
+	}
+	return 0, fmt.Errorf("%w: remaining length", errMalformed)
+}
+
+func encodePacket(kind, flags byte, body []byte) []byte {
+	b := []byte{kind<<4 | flags}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if length == 0 {
+			break
+		}
+	}
+	return append(b, body...)
+}
+
+// reader decodes the fields of a packet body.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil || len(r.b) < 1 {
+		r.err = errMalformed
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+func (r *reader) uint16() uint16 {
+	if r.err != nil || len(r.b) < 2 {
+		r.err = errMalformed
+		return 0
+	}
+	v := binary.BigEndian.Uint16(r.b)
+	r.b = r.b[2:]
+	return v
+}
+
+func (r *reader) string() string {
+	n := int(r.uint16())
+	if r.err != nil || len(r.b) < n {
+		r.err = errMalformed
+		return ""
+	}
+	v := string(r.b[:n])
+	r.b = r.b[n:]
+	return v
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func parseConnect(p packet) (connect, error) {
+	r := &reader{b: p.body}
+	c := connect{}
+	r.string() // protocol name
+	c.protocolLevel = r.byte()
+	flags := r.byte()
+	r.uint16() // keep alive
+	c.clientID = r.string()
+	if flags&connectFlagWill != 0 {
+		r.string()
+		r.string()
+	}
+	if flags&connectFlagUsername != 0 {
+		c.username = r.string()
+	}
+	if flags&connectFlagPassword != 0 {
+		c.password = r.string()
+	}
+	return c, r.err
+}
+
+func parsePublish(p packet) (publish, error) {
+	r := &reader{b: p.body}
+	m := publish{qos: (p.flags >> 1) & 0x03}
+	m.topic = r.string()
+	if m.qos > 0 {
+		m.packetID = r.uint16()
+	}
+	if r.err != nil {
+		return m, r.err
+	}
+	m.payload = r.b
+	return m, nil
+}
+
+func parseSubscribe(p packet) (subscribe, error) {
+	r := &reader{b: p.body}
+	s := subscribe{packetID: r.uint16()}
+	for r.err == nil && len(r.b) > 0 {
+		s.topics = append(s.topics, r.string())
+		s.qos = append(s.qos, r.byte())
+	}
+	return s, r.err
+}
+
+func encodeConnack(code byte) []byte {
+	return encodePacket(packetConnack, 0, []byte{0, code})
+}
+
+func encodePublish(topic string, payload []byte) []byte {
+	body := appendString(nil, topic)
+	return encodePacket(packetPublish, 0, append(body, payload...))
+}
+
+func encodeAck(kind byte, packetID uint16) []byte {
+	return encodePacket(kind, 0, binary.BigEndian.AppendUint16(nil, packetID))
+}
+
+func encodeSuback(packetID uint16, codes []byte) []byte {
+	body := binary.BigEndian.AppendUint16(nil, packetID)
+	return encodePacket(packetSuback, 0, append(body, codes...))
+}
+
+// topicMatch reports whether topic matches a subscription filter with
+// + and # wildcards.
+func topicMatch(filter, topic string) bool {
+	fs, ts := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) || (f != "+" && f != ts[i]) {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
@@ -0,0 +1,164 @@
+package printertest
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// printCancelledError is the print_error reported when a print is stopped
+const printCancelledError = 50348044
+
+// DefaultReport is the full report of an idle printer.
+func DefaultReport() map[string]any {
+	return map[string]any{
+		"gcode_state":          "IDLE",
+		"gcode_file":           "",
+		"subtask_name":         "",
+		"task_id":              "0",
+		"subtask_id":           "0",
+		"mc_percent":           0,
+		"mc_remaining_time":    0,
+		"layer_num":            0,
+		"total_layer_num":      0,
+		"print_error":          0,
+		"spd_lvl":              2,
+		"nozzle_temper":        25.0,
+		"nozzle_target_temper": 0,
+		"bed_temper":           25.0,
+		"bed_target_temper":    0,
+		"chamber_temper":       25.0,
+		"cooling_fan_speed":    "0",
+		"heatbreak_fan_speed":  "0",
+		"big_fan1_speed":       "0",
+		"big_fan2_speed":       "0",
+		"wifi_signal":          "-45dBm",
+		"hms":                  []any{},
+		"lights_report": []any{
+			map[string]any{"node": "chamber_light", "mode": "off"},
+		},
+		"ipcam": map[string]any{
+			"ipcam_dev":    "1",
+			"ipcam_record": "enable",
+			"timelapse":    "disable",
+			"resolution":   "1080p",
+			"tutk_server":  "disable",
+			"mode_bits":    3,
+		},
+	}
+}
+
+func defaultHandlers() map[string]Handler {
+	return map[string]Handler{
+		"pause":  reportHandler(map[string]any{"gcode_state": "PAUSE"}),
+		"resume": reportHandler(map[string]any{"gcode_state": "RUNNING"}),
+		"stop": reportHandler(map[string]any{
+			"gcode_state": "FAILED",
+			"print_error": printCancelledError,
+		}),
+		"print_speed": func(s *Server, cmd Command) map[string]any {
+			param, _ := cmd.Fields["param"].(string)
+			level, err := strconv.Atoi(param)
+			if err != nil {
+				return map[string]any{"result": "failed", "reason": "invalid speed level"}
+			}
+			s.Publish(map[string]any{"spd_lvl": level})
+			return nil
+		},
+		"ledctrl": func(s *Server, cmd Command) map[string]any {
+			node, _ := cmd.Fields["led_node"].(string)
+			mode, _ := cmd.Fields["led_mode"].(string)
+			s.Publish(map[string]any{
+				"lights_report": []any{map[string]any{"node": node, "mode": mode}},
+			})
+			return nil
+		},
+		"ipcam_record_set":     ipcamHandler("ipcam_record", "control"),
+		"ipcam_timelapse":      ipcamHandler("timelapse", "control"),
+		"ipcam_resolution_set": ipcamHandler("resolution", "resolution"),
+		"project_file": func(s *Server, cmd Command) map[string]any {
+			s.Publish(map[string]any{
+				"gcode_state":  "PREPARE",
+				"subtask_name": cmd.Fields["subtask_name"],
+				"print_error":  0,
+			})
+			return nil
+		},
+	}
+}
+
+// reportHandler publishes a fixed partial report in response to a command.
+func reportHandler(partial map[string]any) Handler {
+	return func(s *Server, _ Command) map[string]any {
+		s.Publish(partial)
+		return nil
+	}
+}
+
+// ipcamHandler copies a field of a camera command into the ipcam report.
+func ipcamHandler(reportField, commandField string) Handler {
+	return func(s *Server, cmd Command) map[string]any {
+		s.Publish(map[string]any{
+			"ipcam": map[string]any{reportField: cmd.Fields[commandField]},
+		})
+		return nil
+	}
+}
+
+// Step is a partial report sent after a delay.
+type Step struct {
+	Delay  time.Duration
+	Report map[string]any
+}
+
+// Play publishes each step in order, waiting for its delay first.
+func (s *Server) Play(ctx context.Context, steps []Step) error {
+	for _, step := range steps {
+		if step.Delay > 0 {
+			t := time.NewTimer(step.Delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			case <-t.C:
+			}
+		}
+		if err := s.Publish(step.Report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrintLifecycle scripts a print of name moving through PREPARE, RUNNING
+// with a report for every layer, then FINISH, interval apart.
+func PrintLifecycle(name string, layers int, interval time.Duration) []Step {
+	steps := []Step{{
+		Report: map[string]any{
+			"gcode_state":       "PREPARE",
+			"gcode_file":        name + ".gcode",
+			"subtask_name":      name,
+			"mc_percent":        0,
+			"layer_num":         0,
+			"total_layer_num":   layers,
+			"mc_remaining_time": layers,
+			"print_error":       0,
+		},
+	}}
+	for layer := 1; layer <= layers; layer++ {
+		steps = append(steps, Step{
+			Delay: interval,
+			Report: map[string]any{
+				"gcode_state":       "RUNNING",
+				"layer_num":         layer,
+				"mc_percent":        layer * 100 / layers,
+				"mc_remaining_time": layers - layer,
+			},
+		})
+	}
+	steps = append(steps, Step{
+		Delay:  interval,
+		Report: map[string]any{"gcode_state": "FINISH", "mc_percent": 100},
+	})
+	return steps
+}
@@ -0,0 +1,458 @@
+// Package printertest runs a local MQTT broker emulating a printer, so code
+// using the mqtt, monitor and printer packages can be tested without one.
+package printertest
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/mqtt"
+)
+
+const (
+	DefaultSerial     = "01S00A000000000"
+	DefaultAccessCode = "12345678"
+
+	username = "bblp"
+	host     = "127.0.0.1"
+)
+
+// Request is a message published by a client to the printer.
+type Request struct {
+	Time    time.Time
+	Topic   string
+	Payload []byte
+}
+
+// Command is a request decoded into its command group, e.g. print or
+// system, and the fields of the command.
+type Command struct {
+	Group      string
+	Name       string
+	SequenceID string
+	Fields     map[string]any
+}
+
+// Handler responds to a command. It returns fields added to the response,
+// a nil map responds with success.
+type Handler func(s *Server, cmd Command) map[string]any
+
+// Server is a broker emulating a printer. Clients publishing to the request
+// topic of the printer are answered on its report topic.
+type Server struct {
+	Serial     string
+	AccessCode string
+	// Addr the server listens on, host:port
+	Addr string
+
+	listener net.Listener
+	roots    *x509.CertPool
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	report   map[string]any
+	conns    map[*conn]struct{}
+	requests []Request
+	handlers map[string]Handler
+	notify   chan struct{}
+	closed   bool
+}
+
+// NewServer starts a server for the default serial and access code.
+func NewServer() (*Server, error) {
+	return NewServerFor(DefaultSerial, DefaultAccessCode)
+}
+
+// NewServerFor starts a server for a printer with the serial and access code.
+func NewServerFor(serial, accessCode string) (*Server, error) {
+	cert, err := selfSigned()
+	if err != nil {
+		return nil, err
+	}
+	l, err := tls.Listen("tcp", net.JoinHostPort(host, "0"), &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.Leaf)
+	s := &Server{
+		Serial:     serial,
+		AccessCode: accessCode,
+		Addr:       l.Addr().String(),
+		listener:   l,
+		roots:      roots,
+		report:     DefaultReport(),
+		conns:      make(map[*conn]struct{}),
+		handlers:   defaultHandlers(),
+		notify:     make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Client creates a local mqtt client for the server.
+func (s *Server) Client() (*mqtt.Client, error) {
+	return mqtt.NewLocalClient(host, s.Serial, s.AccessCode, s.ClientOptions()...)
+}
+
+// ClientOptions connect an mqtt client to the server rather than the
+// printer at its host, trusting the certificate of the server.
+func (s *Server) ClientOptions() []mqtt.ClientOption {
+	return []mqtt.ClientOption{
+		mqtt.WithBroker("ssl://" + s.Addr),
+		mqtt.WithTLSConfig(&tls.Config{RootCAs: s.roots}),
+	}
+}
+
+// Close stops the server and disconnects every client.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	conns := s.conns
+	s.conns = make(map[*conn]struct{})
+	s.mu.Unlock()
+
+	s.listener.Close()
+	for c := range conns {
+		c.close()
+	}
+	s.wg.Wait()
+}
+
+// Handle sets the handler for a command, replacing any built in handler.
+func (s *Server) Handle(command string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[command] = h
+}
+
+// Report returns a copy of the full report sent in answer to pushall.
+func (s *Server) Report() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyMap(s.report)
+}
+
+// SetReport replaces the full report sent in answer to pushall.
+func (s *Server) SetReport(report map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report = copyMap(report)
+}
+
+// Publish sends a partial report to subscribed clients and merges it
+// into the full report.
+func (s *Server) Publish(partial map[string]any) error {
+	s.mu.Lock()
+	for k, v := range partial {
+		// Objects like ipcam are reported partially too
+		if in, ok := v.(map[string]any); ok {
+			if og, ok := s.report[k].(map[string]any); ok {
+				merged := copyMap(og)
+				for ik, iv := range in {
+					merged[ik] = iv
+				}
+				v = merged
+			}
+		}
+		s.report[k] = v
+	}
+	s.mu.Unlock()
+	return s.publish(map[string]any{"print": partial})
+}
+
+// Requests returns every request received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+// WaitCommand blocks until a command with the name has been received,
+// returning the first one received.
+func (s *Server) WaitCommand(ctx context.Context, name string) (Command, error) {
+	for {
+		s.mu.Lock()
+		requests, notify := s.requests, s.notify
+		s.mu.Unlock()
+		for _, r := range requests {
+			if cmd, err := r.Command(); err == nil && cmd.Name == name {
+				return cmd, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return Command{}, ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+// Command decodes the request.
+func (r Request) Command() (Command, error) {
+	raw := map[string]map[string]any{}
+	if err := json.Unmarshal(r.Payload, &raw); err != nil {
+		return Command{}, err
+	}
+	for group, fields := range raw {
+		cmd := Command{Group: group, Fields: fields}
+		cmd.Name, _ = fields["command"].(string)
+		cmd.SequenceID, _ = fields["sequence_id"].(string)
+		return cmd, nil
+	}
+	return Command{}, errors.New("empty request")
+}
+
+func (s *Server) reportTopic() string {
+	return fmt.Sprintf("device/%s/report", s.Serial)
+}
+
+func (s *Server) requestTopic() string {
+	return fmt.Sprintf("device/%s/request", s.Serial)
+}
+
+// publish sends a message on the report topic to every subscribed client.
+func (s *Server) publish(msg any) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	topic := s.reportTopic()
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		if c.subscribed(topic) {
+			c.write(encodePublish(topic, b))
+		}
+	}
+	return nil
+}
+
+// handleRequest records a request and answers it on the report topic.
+func (s *Server) handleRequest(topic string, payload []byte) {
+	r := Request{Time: time.Now(), Topic: topic, Payload: append([]byte{}, payload...)}
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	close(s.notify)
+	s.notify = make(chan struct{})
+	s.mu.Unlock()
+
+	if topic != s.requestTopic() {
+		return
+	}
+	cmd, err := r.Command()
+	if err != nil {
+		fmt.Printf("fake printer ignored request, err=%s, payload=%s\n", err, payload)
+		return
+	}
+	if cmd.Name == "pushall" {
+		s.pushAll(cmd)
+		return
+	}
+
+	s.mu.Lock()
+	h, ok := s.handlers[cmd.Name]
+	s.mu.Unlock()
+	var fields map[string]any
+	if ok {
+		fields = h(s, cmd)
+	}
+	response := map[string]any{
+		"command":     cmd.Name,
+		"sequence_id": cmd.SequenceID,
+		"result":      "success",
+		"reason":      "",
+	}
+	for k, v := range fields {
+		response[k] = v
+	}
+	s.publish(map[string]any{cmd.Group: response})
+}
+
+func (s *Server) pushAll(cmd Command) {
+	report := s.Report()
+	report["command"] = "push_status"
+	report["msg"] = 0
+	report["sequence_id"] = cmd.SequenceID
+	s.publish(map[string]any{"print": report})
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{conn: nc, subs: map[string]bool{}}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(c)
+		}()
+	}
+}
+
+func (s *Server) serveConn(c *conn) {
+	defer c.close()
+	r := bufio.NewReader(c.conn)
+	p, err := readPacket(r)
+	if err != nil || p.kind != packetConnect {
+		return
+	}
+	connect, err := parseConnect(p)
+	if err != nil {
+		return
+	}
+	switch {
+	case connect.protocolLevel != 3 && connect.protocolLevel != 4:
+		c.write(encodeConnack(connackBadProtocol))
+		return
+	case connect.username != username || connect.password != s.AccessCode:
+		c.write(encodeConnack(connackBadCredentials))
+		return
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+	}()
+	c.write(encodeConnack(connackAccepted))
+
+	for {
+		p, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch p.kind {
+		case packetPublish:
+			m, err := parsePublish(p)
+			if err != nil {
+				return
+			}
+			if m.qos > 0 {
+				c.write(encodeAck(packetPuback, m.packetID))
+			}
+			s.handleRequest(m.topic, m.payload)
+		case packetSubscribe:
+			sub, err := parseSubscribe(p)
+			if err != nil {
+				return
+			}
+			codes := make([]byte, len(sub.topics))
+			for i, topic := range sub.topics {
+				// Reports are always sent at most once
+				codes[i] = 0
+				c.subscribe(topic, true)
+			}
+			c.write(encodeSuback(sub.packetID, codes))
+		case packetUnsubscribe:
+			rd := &reader{b: p.body}
+			id := rd.uint16()
+			for rd.err == nil && len(rd.b) > 0 {
+				c.subscribe(rd.string(), false)
+			}
+			c.write(encodeAck(packetUnsuback, id))
+		case packetPingreq:
+			c.write(encodePacket(packetPingresp, 0, nil))
+		case packetDisconnect:
+			return
+		}
+	}
+}
+
+// conn is a connected client.
+type conn struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	subs    map[string]bool
+}
+
+func (c *conn) write(b []byte) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.Write(b)
+}
+
+func (c *conn) subscribe(filter string, on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if on {
+		c.subs[filter] = true
+	} else {
+		delete(c.subs, filter)
+	}
+}
+
+func (c *conn) subscribed(topic string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for filter := range c.subs {
+		if topicMatch(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *conn) close() {
+	c.conn.Close()
+}
+
+func copyMap(m map[string]any) map[string]any {
+	c := make(map[string]any, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func selfSigned() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "printertest"},
+		IPAddresses:  []net.IP{net.ParseIP(host)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
@@ -0,0 +1,240 @@
+package printertest
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/mqtt"
+	"github.com/evanofslack/bambulab-client/printer"
+	"github.com/stretchr/testify/assert"
+)
+
+func runPrinter(t *testing.T, s *Server, opts ...monitor.Option) *printer.Printer {
+	c, err := s.Client()
+	assert.Nil(t, err)
+	p := printer.New(c, opts...)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer waitCancel()
+	assert.Nil(t, p.WaitReady(waitCtx))
+	return p
+}
+
+func newTestServer(t *testing.T) *Server {
+	s, err := NewServer()
+	assert.Nil(t, err)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestServer_PushAll(t *testing.T) {
+	s := newTestServer(t)
+	report := DefaultReport()
+	report["nozzle_temper"] = 220.5
+	report["gcode_state"] = "FINISH"
+	s.SetReport(report)
+
+	p := runPrinter(t, s)
+	state := p.State()
+	assert.Equal(t, "FINISH", state.Gcode.State.Unwrap())
+	assert.Equal(t, 220.5, state.Nozzle.Temperature.Unwrap())
+	assert.Equal(t, "1080p", state.Camera.Resolution.Unwrap())
+
+	cmd, err := s.WaitCommand(context.Background(), "pushall")
+	assert.Nil(t, err)
+	assert.Equal(t, "pushing", cmd.Group)
+}
+
+func TestServer_StalePrinter(t *testing.T) {
+	s := newTestServer(t)
+	p := runPrinter(t, s, monitor.WithStaleTimeout(100*time.Millisecond))
+	events := p.Monitor().Subscribe(10)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A quiet printer is asked for a full report, which makes it fresh
+	var seen []monitor.EventType
+	for len(seen) < 2 {
+		select {
+		case e := <-events:
+			if e.Type == monitor.EventStateStale || e.Type == monitor.EventStateFresh {
+				seen = append(seen, e.Type)
+			}
+		case <-ctx.Done():
+			t.Fatalf("stale printer not refreshed, events=%v", seen)
+		}
+	}
+	assert.Equal(t, []monitor.EventType{monitor.EventStateStale, monitor.EventStateFresh}, seen)
+
+	pushAlls := 0
+	for _, r := range s.Requests() {
+		if cmd, err := r.Command(); err == nil && cmd.Name == "pushall" {
+			pushAlls++
+		}
+	}
+	assert.GreaterOrEqual(t, pushAlls, 2)
+}
+
+func TestServer_Commands(t *testing.T) {
+	s := newTestServer(t)
+	p := runPrinter(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.Nil(t, p.Pause(ctx))
+	cmd, err := s.WaitCommand(ctx, "pause")
+	assert.Nil(t, err)
+	assert.Equal(t, "print", cmd.Group)
+	assert.Eventually(t, func() bool {
+		return p.State().Gcode.State.TakeOr("") == "PAUSE"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, p.SetTimelapse(ctx, true))
+	assert.Eventually(t, func() bool {
+		return p.State().Camera.Timelapse.TakeOr(false)
+	}, 5*time.Second, 10*time.Millisecond)
+	// Partial ipcam reports keep the rest of the camera state
+	assert.Equal(t, "1080p", s.Report()["ipcam"].(map[string]any)["resolution"])
+
+	s.Handle("print_speed", func(s *Server, cmd Command) map[string]any {
+		return map[string]any{"result": "failed", "reason": "not printing"}
+	})
+	assert.Nil(t, p.SetSpeed(ctx, mqtt.SpeedSport))
+	_, err = s.WaitCommand(ctx, "print_speed")
+	assert.Nil(t, err)
+	assert.Len(t, s.Requests(), 4)
+}
+
+func TestServer_SequenceIDs(t *testing.T) {
+	s := newTestServer(t)
+	c, err := s.Client()
+	assert.Nil(t, err)
+	var mu sync.Mutex
+	replies := map[string]string{}
+	c.OnReport(func(_ string, payload []byte) {
+		var msg map[string]map[string]any
+		if json.Unmarshal(payload, &msg) != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, fields := range msg {
+			if seq, ok := fields["sequence_id"].(string); ok {
+				replies[seq], _ = fields["command"].(string)
+			}
+		}
+	})
+	c.Subscribe(make(chan mqtt.Message, 16))
+	assert.Nil(t, c.Connect())
+	defer c.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	publish := []func(context.Context) error{c.PublishPause, c.PublishResume, c.PublishStop, c.PublishPushAll}
+	var wg sync.WaitGroup
+	for _, p := range publish {
+		wg.Add(1)
+		go func(p func(context.Context) error) {
+			defer wg.Done()
+			assert.Nil(t, p(ctx))
+		}(p)
+	}
+	wg.Wait()
+
+	ids := map[string]string{}
+	for _, r := range s.Requests() {
+		cmd, err := r.Command()
+		assert.Nil(t, err)
+		ids[cmd.SequenceID] = cmd.Name
+	}
+	assert.Len(t, ids, len(publish), "every command has its own id")
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		for id, name := range ids {
+			reply, ok := replies[id]
+			if !ok || (reply != name && !(name == "pushall" && reply == "push_status")) {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestServer_PrintLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	p := runPrinter(t, s)
+	events := p.Subscribe(100)
+
+	assert.Nil(t, s.Play(context.Background(), PrintLifecycle("cube", 3, 10*time.Millisecond)))
+
+	seen := []monitor.EventType{}
+	timeout := time.After(5 * time.Second)
+	for len(seen) == 0 || seen[len(seen)-1] != monitor.EventPrintFinished {
+		select {
+		case e := <-events:
+			if e.Type != monitor.EventUpdate {
+				seen = append(seen, e.Type)
+			}
+		case <-timeout:
+			t.Fatalf("print did not finish, events=%v", seen)
+		}
+	}
+	assert.Equal(t, []monitor.EventType{monitor.EventPrintStarted, monitor.EventPrintFinished}, seen)
+	assert.Equal(t, "cube", p.State().CurrentPrint.Subtask.Unwrap())
+	assert.Equal(t, 3, p.State().CurrentPrint.LayerNumber.Unwrap())
+}
+
+func TestServer_BadAccessCode(t *testing.T) {
+	s := newTestServer(t)
+	conn, err := tls.Dial("tcp", s.Addr, &tls.Config{InsecureSkipVerify: true})
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, connectFlagUsername|connectFlagPassword, 0, 10)
+	body = appendString(body, "client")
+	body = appendString(body, username)
+	body = appendString(body, "wrong")
+	_, err = conn.Write(encodePacket(packetConnect, 0, body))
+	assert.Nil(t, err)
+
+	p, err := readPacket(bufio.NewReader(conn))
+	assert.Nil(t, err)
+	assert.Equal(t, byte(packetConnack), p.kind)
+	assert.Equal(t, []byte{0, connackBadCredentials}, p.body)
+}
+
+func TestTopicMatch(t *testing.T) {
+	tests := []struct {
+		filter   string
+		topic    string
+		expected bool
+	}{
+		{filter: "device/A/report", topic: "device/A/report", expected: true},
+		{filter: "device/A/report", topic: "device/B/report", expected: false},
+		{filter: "device/+/report", topic: "device/B/report", expected: true},
+		{filter: "device/#", topic: "device/B/report", expected: true},
+		{filter: "device/+", topic: "device/B/report", expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			assert.Equal(t, tt.expected, topicMatch(tt.filter, tt.topic))
+		})
+	}
+}
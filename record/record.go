@@ -0,0 +1,228 @@
+// Package record writes printer reports to JSONL files and replays them,
+// so behaviour seen in the field can be reproduced.
+package record
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/mqtt"
+)
+
+const (
+	filePerm = 0o644
+	// Reports with large AMS data exceed the default scanner buffer
+	maxLineSize = 4 * 1024 * 1024
+)
+
+// Speed to replay at, relative to the original timing.
+// MaxSpeed replays without delays.
+const (
+	OriginalSpeed = 1.0
+	MaxSpeed      = 0.0
+)
+
+// Entry is one recorded report.
+type Entry struct {
+	Time    time.Time       `json:"time"`
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// newEntry keeps valid json payloads as is so recordings are readable,
+// anything else is stored as a json string.
+func newEntry(t time.Time, topic string, payload []byte) (Entry, error) {
+	e := Entry{Time: t, Topic: topic}
+	if json.Valid(payload) {
+		e.Payload = append(json.RawMessage{}, payload...)
+		return e, nil
+	}
+	b, err := json.Marshal(string(payload))
+	if err != nil {
+		return e, err
+	}
+	e.Payload = b
+	return e, nil
+}
+
+// Message parses the payload of the entry.
+func (e Entry) Message() (mqtt.Message, error) {
+	m := mqtt.Message{}
+	err := json.Unmarshal(e.Payload, &m)
+	return m, err
+}
+
+// Recorder writes reports to a JSONL file, one entry per line.
+type Recorder struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer
+	err    error
+}
+
+// NewRecorder writes entries to w.
+func NewRecorder(w io.Writer) *Recorder {
+	r := &Recorder{w: bufio.NewWriter(w)}
+	if c, ok := w.(io.Closer); ok {
+		r.closer = c
+	}
+	return r
+}
+
+// Create appends entries to the file at path, creating it if needed.
+func Create(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, filePerm)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecorder(f), nil
+}
+
+// Attach records every report received by the client.
+func (r *Recorder) Attach(c *mqtt.Client) {
+	c.OnReport(func(topic string, payload []byte) {
+		if err := r.Record(topic, payload); err != nil {
+			fmt.Fprintf(c.LogOutput(), "fail record report, topic=%s, err=%s\n", topic, err)
+		}
+	})
+}
+
+// Record writes a report received now. Each entry is flushed so a
+// recording survives the process being killed.
+func (r *Recorder) Record(topic string, payload []byte) error {
+	e, err := newEntry(time.Now(), topic, payload)
+	if err != nil {
+		return err
+	}
+	return r.Write(e)
+}
+
+// Write writes an entry.
+func (r *Recorder) Write(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	if _, err := r.w.Write(append(b, '\n')); err != nil {
+		r.err = err
+		return err
+	}
+	if err := r.w.Flush(); err != nil {
+		r.err = err
+		return err
+	}
+	return nil
+}
+
+// Close flushes the recording and closes the underlying file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.w.Flush()
+	if r.closer != nil {
+		if cerr := r.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Read reads every entry of a recording.
+func Read(r io.Reader) ([]Entry, error) {
+	entries := []Entry{}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), maxLineSize)
+	line := 0
+	for s.Scan() {
+		line++
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		e := Entry{}
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("read recording line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ReadFile reads every entry of the recording at path.
+func ReadFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Replay sends the reports of a recording to msgs, waiting between them
+// for the original gap divided by speed. Reports which can't be parsed
+// are skipped, as the client does.
+func Replay(ctx context.Context, entries []Entry, msgs chan<- mqtt.Message, speed float64) error {
+	for i, e := range entries {
+		if i > 0 && speed > 0 {
+			gap := e.Time.Sub(entries[i-1].Time)
+			if err := sleep(ctx, time.Duration(float64(gap)/speed)); err != nil {
+				return err
+			}
+		}
+		m, err := e.Message()
+		if err != nil {
+			fmt.Printf("fail parse msg, err=%s, msg=%s\n", err, e.Payload)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msgs <- m:
+		}
+	}
+	return nil
+}
+
+// ReplayMonitor feeds a recording into the monitor and returns once every
+// report has been processed. The monitor must not already be started.
+func ReplayMonitor(ctx context.Context, entries []Entry, m *monitor.Monitor, speed float64) error {
+	// Unbuffered so each report is merged before the next is sent
+	msgs := make(chan mqtt.Message)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Start(msgs)
+	}()
+	err := Replay(ctx, entries, msgs, speed)
+	close(msgs)
+	<-done
+	return err
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
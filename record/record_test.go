@@ -0,0 +1,134 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/printer"
+	"github.com/evanofslack/bambulab-client/printertest"
+	"github.com/stretchr/testify/assert"
+)
+
+const topic = "device/01S00A000000000/report"
+
+var base = time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+
+func testEntries(t *testing.T, gap time.Duration) []Entry {
+	payloads := []string{
+		`{"print": {"gcode_state": "IDLE", "nozzle_temper": 25.0}}`,
+		`{"print": {"gcode_state": "PREPARE", "subtask_name": "cube"}}`,
+		`not json`,
+		`{"print": {"gcode_state": "RUNNING", "mc_percent": 10}}`,
+		`{"print": {"gcode_state": "FINISH", "mc_percent": 100}}`,
+	}
+	entries := []Entry{}
+	for i, p := range payloads {
+		e, err := newEntry(base.Add(time.Duration(i)*gap), topic, []byte(p))
+		assert.Nil(t, err)
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestRecorder_RoundTrip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	r := NewRecorder(buf)
+	entries := testEntries(t, time.Second)
+	for _, e := range entries {
+		assert.Nil(t, r.Write(e))
+	}
+	assert.Nil(t, r.Close())
+
+	read, err := Read(buf)
+	assert.Nil(t, err)
+	assert.Len(t, read, len(entries))
+	for i := range entries {
+		assert.True(t, entries[i].Time.Equal(read[i].Time))
+		assert.Equal(t, entries[i].Topic, read[i].Topic)
+		assert.JSONEq(t, string(entries[i].Payload), string(read[i].Payload))
+	}
+	// Invalid payloads are kept as strings
+	assert.Equal(t, `"not json"`, string(read[2].Payload))
+}
+
+func TestReplayMonitor(t *testing.T) {
+	m := monitor.New()
+	defer m.Stop()
+	events := m.Subscribe(10)
+
+	assert.Nil(t, ReplayMonitor(context.Background(), testEntries(t, time.Hour), m, MaxSpeed))
+	state := m.CurrentState()
+	assert.Equal(t, "FINISH", state.Gcode.State.Unwrap())
+	assert.Equal(t, "cube", state.CurrentPrint.Subtask.Unwrap())
+	assert.Equal(t, 100, state.CurrentPrint.Percent.Unwrap())
+	assert.Equal(t, uint64(1), m.Counters().PrintsFinished)
+
+	types := []monitor.EventType{}
+	for len(events) > 0 {
+		if e := <-events; e.Type != monitor.EventUpdate {
+			types = append(types, e.Type)
+		}
+	}
+	assert.Equal(t, []monitor.EventType{monitor.EventPrintStarted, monitor.EventPrintFinished}, types)
+}
+
+func TestReplay_Speed(t *testing.T) {
+	entries := testEntries(t, 100*time.Millisecond)
+	m := monitor.New()
+	defer m.Stop()
+	start := time.Now()
+	assert.Nil(t, ReplayMonitor(context.Background(), entries, m, 10))
+	// Four gaps of 100ms at ten times speed
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 40*time.Millisecond)
+	assert.Less(t, elapsed, 400*time.Millisecond)
+}
+
+func TestReplay_Cancel(t *testing.T) {
+	m := monitor.New()
+	defer m.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := ReplayMonitor(ctx, testEntries(t, time.Hour), m, OriginalSpeed)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, "IDLE", m.CurrentState().Gcode.State.Unwrap())
+}
+
+func TestRecorder_Attach(t *testing.T) {
+	s, err := printertest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+	c, err := s.Client()
+	assert.Nil(t, err)
+
+	path := filepath.Join(t.TempDir(), "reports.jsonl")
+	r, err := Create(path)
+	assert.Nil(t, err)
+	r.Attach(c)
+
+	p := printer.New(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx)
+	}()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer waitCancel()
+	assert.Nil(t, p.WaitReady(waitCtx))
+	cancel()
+	<-done
+	assert.Nil(t, r.Close())
+
+	entries, err := ReadFile(path)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, entries)
+	assert.Equal(t, topic, entries[0].Topic)
+	msg, err := entries[0].Message()
+	assert.Nil(t, err)
+	assert.Equal(t, "IDLE", *msg.Print.GcodeState)
+}
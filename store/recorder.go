@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+)
+
+const defaultSnapshotInterval = 5 * time.Minute
+
+// RecorderOption configures a Recorder.
+type RecorderOption func(*Recorder)
+
+// WithSnapshotInterval sets how often the state of every printer is added
+// to the store, 5 minutes by default. Zero disables snapshots.
+func WithSnapshotInterval(d time.Duration) RecorderOption {
+	return func(r *Recorder) {
+		r.interval = d
+	}
+}
+
+// WithLogOutput writes the logs of the recorder to w instead of stdout.
+func WithLogOutput(w io.Writer) RecorderOption {
+	return func(r *Recorder) {
+		r.log = w
+	}
+}
+
+// Event is a monitor event of the printer with the serial.
+type Event struct {
+	monitor.Event
+	Serial string
+}
+
+// Recorder populates a store from printer events, adding a job when a
+// print ends and snapshots of the last known states at an interval.
+type Recorder struct {
+	store    *Store
+	interval time.Duration
+	log      io.Writer
+	mu       sync.Mutex
+	started  map[string]time.Time
+	ended    map[string]bool
+	states   map[string]monitor.State
+}
+
+// NewRecorder creates a recorder adding to s.
+func NewRecorder(s *Store, opts ...RecorderOption) *Recorder {
+	r := &Recorder{
+		store:    s,
+		interval: defaultSnapshotInterval,
+		log:      os.Stdout,
+		started:  make(map[string]time.Time),
+		ended:    make(map[string]bool),
+		states:   make(map[string]monitor.State),
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// Run records events until the context is done or the channel is closed.
+func (r *Recorder) Run(ctx context.Context, events <-chan Event) {
+	var tick <-chan time.Time
+	if r.interval > 0 {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := r.Handle(e.Serial, e.Event); err != nil {
+				fmt.Fprintf(r.log, "fail record event, serial=%s, event=%s, err=%s\n", e.Serial, e.Type, err)
+			}
+		case t := <-tick:
+			if err := r.Snapshot(t); err != nil {
+				fmt.Fprintf(r.log, "fail record snapshot, err=%s\n", err)
+			}
+		}
+	}
+}
+
+// Handle records an event of the printer with the serial. When a print
+// ends a job is added, started at the time of the matching print started
+// event or at the zero time if it was missed. Only the first end of a
+// print is recorded, further ends are ignored until the printer runs again.
+func (r *Recorder) Handle(serial string, e monitor.Event) error {
+	r.mu.Lock()
+	r.states[serial] = e.State
+	if e.State.Gcode.State.TakeOr("") == "RUNNING" {
+		r.ended[serial] = false
+	}
+	var outcome Outcome
+	switch e.Type {
+	case monitor.EventPrintStarted:
+		r.started[serial] = e.Time
+		r.ended[serial] = false
+		r.mu.Unlock()
+		return nil
+	case monitor.EventPrintFinished:
+		outcome = OutcomeFinished
+	case monitor.EventPrintFailed:
+		outcome = OutcomeFailed
+	case monitor.EventPrintCancelled:
+		outcome = OutcomeCancelled
+	default:
+		r.mu.Unlock()
+		return nil
+	}
+	if r.ended[serial] {
+		r.mu.Unlock()
+		return nil
+	}
+	started := r.started[serial]
+	delete(r.started, serial)
+	r.ended[serial] = true
+	r.mu.Unlock()
+	return r.store.AddJob(NewJob(serial, e.State, outcome, started, e.Time))
+}
+
+// Snapshot adds the last known state of every printer to the store, taken
+// at t.
+func (r *Recorder) Snapshot(t time.Time) error {
+	r.mu.Lock()
+	snapshots := make([]Snapshot, 0, len(r.states))
+	for serial, s := range r.states {
+		snapshots = append(snapshots, Snapshot{Serial: serial, Time: t, State: s})
+	}
+	r.mu.Unlock()
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Serial < snapshots[j].Serial
+	})
+
+	var errs []error
+	for _, sn := range snapshots {
+		if err := r.store.AddSnapshot(sn); err != nil {
+			errs = append(errs, fmt.Errorf("snapshot %s: %w", sn.Serial, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+	"github.com/evanofslack/bambulab-client/mqtt"
+	opt "github.com/moznion/go-optional"
+	"github.com/stretchr/testify/assert"
+)
+
+func printMsg(gcodeState, subtask string) mqtt.Message {
+	return mqtt.Message{Print: &mqtt.Print{GcodeState: &gcodeState, SubtaskName: &subtask}}
+}
+
+// cancelMsg is a cancel as reported by the printer, failed with the
+// cancel error.
+func cancelMsg(subtask string) mqtt.Message {
+	msg := printMsg("FAILED", subtask)
+	printError := 50348044
+	msg.Print.PrintError = &printError
+	return msg
+}
+
+func TestRecorder_Run(t *testing.T) {
+	s, err := Open(t.TempDir())
+	assert.Nil(t, err)
+	r := NewRecorder(s, WithSnapshotInterval(20*time.Millisecond))
+
+	m := monitor.New()
+	defer m.Stop()
+	msgs := make(chan mqtt.Message)
+	go m.Start(msgs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan Event)
+	sub := m.Subscribe(32)
+	go func() {
+		for e := range sub {
+			events <- Event{Event: e, Serial: "A"}
+		}
+	}()
+	go r.Run(ctx, events)
+
+	for _, msg := range []mqtt.Message{
+		printMsg("IDLE", ""),
+		printMsg("RUNNING", "cube"),
+		printMsg("FINISH", "cube"),
+		printMsg("IDLE", "cube"),
+		printMsg("RUNNING", "benchy"),
+		printMsg("FAILED", "benchy"),
+		printMsg("IDLE", "benchy"),
+		printMsg("RUNNING", "boat"),
+		cancelMsg("boat"),
+	} {
+		msgs <- msg
+	}
+
+	var jobs []Job
+	assert.Eventually(t, func() bool {
+		jobs, err = s.Jobs(Query{Serial: "A"})
+		return err == nil && len(jobs) >= 3
+	}, time.Second, 10*time.Millisecond)
+	assert.Len(t, jobs, 3)
+	assert.Equal(t, "cube", jobs[0].Name)
+	assert.Equal(t, OutcomeFinished, jobs[0].Outcome)
+	assert.Equal(t, "benchy", jobs[1].Name)
+	assert.Equal(t, OutcomeFailed, jobs[1].Outcome)
+	assert.Equal(t, "boat", jobs[2].Name)
+	assert.Equal(t, OutcomeCancelled, jobs[2].Outcome)
+	for _, j := range jobs {
+		assert.False(t, j.StartedAt.IsZero())
+		assert.False(t, j.EndedAt.Before(j.StartedAt))
+	}
+
+	assert.Eventually(t, func() bool {
+		snapshots, err := s.Snapshots(Query{Serial: "A"})
+		return err == nil && len(snapshots) > 0 &&
+			snapshots[len(snapshots)-1].State.CurrentPrint.Subtask.TakeOr("") == "boat"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRecorder_Handle(t *testing.T) {
+	s, err := Open(t.TempDir())
+	assert.Nil(t, err)
+	r := NewRecorder(s)
+
+	state := func(gcodeState string, printError int) monitor.State {
+		return monitor.State{
+			Gcode:        monitor.Gcode{State: opt.Some(gcodeState)},
+			CurrentPrint: monitor.CurrentPrint{PrintError: opt.Some(printError)},
+		}
+	}
+	// A cancel is reported as failed with the cancel error, which may
+	// also be seen as a failed print
+	cancelled := state("FAILED", 50348044)
+	events := []struct {
+		serial string
+		event  monitor.Event
+	}{
+		{"A", monitor.Event{Type: monitor.EventPrintStarted, Time: base, State: state("RUNNING", 0)}},
+		{"B", monitor.Event{Type: monitor.EventUpdate, Time: base, State: state("IDLE", 0)}},
+		{"A", monitor.Event{Type: monitor.EventUpdate, Time: base.Add(time.Hour), State: cancelled}},
+		{"A", monitor.Event{Type: monitor.EventPrintCancelled, Time: base.Add(time.Hour), State: cancelled}},
+		{"A", monitor.Event{Type: monitor.EventPrintFailed, Time: base.Add(time.Hour), State: cancelled}},
+		// A second end of the cancelled print is ignored
+		{"A", monitor.Event{Type: monitor.EventPrintFinished, Time: base.Add(time.Hour), State: state("FINISH", 0)}},
+		// The start of this print was missed
+		{"A", monitor.Event{Type: monitor.EventUpdate, Time: base.Add(90 * time.Minute), State: state("RUNNING", 0)}},
+		{"A", monitor.Event{Type: monitor.EventPrintFinished, Time: base.Add(2 * time.Hour), State: state("FINISH", 0)}},
+	}
+	for _, e := range events {
+		assert.Nil(t, r.Handle(e.serial, e.event))
+	}
+
+	jobs, err := s.Jobs(Query{})
+	assert.Nil(t, err)
+	assert.Equal(t, []Job{
+		{Serial: "A", Outcome: OutcomeCancelled, StartedAt: base, EndedAt: base.Add(time.Hour)},
+		{Serial: "A", Outcome: OutcomeFinished, EndedAt: base.Add(2 * time.Hour)},
+	}, jobs)
+
+	assert.Nil(t, r.Snapshot(base.Add(3*time.Hour)))
+	snapshots, err := s.Snapshots(Query{})
+	assert.Nil(t, err)
+	assert.Len(t, snapshots, 2)
+	assert.Equal(t, "A", snapshots[0].Serial)
+	assert.Equal(t, "FINISH", snapshots[0].State.Gcode.State.Unwrap())
+	assert.Equal(t, "B", snapshots[1].Serial)
+	assert.Equal(t, base.Add(3*time.Hour), snapshots[1].Time)
+}
@@ -0,0 +1,373 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+)
+
+const (
+	jobsFile      = "jobs.jsonl"
+	snapshotsFile = "snapshots.jsonl"
+	filePerm      = 0o644
+	dirPerm       = 0o755
+)
+
+// Outcome is how a print job ended.
+type Outcome string
+
+const (
+	OutcomeFinished  Outcome = "finished"
+	OutcomeFailed    Outcome = "failed"
+	OutcomeCancelled Outcome = "cancelled"
+)
+
+// Job is a completed print job.
+type Job struct {
+	Serial    string    `json:"serial"`
+	TaskID    string    `json:"task_id,omitempty"`
+	SubtaskID string    `json:"subtask_id,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	File      string    `json:"file,omitempty"`
+	Outcome   Outcome   `json:"outcome"`
+	Layers    int       `json:"layers,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+}
+
+// Duration is the wall clock time the job ran for.
+func (j Job) Duration() time.Duration {
+	if j.StartedAt.IsZero() || j.EndedAt.IsZero() {
+		return 0
+	}
+	return j.EndedAt.Sub(j.StartedAt)
+}
+
+// NewJob creates a job from the state of a printer at the time it ended.
+func NewJob(serial string, s monitor.State, outcome Outcome, started, ended time.Time) Job {
+	return Job{
+		Serial:    serial,
+		TaskID:    s.CurrentPrint.TaskID.TakeOr(""),
+		SubtaskID: s.CurrentPrint.SubtaskID.TakeOr(""),
+		Name:      s.CurrentPrint.Subtask.TakeOr(""),
+		File:      s.Gcode.File.TakeOr(""),
+		Outcome:   outcome,
+		Layers:    s.CurrentPrint.LayerNumberTarget.TakeOr(0),
+		StartedAt: started,
+		EndedAt:   ended,
+	}
+}
+
+// Snapshot is the state of a printer at a point in time.
+type Snapshot struct {
+	Serial string        `json:"serial"`
+	Time   time.Time     `json:"time"`
+	State  monitor.State `json:"state"`
+}
+
+// Query filters records read from the store.
+// Zero values match everything.
+type Query struct {
+	From    time.Time
+	To      time.Time
+	Serial  string
+	Outcome Outcome
+}
+
+func (q Query) matchTime(t time.Time) bool {
+	if !q.From.IsZero() && t.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && t.After(q.To) {
+		return false
+	}
+	return true
+}
+
+func (q Query) matchJob(j Job) bool {
+	if q.Serial != "" && q.Serial != j.Serial {
+		return false
+	}
+	if q.Outcome != "" && q.Outcome != j.Outcome {
+		return false
+	}
+	return q.matchTime(j.EndedAt)
+}
+
+func (q Query) matchSnapshot(s Snapshot) bool {
+	if q.Serial != "" && q.Serial != s.Serial {
+		return false
+	}
+	return q.matchTime(s.Time)
+}
+
+// Summary counts job outcomes.
+type Summary struct {
+	Total     int
+	Finished  int
+	Failed    int
+	Cancelled int
+}
+
+// SuccessRate is the fraction of jobs that finished, between 0 and 1.
+func (s Summary) SuccessRate() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Finished) / float64(s.Total)
+}
+
+// Store persists jobs and state snapshots as append-only JSON Lines files
+// in a directory.
+type Store struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// Open opens a store in dir, creating the directory if needed.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return nil, fmt.Errorf("create store dir: %w", err)
+	}
+	s := &Store{dir: dir}
+	for _, name := range []string{jobsFile, snapshotsFile} {
+		if err := repair(s.path(name)); err != nil {
+			return nil, fmt.Errorf("repair %s: %w", name, err)
+		}
+	}
+	return s, nil
+}
+
+// AddJob appends a job to the store.
+func (s *Store) AddJob(j Job) error {
+	return s.append(jobsFile, j)
+}
+
+// AddSnapshot appends a state snapshot to the store.
+func (s *Store) AddSnapshot(sn Snapshot) error {
+	return s.append(snapshotsFile, sn)
+}
+
+// Jobs returns the jobs matching q, in the order they were added.
+func (s *Store) Jobs(q Query) ([]Job, error) {
+	jobs := []Job{}
+	err := s.scan(jobsFile, func(line []byte) error {
+		var j Job
+		if err := json.Unmarshal(line, &j); err != nil {
+			return err
+		}
+		if q.matchJob(j) {
+			jobs = append(jobs, j)
+		}
+		return nil
+	})
+	return jobs, err
+}
+
+// Snapshots returns the snapshots matching q, in the order they were added.
+// Query.Outcome is ignored.
+func (s *Store) Snapshots(q Query) ([]Snapshot, error) {
+	snapshots := []Snapshot{}
+	err := s.scan(snapshotsFile, func(line []byte) error {
+		var sn Snapshot
+		if err := json.Unmarshal(line, &sn); err != nil {
+			return err
+		}
+		if q.matchSnapshot(sn) {
+			snapshots = append(snapshots, sn)
+		}
+		return nil
+	})
+	return snapshots, err
+}
+
+// Summarize counts the outcomes of jobs matching q.
+func (s *Store) Summarize(q Query) (Summary, error) {
+	summary := Summary{}
+	jobs, err := s.Jobs(q)
+	if err != nil {
+		return summary, err
+	}
+	for _, j := range jobs {
+		summary.Total++
+		switch j.Outcome {
+		case OutcomeFinished:
+			summary.Finished++
+		case OutcomeFailed:
+			summary.Failed++
+		case OutcomeCancelled:
+			summary.Cancelled++
+		}
+	}
+	return summary, nil
+}
+
+// Compact rewrites the store files, dropping snapshots taken before cutoff
+// and keeping only the latest record of jobs sharing a serial and task ID.
+// Jobs without a task ID, or with the ID 0 of local prints, are all kept.
+func (s *Store) Compact(cutoff time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := []Job{}
+	index := map[string]int{}
+	err := s.scanLocked(jobsFile, func(line []byte) error {
+		var j Job
+		if err := json.Unmarshal(line, &j); err != nil {
+			return err
+		}
+		// Local prints report a task ID of 0
+		if j.TaskID == "" || j.TaskID == "0" {
+			jobs = append(jobs, j)
+			return nil
+		}
+		key := j.Serial + "/" + j.TaskID
+		if i, ok := index[key]; ok {
+			jobs[i] = j
+			return nil
+		}
+		index[key] = len(jobs)
+		jobs = append(jobs, j)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := rewrite(s.path(jobsFile), jobs); err != nil {
+		return err
+	}
+
+	snapshots := []Snapshot{}
+	err = s.scanLocked(snapshotsFile, func(line []byte) error {
+		var sn Snapshot
+		if err := json.Unmarshal(line, &sn); err != nil {
+			return err
+		}
+		if !sn.Time.Before(cutoff) {
+			snapshots = append(snapshots, sn)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return rewrite(s.path(snapshotsFile), snapshots)
+}
+
+func (s *Store) append(name string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path(name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, filePerm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *Store) scan(name string, fn func(line []byte) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scanLocked(name, fn)
+}
+
+// scanLocked calls fn for each line of the named file. A trailing line that
+// fails to decode is assumed to be a torn write and is skipped.
+func (s *Store) scanLocked(name string, fn func(line []byte) error) error {
+	f, err := os.Open(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var pending error
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		if pending != nil {
+			return pending
+		}
+		if err := fn(line); err != nil {
+			var syntaxErr *json.SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				return err
+			}
+			pending = fmt.Errorf("decode %s: %w", name, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// repair truncates a partially written final line left by an interrupted
+// append, so new records start on a line of their own.
+func repair(path string) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(b) == 0 || b[len(b)-1] == '\n' {
+		return nil
+	}
+	end := bytes.LastIndexByte(b, '\n') + 1
+	return os.Truncate(path, int64(end))
+}
+
+// rewrite atomically replaces the file at path with records, one per line.
+func rewrite[T any](path string, records []T) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), filePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
@@ -0,0 +1,182 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/monitor"
+	opt "github.com/moznion/go-optional"
+	"github.com/stretchr/testify/assert"
+)
+
+var base = time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+
+func TestStore_Jobs(t *testing.T) {
+	s, err := Open(t.TempDir())
+	assert.Nil(t, err)
+
+	jobs := []Job{
+		{Serial: "A", TaskID: "1", Outcome: OutcomeFinished, EndedAt: base},
+		{Serial: "A", TaskID: "2", Outcome: OutcomeFailed, EndedAt: base.Add(time.Hour)},
+		{Serial: "B", TaskID: "3", Outcome: OutcomeFinished, EndedAt: base.Add(2 * time.Hour)},
+		{Serial: "B", TaskID: "4", Outcome: OutcomeCancelled, EndedAt: base.Add(3 * time.Hour)},
+	}
+	for _, j := range jobs {
+		assert.Nil(t, s.AddJob(j))
+	}
+
+	tests := []struct {
+		name     string
+		query    Query
+		expected []string
+	}{
+		{
+			name:     "all",
+			query:    Query{},
+			expected: []string{"1", "2", "3", "4"},
+		},
+		{
+			name:     "by serial",
+			query:    Query{Serial: "B"},
+			expected: []string{"3", "4"},
+		},
+		{
+			name:     "by outcome",
+			query:    Query{Outcome: OutcomeFinished},
+			expected: []string{"1", "3"},
+		},
+		{
+			name:     "by time range",
+			query:    Query{From: base.Add(30 * time.Minute), To: base.Add(2 * time.Hour)},
+			expected: []string{"2", "3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Jobs(tt.query)
+			assert.Nil(t, err)
+			ids := []string{}
+			for _, j := range got {
+				ids = append(ids, j.TaskID)
+			}
+			assert.Equal(t, tt.expected, ids)
+		})
+	}
+}
+
+func TestStore_Summarize(t *testing.T) {
+	s, err := Open(t.TempDir())
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.AddJob(Job{Serial: "A", Outcome: OutcomeFinished, EndedAt: base}))
+	assert.Nil(t, s.AddJob(Job{Serial: "A", Outcome: OutcomeFinished, EndedAt: base}))
+	assert.Nil(t, s.AddJob(Job{Serial: "A", Outcome: OutcomeFinished, EndedAt: base}))
+	assert.Nil(t, s.AddJob(Job{Serial: "A", Outcome: OutcomeFailed, EndedAt: base}))
+
+	summary, err := s.Summarize(Query{})
+	assert.Nil(t, err)
+	assert.Equal(t, Summary{Total: 4, Finished: 3, Failed: 1}, summary)
+	assert.Equal(t, 0.75, summary.SuccessRate())
+}
+
+func TestStore_Snapshots(t *testing.T) {
+	s, err := Open(t.TempDir())
+	assert.Nil(t, err)
+
+	state := monitor.State{}
+	state.Gcode.State = opt.Some("RUNNING")
+	state.Bed.Temperature = opt.Some(55.5)
+	assert.Nil(t, s.AddSnapshot(Snapshot{Serial: "A", Time: base, State: state}))
+	assert.Nil(t, s.AddSnapshot(Snapshot{Serial: "B", Time: base, State: monitor.State{}}))
+
+	got, err := s.Snapshots(Query{Serial: "A"})
+	assert.Nil(t, err)
+	assert.Len(t, got, 1)
+	assert.Equal(t, "RUNNING", got[0].State.Gcode.State.Unwrap())
+	assert.Equal(t, 55.5, got[0].State.Bed.Temperature.Unwrap())
+	assert.True(t, got[0].State.Nozzle.Temperature.IsNone())
+}
+
+func TestStore_Compact(t *testing.T) {
+	s, err := Open(t.TempDir())
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.AddJob(Job{Serial: "A", TaskID: "1", Outcome: OutcomeFailed, EndedAt: base}))
+	assert.Nil(t, s.AddJob(Job{Serial: "A", TaskID: "2", Outcome: OutcomeFinished, EndedAt: base}))
+	assert.Nil(t, s.AddJob(Job{Serial: "A", TaskID: "1", Outcome: OutcomeFinished, EndedAt: base}))
+	assert.Nil(t, s.AddSnapshot(Snapshot{Serial: "A", Time: base}))
+	assert.Nil(t, s.AddSnapshot(Snapshot{Serial: "A", Time: base.Add(time.Hour)}))
+
+	assert.Nil(t, s.Compact(base.Add(time.Minute)))
+
+	jobs, err := s.Jobs(Query{})
+	assert.Nil(t, err)
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, "1", jobs[0].TaskID)
+	assert.Equal(t, OutcomeFinished, jobs[0].Outcome)
+
+	snapshots, err := s.Snapshots(Query{})
+	assert.Nil(t, err)
+	assert.Len(t, snapshots, 1)
+	assert.Equal(t, base.Add(time.Hour), snapshots[0].Time)
+}
+
+func TestStore_CompactLocalJobs(t *testing.T) {
+	s, err := Open(t.TempDir())
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.AddJob(Job{Serial: "A", TaskID: "0", Name: "cube", Outcome: OutcomeFinished, EndedAt: base}))
+	assert.Nil(t, s.AddJob(Job{Serial: "A", TaskID: "0", Name: "boat", Outcome: OutcomeFailed, EndedAt: base.Add(time.Hour)}))
+
+	assert.Nil(t, s.Compact(base))
+
+	jobs, err := s.Jobs(Query{})
+	assert.Nil(t, err)
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, "cube", jobs[0].Name)
+	assert.Equal(t, "boat", jobs[1].Name)
+}
+
+func TestStore_TornWrite(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	assert.Nil(t, err)
+	assert.Nil(t, s.AddJob(Job{Serial: "A", TaskID: "1", Outcome: OutcomeFinished}))
+
+	f, err := os.OpenFile(filepath.Join(dir, jobsFile), os.O_APPEND|os.O_WRONLY, 0)
+	assert.Nil(t, err)
+	_, err = f.WriteString(`{"serial":"A","task_`)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+
+	jobs, err := s.Jobs(Query{})
+	assert.Nil(t, err)
+	assert.Len(t, jobs, 1)
+
+	// Reopening drops the partial line so appends are not corrupted
+	s, err = Open(dir)
+	assert.Nil(t, err)
+	assert.Nil(t, s.AddJob(Job{Serial: "A", TaskID: "2", Outcome: OutcomeFinished}))
+	jobs, err = s.Jobs(Query{})
+	assert.Nil(t, err)
+	assert.Len(t, jobs, 2)
+}
+
+func TestNewJob(t *testing.T) {
+	state := monitor.State{
+		CurrentPrint: monitor.CurrentPrint{
+			Subtask:           opt.Some("cube"),
+			TaskID:            opt.Some("123456789"),
+			SubtaskID:         opt.Some("987654321"),
+			LayerNumberTarget: opt.Some(120),
+		},
+	}
+	job := NewJob("A", state, OutcomeFinished, base, base.Add(time.Hour))
+	assert.Equal(t, "123456789", job.TaskID)
+	assert.Equal(t, "987654321", job.SubtaskID)
+	assert.Equal(t, "cube", job.Name)
+	assert.Equal(t, 120, job.Layers)
+	assert.Equal(t, time.Hour, job.Duration())
+}
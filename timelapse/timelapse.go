@@ -0,0 +1,244 @@
+package timelapse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/ftps"
+	"github.com/evanofslack/bambulab-client/store"
+)
+
+const (
+	// Dir is where printers store timelapse videos.
+	Dir = "/timelapse"
+	// ThumbnailDir is where printers store a thumbnail for each video.
+	ThumbnailDir = "/timelapse/thumbnail"
+
+	defaultSlack  = 10 * time.Minute
+	partialSuffix = ".part"
+	dirPerm       = 0o755
+	filePerm      = 0o644
+)
+
+var ErrNoMatch = errors.New("no timelapse matches job")
+
+var videoExts = map[string]bool{".mp4": true, ".avi": true}
+
+// Video is a timelapse on the printer storage.
+type Video struct {
+	Name string
+	Path string
+	Size int64
+	// Time the recording started, from the file name if present,
+	// otherwise the modification time reported by the printer.
+	Time time.Time
+	// Thumbnail is the path of the thumbnail, empty if there is none.
+	Thumbnail     string
+	ThumbnailSize int64
+}
+
+// storage is the subset of the ftps client used to read timelapses.
+type storage interface {
+	List(ctx context.Context, dir string) ([]ftps.Entry, error)
+	Retrieve(ctx context.Context, remotePath string, w io.Writer, offset int64, progress ftps.ProgressFunc) error
+}
+
+// Archiver copies timelapse videos from a printer to a local directory.
+type Archiver struct {
+	// Dir videos and thumbnails are downloaded to.
+	Dir string
+	// Slack is how far outside of a job a video may start and still match.
+	Slack time.Duration
+	// Location of the printer clock, used to read times from file names.
+	Location *time.Location
+
+	storage storage
+}
+
+// New creates an archiver downloading timelapses from c into dir.
+func New(c *ftps.Client, dir string) *Archiver {
+	return newArchiver(c, dir)
+}
+
+func newArchiver(s storage, dir string) *Archiver {
+	return &Archiver{
+		Dir:      dir,
+		Slack:    defaultSlack,
+		Location: time.Local,
+		storage:  s,
+	}
+}
+
+// List returns the timelapse videos on the printer, oldest first.
+func (a *Archiver) List(ctx context.Context) ([]Video, error) {
+	entries, err := a.storage.List(ctx, Dir)
+	if err != nil {
+		return nil, fmt.Errorf("list timelapses: %w", err)
+	}
+	// Not every model stores thumbnails
+	thumbs := map[string]ftps.Entry{}
+	if entries, err := a.storage.List(ctx, ThumbnailDir); err == nil {
+		for _, e := range entries {
+			if !e.IsDir {
+				thumbs[stem(e.Name)] = e
+			}
+		}
+	}
+
+	videos := []Video{}
+	for _, e := range entries {
+		if e.IsDir || !videoExts[strings.ToLower(path.Ext(e.Name))] {
+			continue
+		}
+		v := Video{
+			Name: e.Name,
+			Path: path.Join(Dir, e.Name),
+			Size: e.Size,
+			Time: a.videoTime(e),
+		}
+		if thumb, ok := thumbs[stem(e.Name)]; ok {
+			v.Thumbnail = path.Join(ThumbnailDir, thumb.Name)
+			v.ThumbnailSize = thumb.Size
+		}
+		videos = append(videos, v)
+	}
+	sort.Slice(videos, func(i, j int) bool {
+		return videos[i].Time.Before(videos[j].Time)
+	})
+	return videos, nil
+}
+
+// Match returns the video recorded during job. Videos named after the job
+// are preferred, otherwise the video starting closest to the job is used.
+func (a *Archiver) Match(videos []Video, job store.Job) (Video, bool) {
+	from := job.StartedAt.Add(-a.Slack)
+	to := job.EndedAt
+	if to.IsZero() {
+		to = job.StartedAt
+	}
+	to = to.Add(a.Slack)
+
+	var best Video
+	found, named := false, false
+	for _, v := range videos {
+		if v.Time.Before(from) || v.Time.After(to) {
+			continue
+		}
+		isNamed := job.Name != "" && strings.Contains(stem(v.Name), job.Name)
+		if found {
+			if named && !isNamed {
+				continue
+			}
+			if named == isNamed && distance(v.Time, job.StartedAt) >= distance(best.Time, job.StartedAt) {
+				continue
+			}
+		}
+		best, found, named = v, true, isNamed
+	}
+	return best, found
+}
+
+// Download copies the video and its thumbnail to the archive directory and
+// returns the local path of the video. Files already downloaded are skipped
+// and partial downloads are resumed.
+func (a *Archiver) Download(ctx context.Context, v Video, progress ftps.ProgressFunc) (string, error) {
+	if err := os.MkdirAll(a.Dir, dirPerm); err != nil {
+		return "", err
+	}
+	local := filepath.Join(a.Dir, v.Name)
+	if err := a.fetch(ctx, v.Path, v.Size, local, progress); err != nil {
+		return "", fmt.Errorf("download timelapse %s: %w", v.Name, err)
+	}
+	if v.Thumbnail != "" {
+		thumb := filepath.Join(a.Dir, path.Base(v.Thumbnail))
+		if err := a.fetch(ctx, v.Thumbnail, v.ThumbnailSize, thumb, nil); err != nil {
+			return "", fmt.Errorf("download thumbnail %s: %w", v.Thumbnail, err)
+		}
+	}
+	return local, nil
+}
+
+// Archive finds the video recorded during job and downloads it.
+func (a *Archiver) Archive(ctx context.Context, job store.Job, progress ftps.ProgressFunc) (string, error) {
+	videos, err := a.List(ctx)
+	if err != nil {
+		return "", err
+	}
+	v, ok := a.Match(videos, job)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNoMatch, job.Name)
+	}
+	return a.Download(ctx, v, progress)
+}
+
+// fetch downloads remote into a partial file next to local, resuming from
+// its current size, and renames it into place once complete.
+func (a *Archiver) fetch(ctx context.Context, remote string, size int64, local string, progress ftps.ProgressFunc) error {
+	if info, err := os.Stat(local); err == nil && info.Size() == size {
+		return nil
+	}
+	partial := local + partialSuffix
+	f, err := os.OpenFile(partial, os.O_CREATE|os.O_WRONLY, filePerm)
+	if err != nil {
+		return err
+	}
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	// The remote file changed, start over
+	if offset > size {
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+			return err
+		}
+		if offset, err = f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if offset < size {
+		if err := a.storage.Retrieve(ctx, remote, f, offset, progress); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(partial, local)
+}
+
+// videoTime reads the start time from names like video_2024-01-15_10-30-45.mp4
+func (a *Archiver) videoTime(e ftps.Entry) time.Time {
+	name := strings.TrimPrefix(stem(e.Name), "video_")
+	loc := a.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	if t, err := time.ParseInLocation("2006-01-02_15-04-05", name, loc); err == nil {
+		return t
+	}
+	return e.ModTime
+}
+
+func stem(name string) string {
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+func distance(a, b time.Time) time.Duration {
+	d := a.Sub(b)
+	if d < 0 {
+		return -d
+	}
+	return d
+}
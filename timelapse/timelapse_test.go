@@ -0,0 +1,177 @@
+package timelapse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/evanofslack/bambulab-client/ftps"
+	"github.com/evanofslack/bambulab-client/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStorage serves files from memory and records retrieve offsets.
+type fakeStorage struct {
+	files   map[string][]byte
+	offsets map[string]int64
+}
+
+func newFakeStorage(files map[string][]byte) *fakeStorage {
+	return &fakeStorage{files: files, offsets: map[string]int64{}}
+}
+
+func (s *fakeStorage) List(_ context.Context, dir string) ([]ftps.Entry, error) {
+	entries := []ftps.Entry{}
+	for p, b := range s.files {
+		if path.Dir(p) == dir {
+			entries = append(entries, ftps.Entry{Name: path.Base(p), Size: int64(len(b))})
+		}
+	}
+	if dir == Dir {
+		entries = append(entries, ftps.Entry{Name: "thumbnail", IsDir: true})
+	}
+	return entries, nil
+}
+
+func (s *fakeStorage) Retrieve(_ context.Context, remote string, w io.Writer, offset int64, _ ftps.ProgressFunc) error {
+	b, ok := s.files[remote]
+	if !ok {
+		return errors.New("550 not found")
+	}
+	s.offsets[remote] = offset
+	_, err := w.Write(b[offset:])
+	return err
+}
+
+func testTime(s string) time.Time {
+	t, _ := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+	return t
+}
+
+func newTestArchiver(t *testing.T, s storage) *Archiver {
+	a := newArchiver(s, t.TempDir())
+	a.Location = time.UTC
+	return a
+}
+
+func TestArchiver_List(t *testing.T) {
+	s := newFakeStorage(map[string][]byte{
+		"/timelapse/video_2024-01-15_12-00-00.mp4":           []byte("later"),
+		"/timelapse/video_2024-01-15_10-30-45.avi":           []byte("earlier"),
+		"/timelapse/notes.txt":                               []byte("skip"),
+		"/timelapse/thumbnail/video_2024-01-15_10-30-45.jpg": []byte("thumb"),
+	})
+	videos, err := newTestArchiver(t, s).List(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, videos, 2)
+
+	assert.Equal(t, "video_2024-01-15_10-30-45.avi", videos[0].Name)
+	assert.Equal(t, "/timelapse/video_2024-01-15_10-30-45.avi", videos[0].Path)
+	assert.Equal(t, int64(7), videos[0].Size)
+	assert.Equal(t, time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC), videos[0].Time)
+	assert.Equal(t, "/timelapse/thumbnail/video_2024-01-15_10-30-45.jpg", videos[0].Thumbnail)
+
+	assert.Equal(t, "video_2024-01-15_12-00-00.mp4", videos[1].Name)
+	assert.Equal(t, "", videos[1].Thumbnail)
+}
+
+func TestArchiver_Match(t *testing.T) {
+	videos := []Video{
+		{Name: "video_a.mp4", Time: testTime("2024-01-15 10:01")},
+		{Name: "video_b.mp4", Time: testTime("2024-01-15 10:20")},
+		{Name: "benchy_c.mp4", Time: testTime("2024-01-15 10:30")},
+		{Name: "video_d.mp4", Time: testTime("2024-01-16 09:00")},
+	}
+	tests := []struct {
+		name  string
+		job   store.Job
+		want  string
+		found bool
+	}{
+		{
+			name:  "closest to start",
+			job:   store.Job{Name: "cube", StartedAt: testTime("2024-01-15 10:00"), EndedAt: testTime("2024-01-15 11:00")},
+			want:  "video_a.mp4",
+			found: true,
+		},
+		{
+			name:  "subtask name preferred",
+			job:   store.Job{Name: "benchy", StartedAt: testTime("2024-01-15 10:00"), EndedAt: testTime("2024-01-15 11:00")},
+			want:  "benchy_c.mp4",
+			found: true,
+		},
+		{
+			name:  "within slack",
+			job:   store.Job{StartedAt: testTime("2024-01-16 09:05"), EndedAt: testTime("2024-01-16 10:00")},
+			want:  "video_d.mp4",
+			found: true,
+		},
+		{
+			name: "no video during job",
+			job:  store.Job{Name: "benchy", StartedAt: testTime("2024-01-17 10:00"), EndedAt: testTime("2024-01-17 11:00")},
+		},
+	}
+	a := newTestArchiver(t, newFakeStorage(nil))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, found := a.Match(videos, tt.job)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.want, v.Name)
+		})
+	}
+}
+
+func TestArchiver_DownloadResume(t *testing.T) {
+	video := bytes.Repeat([]byte("v"), 100)
+	s := newFakeStorage(map[string][]byte{
+		"/timelapse/video_2024-01-15_10-30-45.mp4":           video,
+		"/timelapse/thumbnail/video_2024-01-15_10-30-45.jpg": []byte("thumb"),
+	})
+	a := newTestArchiver(t, s)
+	videos, err := a.List(context.Background())
+	assert.Nil(t, err)
+
+	// A previous download stopped part way through
+	partial := filepath.Join(a.Dir, "video_2024-01-15_10-30-45.mp4"+partialSuffix)
+	assert.Nil(t, os.WriteFile(partial, video[:40], filePerm))
+
+	local, err := a.Download(context.Background(), videos[0], nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(40), s.offsets["/timelapse/video_2024-01-15_10-30-45.mp4"])
+	b, err := os.ReadFile(local)
+	assert.Nil(t, err)
+	assert.Equal(t, video, b)
+	b, err = os.ReadFile(filepath.Join(a.Dir, "video_2024-01-15_10-30-45.jpg"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("thumb"), b)
+	_, err = os.Stat(partial)
+	assert.True(t, os.IsNotExist(err))
+
+	// Complete files are not downloaded again
+	delete(s.offsets, "/timelapse/video_2024-01-15_10-30-45.mp4")
+	_, err = a.Download(context.Background(), videos[0], nil)
+	assert.Nil(t, err)
+	assert.NotContains(t, s.offsets, "/timelapse/video_2024-01-15_10-30-45.mp4")
+}
+
+func TestArchiver_Archive(t *testing.T) {
+	s := newFakeStorage(map[string][]byte{
+		"/timelapse/video_2024-01-15_10-30-45.mp4": []byte("video"),
+	})
+	a := newTestArchiver(t, s)
+	job := store.Job{Name: "cube", StartedAt: testTime("2024-01-15 10:30"), EndedAt: testTime("2024-01-15 11:30")}
+	local, err := a.Archive(context.Background(), job, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(a.Dir, "video_2024-01-15_10-30-45.mp4"), local)
+
+	job.StartedAt = testTime("2024-02-01 10:00")
+	job.EndedAt = testTime("2024-02-01 11:00")
+	_, err = a.Archive(context.Background(), job, nil)
+	assert.True(t, errors.Is(err, ErrNoMatch))
+}